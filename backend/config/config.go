@@ -0,0 +1,182 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings are read from environment variables once at startup by Load.
+var (
+	// Admins lists nicknames that are given the admin role on startup.
+	Admins []string
+
+	// RetentionInterval is how often the retention job runs.
+	RetentionInterval time.Duration
+	// RetentionDryRun makes the retention job only report what it would remove.
+	RetentionDryRun bool
+	// MessageRetentionDays deletes direct messages older than this many days (0 keeps them).
+	MessageRetentionDays int
+	// MessageRetentionOptIn limits message deletion to conversations that opted in.
+	MessageRetentionOptIn bool
+	// UnverifiedAccountDays purges accounts that never signed in after this many days (0 disables).
+	UnverifiedAccountDays int
+	// InactiveAccountDays anonymizes accounts not seen for this many days (0 disables).
+	InactiveAccountDays int
+	// UnattachedUploadHours deletes uploads not attached to a post or comment
+	// after this many hours (0 keeps them).
+	UnattachedUploadHours int
+
+	// CommentMaxDepth is how deeply replies may nest; top-level comments are depth 0.
+	CommentMaxDepth int
+	// ReactionEmoji are the emoji users may react with besides like and dislike.
+	ReactionEmoji []string
+	// TagsPerPost is how many tags a post may carry.
+	TagsPerPost int
+
+	// ReportHideThreshold is how many different users must report a post,
+	// comment or message before it is hidden pending review; 0 never hides.
+	ReportHideThreshold int
+
+	// NewAccountAge is how long an account counts as new for NewAccountLinks.
+	NewAccountAge time.Duration
+	// NewAccountLinks is how many links new accounts may post at once before
+	// the content is held for review.
+	NewAccountLinks int
+	// RepeatLimit is how many times the same text may be posted within
+	// RepeatWindow before further copies are rejected; 0 disables the check.
+	RepeatLimit  int
+	RepeatWindow time.Duration
+	// SpamThreshold is the spam probability, in percent, above which the
+	// classifier holds content for review; 0 disables it.
+	SpamThreshold int
+	// SpamMinDocuments is how many spam and how many non-spam decisions the
+	// classifier must have learned from before it holds anything.
+	SpamMinDocuments int
+
+	// AttachmentMaxBytes is the largest image that may be uploaded.
+	AttachmentMaxBytes int
+	// AttachmentsPerItem is how many images a post or comment may carry.
+	AttachmentsPerItem int
+	// ThumbnailSize is the longest side of generated thumbnails, in pixels.
+	ThumbnailSize int
+	// BlobStore selects where uploads are kept: "local" or "s3".
+	BlobStore string
+	// UploadDir is the directory used by the local blob store.
+	UploadDir string
+	// S3Endpoint, S3Region, S3Bucket, S3AccessKey and S3SecretKey configure
+	// the S3-compatible blob store. Objects are addressed path-style, so
+	// MinIO and similar servers work as well as AWS.
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+
+	// ExportTTL is how long a finished data export is kept for download.
+	ExportTTL time.Duration
+
+	// MessageKeys is a comma-separated list of "id:base64key" AES-256 keys for
+	// direct messages; empty disables encryption at rest.
+	MessageKeys string
+	// MessageKeyID selects which of MessageKeys encrypts new messages.
+	MessageKeyID string
+)
+
+func Load() {
+	Admins = envList("FORUM_ADMINS")
+
+	RetentionInterval = envDuration("RETENTION_INTERVAL", 24*time.Hour)
+	RetentionDryRun = envBool("RETENTION_DRY_RUN", false)
+	MessageRetentionDays = envInt("RETENTION_MESSAGE_DAYS", 0)
+	MessageRetentionOptIn = envBool("RETENTION_MESSAGES_OPT_IN", false)
+	UnverifiedAccountDays = envInt("RETENTION_UNVERIFIED_DAYS", 0)
+	InactiveAccountDays = envInt("RETENTION_INACTIVE_DAYS", 0)
+	UnattachedUploadHours = envInt("RETENTION_UNATTACHED_UPLOAD_HOURS", 24)
+
+	CommentMaxDepth = envInt("COMMENT_MAX_DEPTH", 5)
+	ReactionEmoji = envList("REACTION_EMOJI")
+	if ReactionEmoji == nil {
+		ReactionEmoji = []string{"❤️", "😂", "😮", "😢", "🎉"}
+	}
+	TagsPerPost = envInt("TAGS_PER_POST", 5)
+	ReportHideThreshold = envInt("REPORT_HIDE_THRESHOLD", 3)
+
+	NewAccountAge = envDuration("NEW_ACCOUNT_AGE", 24*time.Hour)
+	NewAccountLinks = envInt("NEW_ACCOUNT_LINKS", 2)
+	RepeatLimit = envInt("REPEAT_LIMIT", 3)
+	RepeatWindow = envDuration("REPEAT_WINDOW", 10*time.Minute)
+	SpamThreshold = envInt("SPAM_THRESHOLD", 95)
+	SpamMinDocuments = envInt("SPAM_MIN_DOCUMENTS", 20)
+
+	AttachmentMaxBytes = envInt("ATTACHMENT_MAX_BYTES", 5<<20)
+	AttachmentsPerItem = envInt("ATTACHMENTS_PER_ITEM", 4)
+	ThumbnailSize = envInt("ATTACHMENT_THUMBNAIL_SIZE", 320)
+	BlobStore = envString("BLOB_STORE", "local")
+	UploadDir = envString("UPLOAD_DIR", "uploads")
+	S3Endpoint = os.Getenv("S3_ENDPOINT")
+	S3Region = envString("S3_REGION", "us-east-1")
+	S3Bucket = os.Getenv("S3_BUCKET")
+	S3AccessKey = os.Getenv("S3_ACCESS_KEY")
+	S3SecretKey = os.Getenv("S3_SECRET_KEY")
+
+	ExportTTL = envDuration("EXPORT_TTL", 24*time.Hour)
+
+	MessageKeys = os.Getenv("MESSAGE_ENCRYPTION_KEYS")
+	MessageKeyID = os.Getenv("MESSAGE_ENCRYPTION_KEY_ID")
+}
+
+func envString(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Fatalf("Invalid value for %s: %q (expected a non-negative integer)", name, value)
+	}
+	return n
+}
+
+func envBool(name string, def bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Invalid value for %s: %q (expected true or false)", name, value)
+	}
+	return b
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Fatalf("Invalid value for %s: %q (expected a duration such as 24h)", name, value)
+	}
+	return d
+}
+
+func envList(name string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,125 @@
+package contentfilter
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"real-time-forum/backend/config"
+	"real-time-forum/backend/database"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxTokens caps how many distinct words of one document are counted, so
+// a huge post cannot dominate training or make scoring slow.
+const maxTokens = 200
+
+// tokens splits text into the distinct lowercase words the classifier
+// counts. Links count as a word of their own so they can weigh in.
+func tokens(text string) []string {
+	seen := make(map[string]bool)
+	var found []string
+	add := func(token string) {
+		if !seen[token] && len(found) < maxTokens {
+			seen[token] = true
+			found = append(found, token)
+		}
+	}
+	if linkPattern.MatchString(text) {
+		add("<link>")
+	}
+	text = strings.ToLower(text)
+	eachWord(text, func(start, end int) {
+		if n := utf8.RuneCountInString(text[start:end]); n >= 2 && n <= 30 {
+			add(text[start:end])
+		}
+	})
+	return found
+}
+
+// Train teaches the classifier that text is spam or not. It runs in the
+// caller's transaction so a moderator's decision and what it teaches are
+// saved together.
+func Train(tx *sql.Tx, text string, spam bool) error {
+	class := "ham"
+	if spam {
+		class = "spam"
+	}
+	for _, token := range tokens(text) {
+		_, err := tx.Exec(`
+			INSERT INTO spam_tokens (token, `+class+`) VALUES (?, 1)
+			ON CONFLICT(token) DO UPDATE SET `+class+` = `+class+` + 1`, token)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`
+		INSERT INTO spam_classes (class, documents) VALUES (?, 1)
+		ON CONFLICT(class) DO UPDATE SET documents = documents + 1`, class)
+	return err
+}
+
+// SpamScore is the probability, from 0 to 1, that text is spam. trained is
+// false, and the score 0, until the classifier has learned from
+// config.SpamMinDocuments spam and non-spam documents.
+func SpamScore(text string) (score float64, trained bool, err error) {
+	var spamDocs, hamDocs int
+	err = database.DB.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN class = 'spam' THEN documents END), 0),
+			COALESCE(SUM(CASE WHEN class = 'ham' THEN documents END), 0)
+		FROM spam_classes`).Scan(&spamDocs, &hamDocs)
+	if err != nil || spamDocs < config.SpamMinDocuments || hamDocs < config.SpamMinDocuments || spamDocs == 0 || hamDocs == 0 {
+		return 0, false, err
+	}
+
+	words := tokens(text)
+	if len(words) == 0 {
+		return 0, true, nil
+	}
+	placeholders := make([]string, len(words))
+	args := make([]interface{}, len(words))
+	for i, word := range words {
+		placeholders[i] = "?"
+		args[i] = word
+	}
+	rows, err := database.DB.Query(`
+		SELECT spam, ham FROM spam_tokens WHERE token IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+
+	// Naive Bayes in log space, with add-one smoothing so a word seen in
+	// only one kind of document does not decide alone. Words never seen in
+	// training say nothing and are skipped.
+	total := float64(spamDocs + hamDocs)
+	logSpam := math.Log(float64(spamDocs) / total)
+	logHam := math.Log(float64(hamDocs) / total)
+	for rows.Next() {
+		var spam, ham int
+		if err := rows.Scan(&spam, &ham); err != nil {
+			return 0, false, err
+		}
+		logSpam += math.Log(float64(spam+1) / float64(spamDocs+2))
+		logHam += math.Log(float64(ham+1) / float64(hamDocs+2))
+	}
+	if err := rows.Err(); err != nil {
+		return 0, false, err
+	}
+	return 1 / (1 + math.Exp(logHam-logSpam)), true, nil
+}
+
+// SpamFilter holds content the classifier scores at or above
+// config.SpamThreshold percent.
+type SpamFilter struct{}
+
+func (SpamFilter) Check(c *Content) (Action, string, error) {
+	if config.SpamThreshold <= 0 {
+		return Allow, "", nil
+	}
+	score, trained, err := SpamScore(c.all())
+	if err != nil || !trained || score*100 < float64(config.SpamThreshold) {
+		return Allow, "", err
+	}
+	return Hold, fmt.Sprintf("Looks like spam (%.0f%%)", score*100), nil
+}
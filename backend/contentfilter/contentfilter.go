@@ -0,0 +1,196 @@
+// Package contentfilter checks posts, comments and chat messages before
+// they are stored. Each ContentFilter may let content through, mask parts
+// of it, hold it for moderator review or reject it outright.
+package contentfilter
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"real-time-forum/backend/config"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/utils"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Action is what a filter decides about content. Later actions are
+// stronger, and the pipeline keeps the strongest.
+type Action int
+
+const (
+	Allow Action = iota
+	Mask
+	Hold
+	Reject
+)
+
+var actionNames = []string{"allow", "mask", "hold", "reject"}
+
+func (a Action) String() string {
+	return actionNames[a]
+}
+
+// ParseAction reads an action name as stored for banned words.
+func ParseAction(name string) (Action, error) {
+	for i, n := range actionNames {
+		if n == name {
+			return Action(i), nil
+		}
+	}
+	return Allow, fmt.Errorf("unknown filter action %q", name)
+}
+
+// Content is a post, comment or chat message about to be stored. Posts
+// have a Title; filters that mask rewrite Title and Text in place.
+type Content struct {
+	Kind     string
+	AuthorID string
+	Title    string
+	Text     string
+}
+
+func (c Content) all() string {
+	if c.Title == "" {
+		return c.Text
+	}
+	return c.Title + "\n" + c.Text
+}
+
+// ContentFilter is one check in the pipeline. Reason explains a Hold or
+// Reject: rejections are shown to the author, holds to moderators.
+type ContentFilter interface {
+	Check(c *Content) (action Action, reason string, err error)
+}
+
+// Verdict is the outcome of running content through a Pipeline. Title and
+// Text are the content after masking.
+type Verdict struct {
+	Action Action
+	Reason string
+	Title  string
+	Text   string
+}
+
+// Pipeline runs filters in order. A rejection stops it early.
+type Pipeline []ContentFilter
+
+func (p Pipeline) Run(c Content) (Verdict, error) {
+	v := Verdict{Action: Allow}
+	for _, f := range p {
+		action, reason, err := f.Check(&c)
+		if err != nil {
+			return v, err
+		}
+		if action > v.Action {
+			v.Action = action
+			if action >= Hold {
+				v.Reason = reason
+			}
+		}
+		if action == Reject {
+			break
+		}
+	}
+	v.Title, v.Text = c.Title, c.Text
+	return v, nil
+}
+
+// Default is the pipeline every post, comment and message goes through.
+// Cheap checks come first so a rejection skips the classifier.
+var Default = Pipeline{
+	BannedWords{},
+	&RepeatFilter{seen: make(map[string][]sighting)},
+	LinkLimit{},
+	SpamFilter{},
+}
+
+// Check runs c through the Default pipeline.
+func Check(c Content) (Verdict, error) {
+	return Default.Run(c)
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://|\bwww\.`)
+
+// LinkLimit holds content from accounts younger than config.NewAccountAge
+// that carries more than config.NewAccountLinks links.
+type LinkLimit struct{}
+
+func (LinkLimit) Check(c *Content) (Action, string, error) {
+	if len(linkPattern.FindAllStringIndex(c.all(), -1)) <= config.NewAccountLinks {
+		return Allow, "", nil
+	}
+	var isNew bool
+	err := database.DB.QueryRow("SELECT COALESCE(created_at > ?, 0) FROM users WHERE id = ?",
+		utils.FormatTime(time.Now().Add(-config.NewAccountAge)), c.AuthorID).Scan(&isNew)
+	if err != nil || !isNew {
+		return Allow, "", err
+	}
+	return Hold, "Too many links for a new account", nil
+}
+
+// minRepeatLength keeps short replies such as "thanks" out of the repeat
+// check; people say those often.
+const minRepeatLength = 20
+
+type sighting struct {
+	hash [32]byte
+	at   time.Time
+}
+
+// RepeatFilter rejects the same text from the same author once they have
+// posted it config.RepeatLimit times within config.RepeatWindow, across
+// posts, comments and messages. What it has seen is kept in memory only,
+// and authors with nothing left in the window are forgotten.
+type RepeatFilter struct {
+	mutex sync.Mutex
+	seen  map[string][]sighting
+	swept time.Time
+}
+
+// sweep drops the authors whose sightings all fell out of the window. It
+// walks every author at most once per window, so the cost stays linear in
+// what was seen. The caller must hold mutex.
+func (f *RepeatFilter) sweep(now time.Time) {
+	if now.Sub(f.swept) < config.RepeatWindow {
+		return
+	}
+	f.swept = now
+	for author, sightings := range f.seen {
+		if now.Sub(sightings[len(sightings)-1].at) > config.RepeatWindow {
+			delete(f.seen, author)
+		}
+	}
+}
+
+func (f *RepeatFilter) Check(c *Content) (Action, string, error) {
+	normalized := strings.ToLower(strings.Join(strings.Fields(c.all()), " "))
+	if config.RepeatLimit <= 0 || len([]rune(normalized)) < minRepeatLength {
+		return Allow, "", nil
+	}
+	hash := sha256.Sum256([]byte(normalized))
+	now := time.Now()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.sweep(now)
+	// Forget what fell out of the window while counting the copies in it.
+	var recent []sighting
+	copies := 0
+	for _, s := range f.seen[c.AuthorID] {
+		if now.Sub(s.at) > config.RepeatWindow {
+			continue
+		}
+		recent = append(recent, s)
+		if s.hash == hash {
+			copies++
+		}
+	}
+	if copies >= config.RepeatLimit {
+		f.seen[c.AuthorID] = recent
+		return Reject, "You already posted this several times; please wait before posting it again", nil
+	}
+	f.seen[c.AuthorID] = append(recent, sighting{hash: hash, at: now})
+	return Allow, "", nil
+}
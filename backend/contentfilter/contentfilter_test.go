@@ -0,0 +1,110 @@
+package contentfilter
+
+import (
+	"real-time-forum/backend/config"
+	"testing"
+	"time"
+)
+
+// fixed is a filter that always decides the same and records that it ran.
+type fixed struct {
+	action Action
+	reason string
+	ran    *int
+}
+
+func (f fixed) Check(c *Content) (Action, string, error) {
+	*f.ran++
+	return f.action, f.reason, nil
+}
+
+func TestPipelineKeepsStrongest(t *testing.T) {
+	ran := 0
+	p := Pipeline{
+		fixed{Hold, "held", &ran},
+		fixed{Mask, "masked", &ran},
+		fixed{Allow, "", &ran},
+	}
+	v, err := p.Run(Content{Text: "text"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Action != Hold || v.Reason != "held" || ran != 3 {
+		t.Errorf("Run = %v %q after %d filters, want hold %q after 3", v.Action, v.Reason, ran, "held")
+	}
+}
+
+func TestPipelineStopsAtReject(t *testing.T) {
+	ran := 0
+	p := Pipeline{
+		fixed{Reject, "rejected", &ran},
+		fixed{Hold, "held", &ran},
+	}
+	v, err := p.Run(Content{Text: "text"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Action != Reject || v.Reason != "rejected" || ran != 1 {
+		t.Errorf("Run = %v %q after %d filters, want reject %q after 1", v.Action, v.Reason, ran, "rejected")
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	for _, a := range []Action{Allow, Mask, Hold, Reject} {
+		got, err := ParseAction(a.String())
+		if err != nil || got != a {
+			t.Errorf("ParseAction(%q) = %v, %v", a.String(), got, err)
+		}
+	}
+	if _, err := ParseAction("delete"); err == nil {
+		t.Error("ParseAction(\"delete\") succeeded")
+	}
+}
+
+func setRepeatConfig(t *testing.T, limit int, window time.Duration) {
+	oldLimit, oldWindow := config.RepeatLimit, config.RepeatWindow
+	config.RepeatLimit, config.RepeatWindow = limit, window
+	t.Cleanup(func() { config.RepeatLimit, config.RepeatWindow = oldLimit, oldWindow })
+}
+
+func TestRepeatFilterRejectsCopies(t *testing.T) {
+	setRepeatConfig(t, 2, time.Minute)
+	f := &RepeatFilter{seen: make(map[string][]sighting)}
+	text := "Buy cheap watches at my shop today"
+
+	for i, want := range []Action{Allow, Allow, Reject} {
+		// Case and spacing do not make a copy different.
+		c := Content{AuthorID: "a", Text: text}
+		if i == 1 {
+			c.Text = "  buy CHEAP watches   at my shop today "
+		}
+		if got, _, _ := f.Check(&c); got != want {
+			t.Errorf("copy %d: Check = %v, want %v", i+1, got, want)
+		}
+	}
+	if got, _, _ := f.Check(&Content{AuthorID: "b", Text: text}); got != Allow {
+		t.Errorf("other author: Check = %v, want allow", got)
+	}
+	if got, _, _ := f.Check(&Content{AuthorID: "a", Text: "thanks"}); got != Allow {
+		t.Errorf("short text: Check = %v, want allow", got)
+	}
+}
+
+func TestRepeatFilterForgetsExpiredAuthors(t *testing.T) {
+	setRepeatConfig(t, 2, time.Minute)
+	f := &RepeatFilter{seen: make(map[string][]sighting)}
+	old := time.Now().Add(-2 * time.Minute)
+	f.seen["gone"] = []sighting{{at: old}}
+	f.seen["stale"] = []sighting{{at: old}, {at: old}}
+
+	f.Check(&Content{AuthorID: "a", Text: "a message long enough to be counted"})
+	if _, ok := f.seen["gone"]; ok {
+		t.Error("author with only expired sightings was kept")
+	}
+	if _, ok := f.seen["stale"]; ok {
+		t.Error("author with only expired sightings was kept")
+	}
+	if len(f.seen["a"]) != 1 {
+		t.Errorf("current author has %d sightings, want 1", len(f.seen["a"]))
+	}
+}
@@ -0,0 +1,195 @@
+package contentfilter
+
+import (
+	"errors"
+	"real-time-forum/backend/database"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxPatternLength = 40
+
+// BannedWord is a pattern from the banned word list and what to do with
+// content that contains it.
+type BannedWord struct {
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"`
+}
+
+var (
+	wordsMutex  sync.Mutex
+	bannedWords []BannedWord
+	wordsLoaded bool
+)
+
+// CleanPattern lowercases a banned word pattern and checks that it is one
+// word of letters and digits, where * matches any run of them.
+func CleanPattern(pattern string) (string, error) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if strings.Trim(pattern, "*") == "" {
+		return "", errors.New("Pattern must contain a letter or digit")
+	}
+	if utf8.RuneCountInString(pattern) > maxPatternLength {
+		return "", errors.New("Pattern must be at most 40 characters")
+	}
+	for _, r := range pattern {
+		if r != '*' && !isWordRune(r) {
+			return "", errors.New("Pattern may only contain letters, digits and *")
+		}
+	}
+	return pattern, nil
+}
+
+// ReloadBannedWords makes the next check read the list again. Call it after
+// changing banned_words.
+func ReloadBannedWords() {
+	wordsMutex.Lock()
+	wordsLoaded = false
+	wordsMutex.Unlock()
+}
+
+func loadBannedWords() ([]BannedWord, error) {
+	wordsMutex.Lock()
+	defer wordsMutex.Unlock()
+	if wordsLoaded {
+		return bannedWords, nil
+	}
+	rows, err := database.DB.Query("SELECT pattern, action FROM banned_words")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var words []BannedWord
+	for rows.Next() {
+		var w BannedWord
+		if err := rows.Scan(&w.Pattern, &w.Action); err != nil {
+			return nil, err
+		}
+		words = append(words, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	bannedWords, wordsLoaded = words, true
+	return words, nil
+}
+
+// BannedWords checks every word of the content against the banned word
+// list. Words whose pattern says mask are replaced by asterisks; the others
+// hold or reject the whole content.
+type BannedWords struct{}
+
+func (BannedWords) Check(c *Content) (Action, string, error) {
+	words, err := loadBannedWords()
+	if err != nil || len(words) == 0 {
+		return Allow, "", err
+	}
+	actions := make([]Action, len(words))
+	for i, w := range words {
+		actions[i], _ = ParseAction(w.Action)
+	}
+
+	strongest, masking := Allow, false
+	scan := func(text string) {
+		eachWord(text, func(start, end int) {
+			word := strings.ToLower(text[start:end])
+			for i, w := range words {
+				if matchPattern(w.Pattern, word) {
+					strongest = max(strongest, actions[i])
+					masking = masking || actions[i] == Mask
+				}
+			}
+		})
+	}
+	scan(c.Title)
+	scan(c.Text)
+
+	// Only content with a word to mask is rewritten.
+	if masking {
+		mask := func(word string) string {
+			lower := strings.ToLower(word)
+			for i, w := range words {
+				if actions[i] == Mask && matchPattern(w.Pattern, lower) {
+					return strings.Repeat("*", utf8.RuneCountInString(word))
+				}
+			}
+			return word
+		}
+		c.Title = replaceWords(c.Title, mask)
+		c.Text = replaceWords(c.Text, mask)
+	}
+	if strongest >= Hold {
+		return strongest, "Contains a banned word", nil
+	}
+	return strongest, "", nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// eachWord calls fn with the bounds of each run of letters and digits in
+// text.
+func eachWord(text string, fn func(start, end int)) {
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			fn(start, i)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		fn(start, len(text))
+	}
+}
+
+// replaceWords calls replace for each run of letters and digits in text
+// and puts its result in the word's place.
+func replaceWords(text string, replace func(string) string) string {
+	var b strings.Builder
+	last := 0
+	eachWord(text, func(start, end int) {
+		b.WriteString(text[last:start])
+		b.WriteString(replace(text[start:end]))
+		last = end
+	})
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// matchPattern reports whether word matches pattern, where * matches any
+// run of characters, including none.
+func matchPattern(pattern, word string) bool {
+	p, w := []rune(pattern), []rune(word)
+	// star and retry remember the last * and where in word it was tried,
+	// so a mismatch can let that * swallow one more character.
+	star, retry := -1, 0
+	i, j := 0, 0
+	for j < len(w) {
+		switch {
+		case i < len(p) && p[i] == '*':
+			star, retry = i, j
+			i++
+		case i < len(p) && p[i] == w[j]:
+			i++
+			j++
+		case star >= 0:
+			retry++
+			i, j = star+1, retry
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
@@ -0,0 +1,108 @@
+package contentfilter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern, word string
+		want          bool
+	}{
+		{"spam", "spam", true},
+		{"spam", "spammer", false},
+		{"spam*", "spammer", true},
+		{"*spam", "antispam", true},
+		{"*spam*", "antispammer", true},
+		{"s*m", "sm", true},
+		{"s*m", "seem", true},
+		{"s*m", "seems", false},
+		{"*", "anything", true},
+		{"a*b*c", "aXbYbZc", true},
+		{"a*b*c", "aXcYb", false},
+		{"ünï*", "ünïcode", true},
+	}
+	for _, tt := range tests {
+		if got := matchPattern(tt.pattern, tt.word); got != tt.want {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", tt.pattern, tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestCleanPattern(t *testing.T) {
+	tests := []struct {
+		pattern, want string
+		ok            bool
+	}{
+		{"  Spam* ", "spam*", true},
+		{"***", "", false},
+		{"two words", "", false},
+		{"a.b", "", false},
+		{"abcdefghijabcdefghijabcdefghijabcdefghijx", "", false},
+	}
+	for _, tt := range tests {
+		got, err := CleanPattern(tt.pattern)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("CleanPattern(%q) = %q, %v; want %q, ok %v", tt.pattern, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+// setBannedWords makes loadBannedWords return words without a database.
+func setBannedWords(t *testing.T, words ...BannedWord) {
+	wordsMutex.Lock()
+	bannedWords, wordsLoaded = words, true
+	wordsMutex.Unlock()
+	t.Cleanup(ReloadBannedWords)
+}
+
+func TestBannedWords(t *testing.T) {
+	setBannedWords(t,
+		BannedWord{Pattern: "darn*", Action: "mask"},
+		BannedWord{Pattern: "scam", Action: "hold"},
+		BannedWord{Pattern: "slur", Action: "reject"},
+	)
+	tests := []struct {
+		name        string
+		in          Content
+		action      Action
+		title, text string
+	}{
+		{"clean", Content{Title: "Hello", Text: "Nothing here."}, Allow, "Hello", "Nothing here."},
+		{"mask", Content{Title: "Darn it", Text: "darned, DARN!"}, Mask, "**** it", "******, ****!"},
+		{"hold keeps masking", Content{Text: "darn scam"}, Hold, "", "**** scam"},
+		{"reject", Content{Text: "a slur here"}, Reject, "", "a slur here"},
+		{"word boundaries", Content{Text: "scammer"}, Allow, "", "scammer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.in
+			action, reason, err := BannedWords{}.Check(&c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action != tt.action || c.Title != tt.title || c.Text != tt.text {
+				t.Errorf("Check = %v, %q, %q; want %v, %q, %q", action, c.Title, c.Text, tt.action, tt.title, tt.text)
+			}
+			if (action >= Hold) != (reason != "") {
+				t.Errorf("Check gave reason %q for %v", reason, action)
+			}
+		})
+	}
+}
+
+func TestReplaceWords(t *testing.T) {
+	got := replaceWords("héllo, wörld 42!", func(word string) string { return "<" + word + ">" })
+	if want := "<héllo>, <wörld> <42>!"; got != want {
+		t.Errorf("replaceWords = %q, want %q", got, want)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	got := tokens("Visit https://example.com NOW now a " + "x123456789x123456789x123456789x")
+	want := []string{"<link>", "visit", "https", "example", "com", "now"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tokens = %q, want %q", got, want)
+	}
+}
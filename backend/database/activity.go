@@ -0,0 +1,81 @@
+package database
+
+import (
+	"database/sql"
+	"math"
+	"real-time-forum/backend/utils"
+	"time"
+)
+
+// The hot ranking adds a post's age to the log of its engagement, so every
+// hotDecay seconds (12.5 hours) a post needs ten times the engagement to
+// keep its place against newer ones. hotEpoch only keeps the numbers small.
+const (
+	hotEpoch = 1134028003
+	hotDecay = 45000
+)
+
+// DBTX is satisfied by both *sql.DB and *sql.Tx.
+type DBTX interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// HotScore ranks a post created at createdAt with the given engagement (net
+// likes plus comments). Scores only change when engagement does, so they can
+// be stored and indexed.
+func HotScore(createdAt time.Time, engagement int) float64 {
+	order := math.Log10(math.Max(math.Abs(float64(engagement)), 1))
+	sign := 0.0
+	if engagement > 0 {
+		sign = 1
+	} else if engagement < 0 {
+		sign = -1
+	}
+	return sign*order + float64(createdAt.Unix()-hotEpoch)/hotDecay
+}
+
+// RefreshPostActivity recomputes the comment count, last comment and hot
+// score stored on a post from its visible comments. Call it whenever a post
+// is created or one of its comments or reactions changes, including a
+// comment being hidden or unhidden.
+func RefreshPostActivity(db DBTX, postID string) error {
+	var createdAt string
+	var commentCount, netLikes int
+	err := db.QueryRow(`
+		SELECT CAST(p.created_at AS TEXT),
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL AND c.hidden_at IS NULL),
+			(SELECT COALESCE(SUM(CASE r.reaction WHEN 'like' THEN 1 WHEN 'dislike' THEN -1 ELSE 0 END), 0)
+				FROM reactions r WHERE r.target_type = 'post' AND r.target_id = p.id)
+		FROM posts p WHERE p.id = ?`, postID).Scan(&createdAt, &commentCount, &netLikes)
+	if err != nil {
+		return err
+	}
+
+	var lastCommentAt, lastCommenterID sql.NullString
+	err = db.QueryRow(`
+		SELECT CAST(created_at AS TEXT), user_id FROM comments
+		WHERE post_id = ? AND deleted_at IS NULL AND hidden_at IS NULL
+		ORDER BY created_at DESC LIMIT 1`, postID).Scan(&lastCommentAt, &lastCommenterID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	lastActivityAt := createdAt
+	if lastCommentAt.Valid {
+		lastActivityAt = lastCommentAt.String
+	}
+
+	created, err := time.Parse(utils.TimeLayout, createdAt)
+	if err != nil {
+		var ok bool
+		if created, ok = parseLegacyTime(createdAt); !ok {
+			return err
+		}
+	}
+
+	_, err = db.Exec(`
+		UPDATE posts SET comment_count = ?, last_comment_at = ?, last_commenter_id = ?, last_activity_at = ?, hot_score = ?
+		WHERE id = ?`,
+		commentCount, lastCommentAt, lastCommenterID, lastActivityAt, HotScore(created, netLikes+commentCount), postID)
+	return err
+}
@@ -15,11 +15,36 @@ func InitDatabase() {
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	initSchema()
+}
+
+// initSchema creates the tables a new database needs and migrates an
+// existing one to the current schema.
+func initSchema() {
+	createTables()
+	runMigrations()
+	createSearchTables()
+}
 
+func createTables() {
 	createUsersTable()
 	createPostsTable()
 	createCommentsTable()
 	createMessagesTable()
+	createConversationRetentionTable()
+	createCategoriesTables()
+	createRevisionsTable()
+	createReactionsTable()
+	createAttachmentsTable()
+	createBookmarksTable()
+	createNotificationTables()
+	createMentionsTable()
+	createTagsTables()
+	createPollTables()
+	createModerationLogTable()
+	createReportTables()
+	createFilterTables()
+	createDraftsTable()
 }
 
 func createUsersTable() {
@@ -32,7 +57,12 @@ func createUsersTable() {
 		first_name TEXT,
 		last_name TEXT,
 		age INTEGER,
-		gender TEXT
+		gender TEXT,
+		role TEXT NOT NULL DEFAULT 'user',
+		created_at DATETIME,
+		last_seen_at DATETIME,
+		anonymized_at DATETIME,
+		auto_subscribe INTEGER NOT NULL DEFAULT 1
 	);`
 	_, err := DB.Exec(createTableQuery)
 	if err != nil {
@@ -46,11 +76,27 @@ func createPostsTable() {
 	CREATE TABLE IF NOT EXISTS posts (
 		id TEXT PRIMARY KEY,
 		user_id TEXT NOT NULL,
+		title TEXT NOT NULL DEFAULT '',
+		slug TEXT NOT NULL DEFAULT '',
 		category TEXT NOT NULL,
+		category_names TEXT NOT NULL DEFAULT '',
 		content TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		content_html TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+		edited_at DATETIME,
+		deleted_at DATETIME,
+		deleted_by TEXT,
+		comment_count INTEGER NOT NULL DEFAULT 0,
+		last_comment_at DATETIME,
+		last_commenter_id TEXT,
+		last_activity_at DATETIME,
+		hot_score REAL NOT NULL DEFAULT 0,
+		pinned_at DATETIME,
+		locked_at DATETIME,
+		hidden_at DATETIME,
 		FOREIGN KEY(user_id) REFERENCES users(id)
-	);`
+	);
+	CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts(created_at DESC, id DESC);`
 	_, err := DB.Exec(createTableQuery)
 	if err != nil {
 		log.Fatalf("Failed to create posts table: %v", err)
@@ -65,10 +111,20 @@ func createCommentsTable() {
 		post_id TEXT NOT NULL,
 		user_id TEXT NOT NULL,
 		content TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		content_html TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+		edited_at DATETIME,
+		deleted_at DATETIME,
+		deleted_by TEXT,
+		parent_comment_id TEXT,
+		depth INTEGER NOT NULL DEFAULT 0,
+		path TEXT NOT NULL DEFAULT '',
+		hidden_at DATETIME,
 		FOREIGN KEY(post_id) REFERENCES posts(id),
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);`
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(parent_comment_id) REFERENCES comments(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(post_id, created_at);`
 	_, err := DB.Exec(createTableQuery)
 	if err != nil {
 		log.Fatalf("Failed to create comments table: %v", err)
@@ -83,8 +139,9 @@ func createMessagesTable() {
 		sender_id TEXT NOT NULL,
 		receiver_id TEXT NOT NULL,
 		content TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		created_at DATETIME DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
 		sequence INTEGER DEFAULT 0,
+		hidden_at DATETIME,
 		FOREIGN KEY(sender_id) REFERENCES users(id),
 		FOREIGN KEY(receiver_id) REFERENCES users(id)
 	);`
@@ -94,3 +151,407 @@ func createMessagesTable() {
 	}
 	//log.Println("Messages table created successfully (if it didn't exist).") - for debugging purposes
 }
+
+func createConversationRetentionTable() {
+	// user_a is always the smaller of the two user IDs so each conversation has one row.
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS conversation_retention (
+		user_a TEXT NOT NULL,
+		user_b TEXT NOT NULL,
+		days INTEGER NOT NULL,
+		updated_by TEXT NOT NULL,
+		updated_at DATETIME NOT NULL,
+		PRIMARY KEY (user_a, user_b),
+		FOREIGN KEY(user_a) REFERENCES users(id),
+		FOREIGN KEY(user_b) REFERENCES users(id)
+	);`
+	_, err := DB.Exec(createTableQuery)
+	if err != nil {
+		log.Fatalf("Failed to create conversation_retention table: %v", err)
+	}
+}
+
+// SeedAdmins gives the admin role to the users with the given nicknames.
+func SeedAdmins(nicknames []string) {
+	for _, nickname := range nicknames {
+		res, err := DB.Exec("UPDATE users SET role = 'admin' WHERE LOWER(nickname) = LOWER(?)", nickname)
+		if err != nil {
+			log.Fatalf("Failed to grant admin role to %s: %v", nickname, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			log.Printf("Cannot grant admin role to %s: no such user", nickname)
+		}
+	}
+}
+
+func createCategoriesTables() {
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS categories (
+		id TEXT PRIMARY KEY,
+		name TEXT UNIQUE NOT NULL COLLATE NOCASE,
+		description TEXT NOT NULL DEFAULT '',
+		color TEXT NOT NULL DEFAULT '#888888',
+		sort_order INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS post_categories (
+		post_id TEXT NOT NULL,
+		category_id TEXT NOT NULL,
+		PRIMARY KEY (post_id, category_id),
+		FOREIGN KEY(post_id) REFERENCES posts(id),
+		FOREIGN KEY(category_id) REFERENCES categories(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_post_categories_category ON post_categories(category_id);`
+	_, err := DB.Exec(createTableQuery)
+	if err != nil {
+		log.Fatalf("Failed to create categories tables: %v", err)
+	}
+}
+
+func createRevisionsTable() {
+	// Each row is a version of a post or comment as it was before an edit
+	// or deletion. title is only used for posts.
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS revisions (
+		id TEXT PRIMARY KEY,
+		target_type TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		action TEXT NOT NULL,
+		title TEXT NOT NULL DEFAULT '',
+		content TEXT NOT NULL,
+		editor_id TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY(editor_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_revisions_target ON revisions(target_type, target_id, created_at);`
+	_, err := DB.Exec(createTableQuery)
+	if err != nil {
+		log.Fatalf("Failed to create revisions table: %v", err)
+	}
+}
+
+func createReactionsTable() {
+	// target_type is "post" or "comment". A user holds each reaction on a
+	// target at most once.
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS reactions (
+		target_type TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		reaction TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY(target_type, target_id, user_id, reaction),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);`
+	_, err := DB.Exec(createTableQuery)
+	if err != nil {
+		log.Fatalf("Failed to create reactions table: %v", err)
+	}
+}
+
+func createAttachmentsTable() {
+	// Uploads start out unattached; target_type ("post" or "comment") and
+	// target_id are set when the post or comment using them is created.
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS attachments (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		target_type TEXT,
+		target_id TEXT,
+		filename TEXT NOT NULL DEFAULT '',
+		content_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		width INTEGER NOT NULL,
+		height INTEGER NOT NULL,
+		blob_key TEXT NOT NULL,
+		thumbnail_key TEXT NOT NULL,
+		thumbnail_type TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_attachments_target ON attachments(target_type, target_id);`
+	_, err := DB.Exec(createTableQuery)
+	if err != nil {
+		log.Fatalf("Failed to create attachments table: %v", err)
+	}
+}
+
+func createBookmarksTable() {
+	// folder is an optional label only its owner sees; '' means unfiled.
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS bookmarks (
+		user_id TEXT NOT NULL,
+		post_id TEXT NOT NULL,
+		folder TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY(user_id, post_id),
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(post_id) REFERENCES posts(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_bookmarks_user ON bookmarks(user_id, created_at DESC, post_id DESC);`
+	_, err := DB.Exec(createTableQuery)
+	if err != nil {
+		log.Fatalf("Failed to create bookmarks table: %v", err)
+	}
+}
+
+func createNotificationTables() {
+	// subscribed is 0 when the user unfollowed the post, so commenting on
+	// it again does not subscribe them back. Notification types without a
+	// preference row are enabled.
+	createTablesQuery := `
+	CREATE TABLE IF NOT EXISTS post_subscriptions (
+		user_id TEXT NOT NULL,
+		post_id TEXT NOT NULL,
+		subscribed INTEGER NOT NULL DEFAULT 1,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY(user_id, post_id),
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(post_id) REFERENCES posts(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_post_subscriptions_post ON post_subscriptions(post_id, subscribed);
+
+	CREATE TABLE IF NOT EXISTS notifications (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		type TEXT NOT NULL,
+		post_id TEXT,
+		comment_id TEXT,
+		actor_id TEXT,
+		report_id TEXT,
+		message_id TEXT,
+		detail TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		read_at DATETIME,
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(post_id) REFERENCES posts(id),
+		FOREIGN KEY(comment_id) REFERENCES comments(id),
+		FOREIGN KEY(actor_id) REFERENCES users(id),
+		FOREIGN KEY(report_id) REFERENCES report_cases(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at DESC, id DESC);
+
+	CREATE TABLE IF NOT EXISTS notification_preferences (
+		user_id TEXT NOT NULL,
+		type TEXT NOT NULL,
+		enabled INTEGER NOT NULL,
+		PRIMARY KEY(user_id, type),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);`
+	_, err := DB.Exec(createTablesQuery)
+	if err != nil {
+		log.Fatalf("Failed to create notification tables: %v", err)
+	}
+}
+
+func createMentionsTable() {
+	// Offsets are in UTF-16 code units into the markdown source of the post,
+	// comment or message, not into its rendered HTML.
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS mentions (
+		target_type TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		start_offset INTEGER NOT NULL,
+		end_offset INTEGER NOT NULL,
+		PRIMARY KEY(target_type, target_id, start_offset),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_mentions_user ON mentions(user_id);`
+	_, err := DB.Exec(createTableQuery)
+	if err != nil {
+		log.Fatalf("Failed to create mentions table: %v", err)
+	}
+}
+
+func createTagsTables() {
+	// A merged tag keeps its row so posts naming it later get the tag it
+	// was merged into. Banned tags are hidden and cannot be used.
+	createTablesQuery := `
+	CREATE TABLE IF NOT EXISTS tags (
+		id TEXT PRIMARY KEY,
+		name TEXT UNIQUE NOT NULL,
+		banned INTEGER NOT NULL DEFAULT 0,
+		merged_into TEXT REFERENCES tags(id),
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS post_tags (
+		post_id TEXT NOT NULL,
+		tag_id TEXT NOT NULL,
+		PRIMARY KEY(post_id, tag_id),
+		FOREIGN KEY(post_id) REFERENCES posts(id),
+		FOREIGN KEY(tag_id) REFERENCES tags(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_post_tags_tag ON post_tags(tag_id, post_id);`
+	_, err := DB.Exec(createTablesQuery)
+	if err != nil {
+		log.Fatalf("Failed to create tags tables: %v", err)
+	}
+}
+
+func createPollTables() {
+	// A post has at most one poll. Votes on anonymous polls are still stored
+	// per user so each user votes once, but voters are never returned.
+	createTablesQuery := `
+	CREATE TABLE IF NOT EXISTS polls (
+		id TEXT PRIMARY KEY,
+		post_id TEXT UNIQUE NOT NULL,
+		question TEXT NOT NULL,
+		multiple INTEGER NOT NULL DEFAULT 0,
+		anonymous INTEGER NOT NULL DEFAULT 0,
+		closes_at DATETIME,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY(post_id) REFERENCES posts(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS poll_options (
+		id TEXT PRIMARY KEY,
+		poll_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		text TEXT NOT NULL,
+		FOREIGN KEY(poll_id) REFERENCES polls(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_poll_options_poll ON poll_options(poll_id, position);
+
+	CREATE TABLE IF NOT EXISTS poll_votes (
+		poll_id TEXT NOT NULL,
+		option_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY(option_id, user_id),
+		FOREIGN KEY(poll_id) REFERENCES polls(id),
+		FOREIGN KEY(option_id) REFERENCES poll_options(id),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_poll_votes_user ON poll_votes(poll_id, user_id);`
+	_, err := DB.Exec(createTablesQuery)
+	if err != nil {
+		log.Fatalf("Failed to create poll tables: %v", err)
+	}
+}
+
+func createModerationLogTable() {
+	// Every pin, lock, move, edit and delete a moderator makes, and every
+	// report case they resolve. post_id is the post acted on, or the post of
+	// the comment acted on; actions on messages and users have none.
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS moderation_log (
+		id TEXT PRIMARY KEY,
+		moderator_id TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target_type TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		post_id TEXT,
+		detail TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY(moderator_id) REFERENCES users(id),
+		FOREIGN KEY(post_id) REFERENCES posts(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_moderation_log_created ON moderation_log(created_at DESC, id DESC);`
+	_, err := DB.Exec(createTableQuery)
+	if err != nil {
+		log.Fatalf("Failed to create moderation log table: %v", err)
+	}
+}
+
+func createReportTables() {
+	// Reports about the same target are grouped into one case until staff
+	// resolve it; reporting it again later opens a new case. author_id is
+	// whoever wrote the target, or the reported user.
+	createTablesQuery := `
+	CREATE TABLE IF NOT EXISTS report_cases (
+		id TEXT PRIMARY KEY,
+		target_type TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		author_id TEXT NOT NULL,
+		post_id TEXT,
+		status TEXT NOT NULL DEFAULT 'open',
+		claimed_by TEXT,
+		claimed_at DATETIME,
+		resolved_by TEXT,
+		resolved_at DATETIME,
+		action TEXT NOT NULL DEFAULT '',
+		resolution_note TEXT NOT NULL DEFAULT '',
+		filter_reason TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY(author_id) REFERENCES users(id),
+		FOREIGN KEY(post_id) REFERENCES posts(id),
+		FOREIGN KEY(claimed_by) REFERENCES users(id),
+		FOREIGN KEY(resolved_by) REFERENCES users(id)
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_report_cases_target ON report_cases(target_type, target_id) WHERE status != 'resolved';
+	CREATE INDEX IF NOT EXISTS idx_report_cases_status ON report_cases(status, created_at DESC, id DESC);
+
+	CREATE TABLE IF NOT EXISTS reports (
+		id TEXT PRIMARY KEY,
+		case_id TEXT NOT NULL,
+		reporter_id TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		UNIQUE(case_id, reporter_id),
+		FOREIGN KEY(case_id) REFERENCES report_cases(id),
+		FOREIGN KEY(reporter_id) REFERENCES users(id)
+	);`
+	_, err := DB.Exec(createTablesQuery)
+	if err != nil {
+		log.Fatalf("Failed to create report tables: %v", err)
+	}
+}
+
+func createFilterTables() {
+	// banned_words patterns are single lowercase words where * matches any
+	// run of letters and digits. spam_tokens counts how many spam and
+	// non-spam documents each word appeared in, and spam_classes how many
+	// documents of each kind the classifier has learned from.
+	createTablesQuery := `
+	CREATE TABLE IF NOT EXISTS banned_words (
+		pattern TEXT PRIMARY KEY,
+		action TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS spam_tokens (
+		token TEXT PRIMARY KEY,
+		spam INTEGER NOT NULL DEFAULT 0,
+		ham INTEGER NOT NULL DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS spam_classes (
+		class TEXT PRIMARY KEY,
+		documents INTEGER NOT NULL DEFAULT 0
+	);`
+	_, err := DB.Exec(createTablesQuery)
+	if err != nil {
+		log.Fatalf("Failed to create filter tables: %v", err)
+	}
+}
+
+func createDraftsTable() {
+	// context is "post" for a new post, "comment:{post id}" for a comment on
+	// a post or "reply:{comment id}" for a reply; each user has at most one
+	// draft per context. post_id and parent_comment_id repeat what the
+	// context points at so drafts can be dropped with their post or comment.
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS drafts (
+		user_id TEXT NOT NULL,
+		context TEXT NOT NULL,
+		post_id TEXT,
+		parent_comment_id TEXT,
+		title TEXT NOT NULL DEFAULT '',
+		content TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		PRIMARY KEY(user_id, context),
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(post_id) REFERENCES posts(id),
+		FOREIGN KEY(parent_comment_id) REFERENCES comments(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_drafts_user ON drafts(user_id, updated_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_drafts_post ON drafts(post_id);`
+	_, err := DB.Exec(createTableQuery)
+	if err != nil {
+		log.Fatalf("Failed to create drafts table: %v", err)
+	}
+}
@@ -0,0 +1,605 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"real-time-forum/backend/markdown"
+	"real-time-forum/backend/utils"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// migrations run once each, in order, after the tables have been created.
+// Append new entries to the end; never rename or reorder existing ones.
+var migrations = []struct {
+	name    string
+	migrate func(tx *sql.Tx) error
+}{
+	{"utc_timestamps", migrateUTCTimestamps},
+	{"user_roles_and_activity", migrateUserRolesAndActivity},
+	{"post_titles", migratePostTitles},
+	{"managed_categories", migrateManagedCategories},
+	{"edit_and_delete", migrateEditAndDelete},
+	{"comment_threads", migrateCommentThreads},
+	{"post_activity", migratePostActivity},
+	{"post_subscriptions", migratePostSubscriptions},
+	{"notification_details", migrateNotificationDetails},
+	{"post_pin_and_lock", migratePostPinAndLock},
+	{"content_reports", migrateContentReports},
+	{"content_filters", migrateContentFilters},
+	{"search_update_triggers", migrateSearchUpdateTriggers},
+	{"visible_comment_counts", migrateVisibleCommentCounts},
+	{"stored_content_html", migrateStoredContentHTML},
+	{"message_mentions", migrateMessageMentions},
+	{"search_post_categories", migrateSearchPostCategories},
+	{"moderation_log_without_post", migrateModerationLogWithoutPost},
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func createMigrationsTable() {
+	createTableQuery := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		name TEXT PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	);`
+	_, err := DB.Exec(createTableQuery)
+	if err != nil {
+		log.Fatalf("Failed to create schema_migrations table: %v", err)
+	}
+}
+
+func runMigrations() {
+	createMigrationsTable()
+
+	for _, m := range migrations {
+		var applied int
+		err := DB.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE name = ?", m.name).Scan(&applied)
+		if err != nil {
+			log.Fatalf("Failed to check migration %s: %v", m.name, err)
+		}
+		if applied > 0 {
+			continue
+		}
+
+		tx, err := DB.Begin()
+		if err != nil {
+			log.Fatalf("Failed to start migration %s: %v", m.name, err)
+		}
+		if err := m.migrate(tx); err != nil {
+			tx.Rollback()
+			log.Fatalf("Failed to run migration %s: %v", m.name, err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (name, applied_at) VALUES (?, ?)", m.name, utils.Now()); err != nil {
+			tx.Rollback()
+			log.Fatalf("Failed to record migration %s: %v", m.name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			log.Fatalf("Failed to commit migration %s: %v", m.name, err)
+		}
+		log.Printf("Applied migration %s", m.name)
+	}
+}
+
+// addColumn adds column to table unless a previous CREATE TABLE already has it.
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
+
+// legacyTimeLayouts are the formats timestamps were stored in before
+// utils.TimeLayout: SQLite's CURRENT_TIMESTAMP (UTC, no zone) and the
+// local-time RFC3339Nano strings written by the chat handler.
+var legacyTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+}
+
+func parseLegacyTime(value string) (time.Time, bool) {
+	for _, layout := range legacyTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// migrateUTCTimestamps rewrites every created_at value in utils.TimeLayout.
+func migrateUTCTimestamps(tx *sql.Tx) error {
+	for _, table := range []string{"posts", "comments", "messages"} {
+		// CAST keeps the driver from parsing the DATETIME column itself.
+		rows, err := tx.Query("SELECT rowid, CAST(created_at AS TEXT) FROM " + table + " WHERE created_at IS NOT NULL")
+		if err != nil {
+			return err
+		}
+
+		updates := make(map[int64]string)
+		for rows.Next() {
+			var rowID int64
+			var createdAt string
+			if err := rows.Scan(&rowID, &createdAt); err != nil {
+				rows.Close()
+				return err
+			}
+			t, ok := parseLegacyTime(createdAt)
+			if !ok {
+				log.Printf("Leaving unparseable timestamp %q in %s row %d", createdAt, table, rowID)
+				continue
+			}
+			if canonical := utils.FormatTime(t); canonical != createdAt {
+				updates[rowID] = canonical
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for rowID, createdAt := range updates {
+			if _, err := tx.Exec("UPDATE "+table+" SET created_at = ? WHERE rowid = ?", createdAt, rowID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrateUserRolesAndActivity adds roles and activity tracking to users.
+// Existing accounts count as created and seen now, so retention policies
+// only start counting from the upgrade.
+func migrateUserRolesAndActivity(tx *sql.Tx) error {
+	columns := []struct{ name, definition string }{
+		{"role", "TEXT NOT NULL DEFAULT 'user'"},
+		{"created_at", "DATETIME"},
+		{"last_seen_at", "DATETIME"},
+		{"anonymized_at", "DATETIME"},
+	}
+	for _, c := range columns {
+		if err := addColumn(tx, "users", c.name, c.definition); err != nil {
+			return err
+		}
+	}
+	now := utils.Now()
+	_, err := tx.Exec("UPDATE users SET created_at = ?, last_seen_at = ? WHERE created_at IS NULL", now, now)
+	return err
+}
+
+const legacyTitleLength = 60
+
+// migratePostTitles adds title and slug to posts. Existing posts get a
+// title from the first line of their content. The posts search index is
+// dropped so it is rebuilt with the title column.
+func migratePostTitles(tx *sql.Tx) error {
+	if err := addColumn(tx, "posts", "title", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumn(tx, "posts", "slug", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := dropSearchIndexStatements(tx, "posts_fts"); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id, content FROM posts WHERE title = ''")
+	if err != nil {
+		return err
+	}
+	titles := make(map[string]string)
+	for rows.Next() {
+		var id, content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return err
+		}
+		title, _, _ := strings.Cut(strings.TrimSpace(content), "\n")
+		title = strings.TrimSpace(title)
+		if runes := []rune(title); len(runes) > legacyTitleLength {
+			title = string(runes[:legacyTitleLength]) + "…"
+		}
+		if title == "" {
+			title = "Untitled"
+		}
+		titles[id] = title
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, title := range titles {
+		if _, err := tx.Exec("UPDATE posts SET title = ?, slug = ? WHERE id = ?", title, utils.Slugify(title), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateManagedCategories turns the free-text category of every existing
+// post into a row in categories (names compared case-insensitively) and
+// links the post to it.
+func migrateManagedCategories(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, TRIM(category) FROM posts")
+	if err != nil {
+		return err
+	}
+	postCategories := make(map[string]string)
+	for rows.Next() {
+		var postID, category string
+		if err := rows.Scan(&postID, &category); err != nil {
+			rows.Close()
+			return err
+		}
+		if category != "" {
+			postCategories[postID] = category
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := utils.Now()
+	for postID, category := range postCategories {
+		var categoryID string
+		err := tx.QueryRow("SELECT id FROM categories WHERE name = ?", category).Scan(&categoryID)
+		if err == sql.ErrNoRows {
+			categoryID = uuid.Must(uuid.NewV4()).String()
+			_, err = tx.Exec("INSERT INTO categories (id, name, created_at) VALUES (?, ?, ?)", categoryID, category, now)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT OR IGNORE INTO post_categories (post_id, category_id) VALUES (?, ?)", postID, categoryID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateEditAndDelete adds edit and soft-delete tracking to posts and comments.
+func migrateEditAndDelete(tx *sql.Tx) error {
+	for _, table := range []string{"posts", "comments"} {
+		for _, column := range []string{"edited_at", "deleted_at", "deleted_by"} {
+			definition := "DATETIME"
+			if column == "deleted_by" {
+				definition = "TEXT"
+			}
+			if err := addColumn(tx, table, column, definition); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrateCommentThreads adds reply threading to comments. Existing comments
+// become top-level ones whose path is their own sort key.
+func migrateCommentThreads(tx *sql.Tx) error {
+	columns := []struct{ name, definition string }{
+		{"parent_comment_id", "TEXT REFERENCES comments(id)"},
+		{"depth", "INTEGER NOT NULL DEFAULT 0"},
+		{"path", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, c := range columns {
+		if err := addColumn(tx, "comments", c.name, c.definition); err != nil {
+			return err
+		}
+	}
+	for _, stmt := range []string{
+		`UPDATE comments SET path = CAST(created_at AS TEXT) || id WHERE path = ''`,
+		`CREATE INDEX IF NOT EXISTS idx_comments_parent ON comments(parent_comment_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_comments_path ON comments(post_id, path)`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratePostActivity adds the stored activity columns used to sort the feed
+// and fills them in for every existing post.
+func migratePostActivity(tx *sql.Tx) error {
+	columns := []struct{ name, definition string }{
+		{"comment_count", "INTEGER NOT NULL DEFAULT 0"},
+		{"last_comment_at", "DATETIME"},
+		{"last_commenter_id", "TEXT"},
+		{"last_activity_at", "DATETIME"},
+		{"hot_score", "REAL NOT NULL DEFAULT 0"},
+	}
+	for _, c := range columns {
+		if err := addColumn(tx, "posts", c.name, c.definition); err != nil {
+			return err
+		}
+	}
+	// RefreshPostActivity leaves out hidden comments, so the column that
+	// migrateContentReports adds later has to exist already.
+	if err := addColumn(tx, "comments", "hidden_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id FROM posts")
+	if err != nil {
+		return err
+	}
+	var postIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		postIDs = append(postIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range postIDs {
+		if err := RefreshPostActivity(tx, id); err != nil {
+			return err
+		}
+	}
+
+	for _, stmt := range []string{
+		`CREATE INDEX IF NOT EXISTS idx_posts_last_activity ON posts(last_activity_at DESC, id DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_posts_comment_count ON posts(comment_count DESC, id DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_posts_hot_score ON posts(hot_score DESC, id DESC)`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratePostSubscriptions adds the auto-subscribe preference and follows
+// every existing post for its author and everyone who commented on it.
+func migratePostSubscriptions(tx *sql.Tx) error {
+	if err := addColumn(tx, "users", "auto_subscribe", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	now := utils.Now()
+	_, err := tx.Exec(`
+		INSERT OR IGNORE INTO post_subscriptions (user_id, post_id, created_at)
+		SELECT user_id, id, ? FROM posts WHERE deleted_at IS NULL
+		UNION
+		SELECT comments.user_id, comments.post_id, ? FROM comments
+		JOIN posts ON posts.id = comments.post_id
+		WHERE comments.deleted_at IS NULL AND posts.deleted_at IS NULL`, now, now)
+	return err
+}
+
+// migrateNotificationDetails adds the detail column, which says what kind of
+// reaction or moderation action a notification is about.
+func migrateNotificationDetails(tx *sql.Tx) error {
+	return addColumn(tx, "notifications", "detail", "TEXT NOT NULL DEFAULT ''")
+}
+
+// migratePostPinAndLock adds the columns moderators set to pin a post to the
+// top of the feed and to lock it against new comments.
+func migratePostPinAndLock(tx *sql.Tx) error {
+	if err := addColumn(tx, "posts", "pinned_at", "DATETIME"); err != nil {
+		return err
+	}
+	return addColumn(tx, "posts", "locked_at", "DATETIME")
+}
+
+// migrateContentReports adds the columns that hide reported content, and
+// rebuilds notifications so they can point at a report instead of a post:
+// reports about messages and users have no post.
+func migrateContentReports(tx *sql.Tx) error {
+	for _, table := range []string{"posts", "comments", "messages"} {
+		if err := addColumn(tx, table, "hidden_at", "DATETIME"); err != nil {
+			return err
+		}
+	}
+
+	var postRequired bool
+	err := tx.QueryRow(`SELECT "notnull" FROM pragma_table_info('notifications') WHERE name = 'post_id'`).Scan(&postRequired)
+	if err != nil || !postRequired {
+		return err
+	}
+	_, err = tx.Exec(`
+		CREATE TABLE notifications_rebuilt (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			type TEXT NOT NULL,
+			post_id TEXT,
+			comment_id TEXT,
+			actor_id TEXT,
+			report_id TEXT,
+			detail TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			read_at DATETIME,
+			FOREIGN KEY(user_id) REFERENCES users(id),
+			FOREIGN KEY(post_id) REFERENCES posts(id),
+			FOREIGN KEY(comment_id) REFERENCES comments(id),
+			FOREIGN KEY(actor_id) REFERENCES users(id),
+			FOREIGN KEY(report_id) REFERENCES report_cases(id)
+		);
+		INSERT INTO notifications_rebuilt (id, user_id, type, post_id, comment_id, actor_id, detail, created_at, read_at)
+		SELECT id, user_id, type, post_id, comment_id, actor_id, detail, created_at, read_at FROM notifications;
+		DROP TABLE notifications;
+		ALTER TABLE notifications_rebuilt RENAME TO notifications;
+		CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at DESC, id DESC);`)
+	return err
+}
+
+// migrateContentFilters records why the content filters held a post,
+// comment or message on its report case.
+func migrateContentFilters(tx *sql.Tx) error {
+	return addColumn(tx, "report_cases", "filter_reason", "TEXT NOT NULL DEFAULT ''")
+}
+
+// migrateSearchUpdateTriggers drops the search update triggers that fired on
+// every update, such as a post's comment count changing, so
+// createSearchTables recreates them limited to the indexed columns.
+func migrateSearchUpdateTriggers(tx *sql.Tx) error {
+	for _, table := range []string{"posts_fts", "comments_fts", "messages_fts"} {
+		if _, err := tx.Exec("DROP TRIGGER IF EXISTS " + table + "_au"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateVisibleCommentCounts recomputes the activity of posts with hidden
+// comments, which used to be counted.
+func migrateVisibleCommentCounts(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT DISTINCT post_id FROM comments WHERE hidden_at IS NOT NULL")
+	if err != nil {
+		return err
+	}
+	var postIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		postIDs = append(postIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range postIDs {
+		if err := RefreshPostActivity(tx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateStoredContentHTML keeps the rendered HTML of posts and comments
+// next to their markdown, rendering what is already there, so reads no
+// longer render it every time.
+func migrateStoredContentHTML(tx *sql.Tx) error {
+	for _, table := range []string{"posts", "comments"} {
+		if err := addColumn(tx, table, "content_html", "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+		rows, err := tx.Query("SELECT id, content FROM " + table)
+		if err != nil {
+			return err
+		}
+		rendered := map[string]string{}
+		for rows.Next() {
+			var id, content string
+			if err := rows.Scan(&id, &content); err != nil {
+				rows.Close()
+				return err
+			}
+			rendered[id] = markdown.Render(content)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for id, html := range rendered {
+			if _, err := tx.Exec("UPDATE "+table+" SET content_html = ? WHERE id = ?", html, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrateMessageMentions lets a mention notification point at the direct
+// message it was made in.
+func migrateMessageMentions(tx *sql.Tx) error {
+	return addColumn(tx, "notifications", "message_id", "TEXT")
+}
+
+// postCategoryNames is the space-separated names of a post's categories,
+// kept in posts.category_names so the search index covers all of them.
+const postCategoryNames = `COALESCE((
+	SELECT GROUP_CONCAT(categories.name, ' ') FROM post_categories
+	JOIN categories ON categories.id = post_categories.category_id
+	WHERE post_categories.post_id = posts.id), '')`
+
+// migrateSearchPostCategories indexes every category of a post instead of
+// only the main one. Triggers keep posts.category_names in step with
+// post_categories and category renames, and posts_fts is dropped so
+// createSearchTables rebuilds it over the new column.
+func migrateSearchPostCategories(tx *sql.Tx) error {
+	if err := addColumn(tx, "posts", "category_names", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := dropSearchIndexStatements(tx, "posts_fts"); err != nil {
+		return err
+	}
+	for _, stmt := range []string{
+		`CREATE TRIGGER IF NOT EXISTS post_categories_ai AFTER INSERT ON post_categories BEGIN
+			UPDATE posts SET category_names = ` + postCategoryNames + ` WHERE id = new.post_id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS post_categories_ad AFTER DELETE ON post_categories BEGIN
+			UPDATE posts SET category_names = ` + postCategoryNames + ` WHERE id = old.post_id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS categories_au AFTER UPDATE OF name ON categories BEGIN
+			UPDATE posts SET category_names = ` + postCategoryNames + `
+			WHERE id IN (SELECT post_id FROM post_categories WHERE category_id = new.id);
+		END`,
+		`UPDATE posts SET category_names = ` + postCategoryNames,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateModerationLogWithoutPost rebuilds moderation_log so entries can
+// have no post: resolving reports about messages and users is logged too.
+func migrateModerationLogWithoutPost(tx *sql.Tx) error {
+	var postRequired bool
+	err := tx.QueryRow(`SELECT "notnull" FROM pragma_table_info('moderation_log') WHERE name = 'post_id'`).Scan(&postRequired)
+	if err != nil || !postRequired {
+		return err
+	}
+	_, err = tx.Exec(`
+		CREATE TABLE moderation_log_rebuilt (
+			id TEXT PRIMARY KEY,
+			moderator_id TEXT NOT NULL,
+			action TEXT NOT NULL,
+			target_type TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			post_id TEXT,
+			detail TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			FOREIGN KEY(moderator_id) REFERENCES users(id),
+			FOREIGN KEY(post_id) REFERENCES posts(id)
+		);
+		INSERT INTO moderation_log_rebuilt (id, moderator_id, action, target_type, target_id, post_id, detail, created_at)
+		SELECT id, moderator_id, action, target_type, target_id, post_id, detail, created_at FROM moderation_log;
+		DROP TABLE moderation_log;
+		ALTER TABLE moderation_log_rebuilt RENAME TO moderation_log;
+		CREATE INDEX IF NOT EXISTS idx_moderation_log_created ON moderation_log(created_at DESC, id DESC);`)
+	return err
+}
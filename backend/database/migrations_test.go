@@ -0,0 +1,245 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openTestDB points DB at a fresh database file for the length of the test.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := DB
+	DB = db
+	t.Cleanup(func() {
+		db.Close()
+		DB = old
+	})
+}
+
+// legacySchema is the schema databases had before migrations were added.
+const legacySchema = `
+CREATE TABLE users (
+	id TEXT PRIMARY KEY, nickname TEXT UNIQUE NOT NULL, email TEXT UNIQUE NOT NULL,
+	password TEXT NOT NULL, first_name TEXT, last_name TEXT, age INTEGER, gender TEXT
+);
+CREATE TABLE posts (
+	id TEXT PRIMARY KEY, user_id TEXT NOT NULL, category TEXT NOT NULL,
+	content TEXT NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE comments (
+	id TEXT PRIMARY KEY, post_id TEXT NOT NULL, user_id TEXT NOT NULL,
+	content TEXT NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE messages (
+	id TEXT PRIMARY KEY, sender_id TEXT NOT NULL, receiver_id TEXT NOT NULL,
+	content TEXT NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, sequence INTEGER DEFAULT 0
+);
+INSERT INTO users (id, nickname, email, password) VALUES ('u1', 'alice', 'a@example.com', 'x'), ('u2', 'bob', 'b@example.com', 'x');
+INSERT INTO posts (id, user_id, category, content, created_at) VALUES
+	('p1', 'u1', ' Go ', 'First line
+**rest**', '2024-03-01 10:00:00'),
+	('p2', 'u2', 'go', '', '2024-03-02 11:00:00');
+INSERT INTO comments (id, post_id, user_id, content, created_at) VALUES
+	('c1', 'p1', 'u2', 'a reply', '2024-03-01 12:30:00'),
+	('c2', 'p1', 'u1', 'another', '2024-03-01 13:00:00');
+INSERT INTO messages (id, sender_id, receiver_id, content, created_at) VALUES
+	('m1', 'u1', 'u2', 'hi', '2024-03-01T14:00:00.5+02:00');
+`
+
+func appliedMigrations(t *testing.T) int {
+	t.Helper()
+	var n int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestMigrationsOnNewDatabase(t *testing.T) {
+	openTestDB(t)
+	initSchema()
+	if n := appliedMigrations(t); n != len(migrations) {
+		t.Fatalf("%d migrations recorded, want %d", n, len(migrations))
+	}
+
+	// A restart finds everything applied and changes nothing.
+	initSchema()
+	if n := appliedMigrations(t); n != len(migrations) {
+		t.Errorf("%d migrations recorded after a second run, want %d", n, len(migrations))
+	}
+}
+
+// schemaColumns lists table.column for every column in the database.
+func schemaColumns(t *testing.T) map[string]bool {
+	t.Helper()
+	rows, err := DB.Query(`
+		SELECT m.name || '.' || c.name FROM sqlite_master m, pragma_table_info(m.name) c
+		WHERE m.type = 'table'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			t.Fatal(err)
+		}
+		columns[column] = true
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return columns
+}
+
+func TestCreateTablesHaveMigratedColumns(t *testing.T) {
+	openTestDB(t)
+	createTables()
+	created := schemaColumns(t)
+	runMigrations()
+	for column := range schemaColumns(t) {
+		if !created[column] && !strings.HasPrefix(column, "schema_migrations.") {
+			t.Errorf("%s is only added by a migration, not by CREATE TABLE", column)
+		}
+	}
+}
+
+func TestMigrationsUpgradeLegacyDatabase(t *testing.T) {
+	openTestDB(t)
+	if _, err := DB.Exec(legacySchema); err != nil {
+		t.Fatal(err)
+	}
+	initSchema()
+	if n := appliedMigrations(t); n != len(migrations) {
+		t.Fatalf("%d migrations recorded, want %d", n, len(migrations))
+	}
+
+	for _, want := range []struct{ table, id, createdAt string }{
+		{"posts", "p1", "2024-03-01T10:00:00.000Z"},
+		{"comments", "c1", "2024-03-01T12:30:00.000Z"},
+		{"messages", "m1", "2024-03-01T12:00:00.500Z"},
+	} {
+		var got string
+		err := DB.QueryRow("SELECT CAST(created_at AS TEXT) FROM "+want.table+" WHERE id = ?", want.id).Scan(&got)
+		if err != nil || got != want.createdAt {
+			t.Errorf("%s %s created_at = %q, %v; want %q", want.table, want.id, got, err, want.createdAt)
+		}
+	}
+
+	var title, slug, html string
+	var comments int
+	var lastComment string
+	err := DB.QueryRow(`
+		SELECT title, slug, content_html, comment_count, CAST(last_comment_at AS TEXT)
+		FROM posts WHERE id = 'p1'`).Scan(&title, &slug, &html, &comments, &lastComment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "First line" || slug != "first-line" {
+		t.Errorf("title, slug = %q, %q; want the first line of the content", title, slug)
+	}
+	if !strings.Contains(html, "<strong>rest</strong>") {
+		t.Errorf("content_html = %q, want the rendered content", html)
+	}
+	if comments != 2 || lastComment != "2024-03-01T13:00:00.000Z" {
+		t.Errorf("comment_count, last_comment_at = %d, %q; want 2, the newest comment", comments, lastComment)
+	}
+	if err := DB.QueryRow("SELECT title FROM posts WHERE id = 'p2'").Scan(&title); err != nil || title != "Untitled" {
+		t.Errorf("empty post title = %q, %v; want Untitled", title, err)
+	}
+
+	// Categories differing only in case and spacing become one.
+	var categories, linked int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM categories WHERE name = 'Go' COLLATE NOCASE").Scan(&categories); err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.QueryRow("SELECT COUNT(*) FROM post_categories").Scan(&linked); err != nil {
+		t.Fatal(err)
+	}
+	if categories != 1 || linked != 2 {
+		t.Errorf("%d categories linked to %d posts, want 1 linked to 2", categories, linked)
+	}
+}
+
+func TestAddColumnIsIdempotent(t *testing.T) {
+	openTestDB(t)
+	if _, err := DB.Exec("CREATE TABLE things (id TEXT PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		tx, err := DB.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := addColumn(tx, "things", "note", "TEXT NOT NULL DEFAULT ''"); err != nil {
+			tx.Rollback()
+			t.Fatalf("addColumn run %d: %v", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var n int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM pragma_table_info('things') WHERE name = 'note'").Scan(&n); err != nil || n != 1 {
+		t.Errorf("things has %d note columns, %v; want 1", n, err)
+	}
+}
+
+func TestParseLegacyTime(t *testing.T) {
+	want := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, value := range []string{
+		"2024-03-01 10:00:00",
+		"2024-03-01 10:00:00.000",
+		"2024-03-01T10:00:00",
+		"2024-03-01T10:00:00Z",
+		"2024-03-01T12:00:00+02:00",
+	} {
+		got, ok := parseLegacyTime(value)
+		if !ok || !got.Equal(want) {
+			t.Errorf("parseLegacyTime(%q) = %v, %v; want %v", value, got, ok, want)
+		}
+	}
+	if _, ok := parseLegacyTime("yesterday"); ok {
+		t.Error("parseLegacyTime accepted \"yesterday\"")
+	}
+}
+
+func TestModerationLogWithoutPost(t *testing.T) {
+	openTestDB(t)
+	_, err := DB.Exec(`
+		CREATE TABLE moderation_log (
+			id TEXT PRIMARY KEY, moderator_id TEXT NOT NULL, action TEXT NOT NULL, target_type TEXT NOT NULL,
+			target_id TEXT NOT NULL, post_id TEXT NOT NULL, detail TEXT NOT NULL DEFAULT '', created_at DATETIME NOT NULL
+		);
+		INSERT INTO moderation_log VALUES ('l1', 'u1', 'pin', 'post', 'p1', 'p1', '', '2024-03-01T10:00:00.000Z');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateModerationLogWithoutPost(tx); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB.Exec(`INSERT INTO moderation_log (id, moderator_id, action, target_type, target_id, created_at)
+		VALUES ('l2', 'u1', 'remove', 'message', 'm1', '2024-03-02T10:00:00.000Z')`); err != nil {
+		t.Errorf("logging without a post: %v", err)
+	}
+	var postID string
+	if err := DB.QueryRow("SELECT post_id FROM moderation_log WHERE id = 'l1'").Scan(&postID); err != nil || postID != "p1" {
+		t.Errorf("existing entry post_id = %q, %v; want p1", postID, err)
+	}
+}
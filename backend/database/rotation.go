@@ -0,0 +1,67 @@
+package database
+
+import (
+	"real-time-forum/backend/encryption"
+)
+
+const rotationBatchSize = 500
+
+// RotateMessageKeys re-encrypts every message that is stored in plaintext
+// or under a key other than the active one, in batches. It returns the
+// number of rows rewritten.
+func RotateMessageKeys() (int, error) {
+	tag := "enc:v1:" + encryption.ActiveKeyID() + ":"
+	total := 0
+	for {
+		rows, err := DB.Query(`
+			SELECT id, content FROM messages
+			WHERE substr(content, 1, ?) != ?
+			LIMIT ?`, len(tag), tag, rotationBatchSize)
+		if err != nil {
+			return total, err
+		}
+
+		type row struct{ id, content string }
+		var batch []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.content); err != nil {
+				rows.Close()
+				return total, err
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return total, err
+		}
+		if len(batch) == 0 {
+			return total, nil
+		}
+
+		tx, err := DB.Begin()
+		if err != nil {
+			return total, err
+		}
+		for _, r := range batch {
+			plaintext, err := encryption.Decrypt(r.content, r.id)
+			if err != nil {
+				tx.Rollback()
+				return total, err
+			}
+			sealed, err := encryption.Encrypt(plaintext, r.id)
+			if err != nil {
+				tx.Rollback()
+				return total, err
+			}
+			if _, err := tx.Exec("UPDATE messages SET content = ? WHERE id = ?", sealed, r.id); err != nil {
+				tx.Rollback()
+				return total, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return total, err
+		}
+		total += len(batch)
+	}
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"log"
+	"real-time-forum/backend/encryption"
+	"strings"
+)
+
+// SearchEnabled reports whether the FTS5 search index is available. It is
+// false when the binary was built without the sqlite_fts5 tag.
+var SearchEnabled bool
+
+// MessageSearchEnabled reports whether direct messages are indexed. They are
+// not while messages are encrypted at rest, since the index would hold the
+// plaintext.
+var MessageSearchEnabled bool
+
+// searchIndexes lists the FTS5 tables mirrored from their content tables.
+// An index is only refreshed when one of its columns or the source row's
+// visibility changes, not on every counter update.
+var searchIndexes = []struct {
+	table   string
+	source  string
+	columns []string
+	watch   []string
+}{
+	{"posts_fts", "posts", []string{"title", "category_names", "content"}, []string{"deleted_at", "hidden_at"}},
+	{"comments_fts", "comments", []string{"content"}, []string{"deleted_at", "hidden_at"}},
+	{"messages_fts", "messages", []string{"content"}, []string{"hidden_at"}},
+}
+
+func createSearchTables() {
+	var fts5 bool
+	if err := DB.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil {
+		log.Fatalf("Failed to check for FTS5: %v", err)
+	}
+	if !fts5 {
+		// Triggers left by an earlier FTS5 build would make every write to
+		// the source tables fail, so remove them. The indexes are rebuilt
+		// once FTS5 is available again.
+		for _, idx := range searchIndexes {
+			dropSearchIndex(idx.table)
+		}
+		log.Println("Full-text search disabled: SQLite was built without FTS5 (build with -tags sqlite_fts5)")
+		return
+	}
+
+	for _, idx := range searchIndexes {
+		if idx.source == "messages" && encryption.Enabled() {
+			dropSearchIndex(idx.table)
+			continue
+		}
+		if err := createSearchIndex(idx.table, idx.source, idx.columns, idx.watch); err != nil {
+			log.Fatalf("Failed to create %s search index: %v", idx.table, err)
+		}
+	}
+	SearchEnabled = true
+	MessageSearchEnabled = !encryption.Enabled()
+}
+
+func dropSearchIndex(table string) {
+	if err := dropSearchIndexStatements(DB, table); err != nil {
+		log.Fatalf("Failed to drop %s search index: %v", table, err)
+	}
+}
+
+// dropSearchIndexStatements drops an index and its triggers so the next
+// createSearchTables call rebuilds it, e.g. after its columns change.
+func dropSearchIndexStatements(db execer, table string) error {
+	for _, stmt := range []string{
+		`DROP TRIGGER IF EXISTS ` + table + `_ai`,
+		`DROP TRIGGER IF EXISTS ` + table + `_ad`,
+		`DROP TRIGGER IF EXISTS ` + table + `_au`,
+		`DROP TABLE IF EXISTS ` + table,
+	} {
+		if _, err := db.Exec(stmt); err != nil && !strings.Contains(err.Error(), "no such module: fts5") {
+			return err
+		}
+	}
+	return nil
+}
+
+// createSearchIndex creates an external-content FTS5 table over source and
+// the triggers that keep it in sync. An index without its insert trigger is
+// new or missed writes while FTS5 was unavailable, so it is rebuilt from the
+// rows present in source. Updates re-index a row only when one of columns or
+// watch changes.
+func createSearchIndex(table, source string, columns, watch []string) error {
+	var existing int
+	err := DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?", table+"_ai").Scan(&existing)
+	if err != nil {
+		return err
+	}
+
+	cols := strings.Join(columns, ", ")
+	newCols := "new." + strings.Join(columns, ", new.")
+	oldCols := "old." + strings.Join(columns, ", old.")
+	updateCols := strings.Join(append(append([]string{}, columns...), watch...), ", ")
+
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS ` + table + ` USING fts5(` + cols + `, content='` + source + `', content_rowid='rowid');`,
+		`CREATE TRIGGER IF NOT EXISTS ` + table + `_ai AFTER INSERT ON ` + source + ` BEGIN
+			INSERT INTO ` + table + `(rowid, ` + cols + `) VALUES (new.rowid, ` + newCols + `);
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS ` + table + `_ad AFTER DELETE ON ` + source + ` BEGIN
+			INSERT INTO ` + table + `(` + table + `, rowid, ` + cols + `) VALUES ('delete', old.rowid, ` + oldCols + `);
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS ` + table + `_au AFTER UPDATE OF ` + updateCols + ` ON ` + source + ` BEGIN
+			INSERT INTO ` + table + `(` + table + `, rowid, ` + cols + `) VALUES ('delete', old.rowid, ` + oldCols + `);
+			INSERT INTO ` + table + `(rowid, ` + cols + `) VALUES (new.rowid, ` + newCols + `);
+		END;`,
+	}
+	for _, stmt := range statements {
+		if _, err := DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	if existing == 0 {
+		if _, err := DB.Exec(`INSERT INTO ` + table + `(` + table + `) VALUES ('rebuild')`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
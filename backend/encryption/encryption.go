@@ -0,0 +1,127 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Encrypted values are stored as "enc:v1:<key id>:<base64(nonce|ciphertext)>".
+// Anything without the prefix is legacy plaintext and is returned as is.
+const prefix = "enc:v1:"
+
+var (
+	keys     = make(map[string]cipher.AEAD)
+	activeID string
+)
+
+// LoadKeys parses spec, a comma-separated list of "id:base64key" pairs with
+// 32-byte AES-256 keys, and makes activeID the key used for new values.
+// An empty spec leaves encryption disabled.
+func LoadKeys(spec, active string) error {
+	keys = make(map[string]cipher.AEAD)
+	activeID = ""
+	if strings.TrimSpace(spec) == "" {
+		return nil
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return fmt.Errorf("key entry %q must look like id:base64key", entry)
+		}
+		if strings.Contains(id, ":") {
+			return fmt.Errorf("key id %q must not contain ':'", id)
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("key %s is not valid base64: %v", id, err)
+		}
+		if len(raw) != 32 {
+			return fmt.Errorf("key %s must be 32 bytes, got %d", id, len(raw))
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return err
+		}
+		keys[id] = aead
+	}
+
+	if _, ok := keys[active]; !ok {
+		return fmt.Errorf("active key id %q is not one of the configured keys", active)
+	}
+	activeID = active
+	return nil
+}
+
+// Enabled reports whether new values are encrypted.
+func Enabled() bool {
+	return activeID != ""
+}
+
+// ActiveKeyID returns the ID of the key used for new values.
+func ActiveKeyID() string {
+	return activeID
+}
+
+// KeyID returns the ID of the key stored encrypted with, or "" for plaintext.
+func KeyID(stored string) string {
+	if !strings.HasPrefix(stored, prefix) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(stored, prefix), ":")
+	return id
+}
+
+// Encrypt seals plaintext with the active key. aad binds the ciphertext to
+// its row (the message ID) so values cannot be swapped between rows.
+// When encryption is disabled plaintext is returned unchanged.
+func Encrypt(plaintext, aad string) (string, error) {
+	if !Enabled() {
+		return plaintext, nil
+	}
+	aead := keys[activeID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(aad))
+	return prefix + activeID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt with whichever configured key
+// it names. Plaintext values pass through unchanged.
+func Decrypt(stored, aad string) (string, error) {
+	if !strings.HasPrefix(stored, prefix) {
+		return stored, nil
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(stored, prefix), ":")
+	if !ok {
+		return "", errors.New("malformed encrypted value")
+	}
+	aead, ok := keys[id]
+	if !ok {
+		return "", fmt.Errorf("no key configured for key id %q", id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,128 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func key(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func loadKeys(t *testing.T, spec, active string) {
+	t.Helper()
+	if err := LoadKeys(spec, active); err != nil {
+		t.Fatalf("LoadKeys: %v", err)
+	}
+	t.Cleanup(func() { LoadKeys("", "") })
+}
+
+func TestRoundTrip(t *testing.T) {
+	loadKeys(t, "k1:"+key(1), "k1")
+
+	stored, err := Encrypt("hello, world", "message-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, "enc:v1:k1:") || strings.Contains(stored, "hello") {
+		t.Fatalf("Encrypt = %q, want an enc:v1:k1: value without the plaintext", stored)
+	}
+	if KeyID(stored) != "k1" {
+		t.Errorf("KeyID = %q, want k1", KeyID(stored))
+	}
+	got, err := Decrypt(stored, "message-1")
+	if err != nil || got != "hello, world" {
+		t.Errorf("Decrypt = %q, %v; want %q", got, err, "hello, world")
+	}
+
+	again, _ := Encrypt("hello, world", "message-1")
+	if again == stored {
+		t.Error("Encrypt reused a nonce")
+	}
+}
+
+func TestDecryptRejectsOtherRow(t *testing.T) {
+	loadKeys(t, "k1:"+key(1), "k1")
+	stored, err := Encrypt("secret", "message-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(stored, "message-2"); err == nil {
+		t.Error("Decrypt with another message's ID succeeded")
+	}
+}
+
+func TestDecryptRejectsTampering(t *testing.T) {
+	loadKeys(t, "k1:"+key(1), "k1")
+	stored, err := Encrypt("secret", "message-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, "enc:v1:k1:"))
+	sealed[len(sealed)-1] ^= 1
+	tampered := "enc:v1:k1:" + base64.StdEncoding.EncodeToString(sealed)
+
+	for name, value := range map[string]string{
+		"flipped bit": tampered,
+		"unknown key": "enc:v1:k9:" + strings.TrimPrefix(stored, "enc:v1:k1:"),
+		"no key id":   "enc:v1:abc",
+		"bad base64":  "enc:v1:k1:!!!",
+		"too short":   "enc:v1:k1:" + base64.StdEncoding.EncodeToString([]byte("x")),
+	} {
+		if _, err := Decrypt(value, "message-1"); err == nil {
+			t.Errorf("%s: Decrypt succeeded", name)
+		}
+	}
+}
+
+func TestRotation(t *testing.T) {
+	loadKeys(t, "old:"+key(1), "old")
+	stored, err := Encrypt("kept", "message-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Old values stay readable while new ones use the new active key.
+	loadKeys(t, "old:"+key(1)+", new:"+key(2), "new")
+	if got, err := Decrypt(stored, "message-1"); err != nil || got != "kept" {
+		t.Errorf("Decrypt after rotation = %q, %v", got, err)
+	}
+	fresh, _ := Encrypt("kept", "message-1")
+	if KeyID(fresh) != "new" || ActiveKeyID() != "new" {
+		t.Errorf("new value uses key %q, active %q; want new", KeyID(fresh), ActiveKeyID())
+	}
+}
+
+func TestDisabledPassesPlaintext(t *testing.T) {
+	loadKeys(t, "", "")
+	if Enabled() {
+		t.Fatal("Enabled with no keys")
+	}
+	stored, err := Encrypt("plain", "message-1")
+	if err != nil || stored != "plain" {
+		t.Errorf("Encrypt = %q, %v; want the plaintext", stored, err)
+	}
+	if got, err := Decrypt("legacy text", "message-1"); err != nil || got != "legacy text" {
+		t.Errorf("Decrypt of legacy plaintext = %q, %v", got, err)
+	}
+	if KeyID("legacy text") != "" {
+		t.Error("KeyID of plaintext is not empty")
+	}
+}
+
+func TestLoadKeysErrors(t *testing.T) {
+	t.Cleanup(func() { LoadKeys("", "") })
+	for name, spec := range map[string]struct{ spec, active string }{
+		"missing id":     {":" + key(1), ""},
+		"no separator":   {"k1" + key(1), "k1"},
+		"bad base64":     {"k1:not base64", "k1"},
+		"short key":      {"k1:" + base64.StdEncoding.EncodeToString([]byte("short")), "k1"},
+		"unknown active": {"k1:" + key(1), "k2"},
+	} {
+		if err := LoadKeys(spec.spec, spec.active); err == nil {
+			t.Errorf("%s: LoadKeys succeeded", name)
+		}
+	}
+}
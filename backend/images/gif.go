@@ -0,0 +1,64 @@
+package images
+
+// gifPixels adds up the dimensions of every frame in a GIF by walking its
+// blocks, without decompressing any image data. gif.DecodeAll allocates each
+// frame as it goes, so the total has to be known before calling it.
+func gifPixels(data []byte) (int, error) {
+	// Header and logical screen descriptor.
+	if len(data) < 13 {
+		return 0, ErrInvalid
+	}
+	pos := 13 + colorTableSize(data[10])
+	total := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // Extension: label, then data sub-blocks.
+			next, err := skipSubBlocks(data, pos+2)
+			if err != nil {
+				return 0, err
+			}
+			pos = next
+		case 0x2C: // Image descriptor, color table, LZW code size, data.
+			if pos+10 > len(data) {
+				return 0, ErrInvalid
+			}
+			w := int(data[pos+5]) | int(data[pos+6])<<8
+			h := int(data[pos+7]) | int(data[pos+8])<<8
+			total += w * h
+			next, err := skipSubBlocks(data, pos+10+colorTableSize(data[pos+9])+1)
+			if err != nil {
+				return 0, err
+			}
+			pos = next
+		case 0x3B: // Trailer.
+			return total, nil
+		default:
+			return 0, ErrInvalid
+		}
+	}
+	return 0, ErrInvalid
+}
+
+// colorTableSize is the length of the color table a packed field announces.
+func colorTableSize(packed byte) int {
+	if packed&0x80 == 0 {
+		return 0
+	}
+	return 3 << (packed&0x07 + 1)
+}
+
+// skipSubBlocks returns the position after the sub-blocks starting at pos,
+// which end with one of length zero.
+func skipSubBlocks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, ErrInvalid
+		}
+		n := int(data[pos])
+		pos++
+		if n == 0 {
+			return pos, nil
+		}
+		pos += n
+	}
+}
@@ -0,0 +1,186 @@
+// Package images checks uploaded images and prepares them for storage.
+//
+// Every upload is decoded and encoded again, which drops EXIF, text chunks
+// and any other metadata along with anything hidden after the image data.
+// JPEG orientation is applied to the pixels first so photos keep the right
+// way up once the EXIF tag is gone.
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// MaxPixels bounds the decoded size of an image, so that a small file that
+// claims huge dimensions cannot exhaust memory.
+const MaxPixels = 24_000_000
+
+var (
+	ErrUnsupported = errors.New("only JPEG, PNG and GIF images are supported")
+	ErrInvalid     = errors.New("the file is not a valid image")
+	ErrTooLarge    = errors.New("the image dimensions are too large")
+)
+
+// Image is an upload ready to be stored, along with its thumbnail.
+type Image struct {
+	Data          []byte
+	ContentType   string
+	Width         int
+	Height        int
+	Thumbnail     []byte
+	ThumbnailType string
+}
+
+// formats maps sniffed content types to the decoder name image reports.
+var formats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// Process sniffs data, rejects anything that is not a supported image,
+// strips metadata by re-encoding it, and makes a thumbnail whose longest
+// side is at most thumbSize pixels.
+func Process(data []byte, thumbSize int) (*Image, error) {
+	contentType := http.DetectContentType(data)
+	format, ok := formats[contentType]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	cfg, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decoded != format {
+		return nil, ErrInvalid
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, ErrInvalid
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	out := &Image{ContentType: contentType}
+	var first image.Image
+	var buf bytes.Buffer
+
+	switch format {
+	case "jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrInvalid
+		}
+		img = applyOrientation(img, jpegOrientation(data))
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, err
+		}
+		first = img
+
+	case "png":
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrInvalid
+		}
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		first = img
+
+	case "gif":
+		// Animated GIFs keep their frames and timing; only extension
+		// blocks such as comments are lost.
+		pixels, err := gifPixels(data)
+		if err != nil {
+			return nil, err
+		}
+		if pixels > 4*MaxPixels {
+			return nil, ErrTooLarge
+		}
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil || len(g.Image) == 0 {
+			return nil, ErrInvalid
+		}
+		clean := &gif.GIF{
+			Image:           g.Image,
+			Delay:           g.Delay,
+			LoopCount:       g.LoopCount,
+			Disposal:        g.Disposal,
+			Config:          g.Config,
+			BackgroundIndex: g.BackgroundIndex,
+		}
+		if err := gif.EncodeAll(&buf, clean); err != nil {
+			return nil, err
+		}
+		canvas := image.NewRGBA(image.Rect(0, 0, cfg.Width, cfg.Height))
+		draw.Draw(canvas, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Over)
+		first = canvas
+	}
+
+	out.Data = buf.Bytes()
+	out.Width, out.Height = first.Bounds().Dx(), first.Bounds().Dy()
+
+	thumb := Thumbnail(first, thumbSize)
+	var thumbBuf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&thumbBuf, thumb, &jpeg.Options{Quality: 85})
+		out.ThumbnailType = "image/jpeg"
+	} else {
+		// PNG keeps the transparency GIFs and PNGs may have.
+		err = png.Encode(&thumbBuf, thumb)
+		out.ThumbnailType = "image/png"
+	}
+	if err != nil {
+		return nil, err
+	}
+	out.Thumbnail = thumbBuf.Bytes()
+	return out, nil
+}
+
+// Thumbnail scales img down so that neither side exceeds size, averaging the
+// source pixels that fall into each thumbnail pixel. Smaller images are only
+// copied.
+func Thumbnail(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	if size <= 0 || (w <= size && h <= size) {
+		return src
+	}
+	if w >= h {
+		w, h = size, max(1, h*size/w)
+	} else {
+		w, h = max(1, w*size/h), size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint32(row[i])
+					g += uint32(row[i+1])
+					bl += uint32(row[i+2])
+					a += uint32(row[i+3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
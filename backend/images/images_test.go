@@ -0,0 +1,50 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+)
+
+func encodeGIF(t *testing.T, sizes ...image.Point) []byte {
+	t.Helper()
+	g := &gif.GIF{Config: image.Config{Width: 8, Height: 8, ColorModel: color.Palette(palette.Plan9)}}
+	for _, size := range sizes {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, size.X, size.Y), palette.Plan9))
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGIFPixels(t *testing.T) {
+	data := encodeGIF(t, image.Pt(8, 8), image.Pt(4, 2), image.Pt(1, 1))
+	if got, err := gifPixels(data); err != nil || got != 64+8+1 {
+		t.Errorf("gifPixels = %d, %v; want 73", got, err)
+	}
+	if _, err := gifPixels(data[:len(data)-1]); err != ErrInvalid {
+		t.Errorf("gifPixels without a trailer = %v, want ErrInvalid", err)
+	}
+	if _, err := Process(data, 4); err != nil {
+		t.Errorf("Process: %v", err)
+	}
+}
+
+func TestProcessRejectsGIFsWithTooManyPixels(t *testing.T) {
+	// Five empty 4000x6000 frames: each fits MaxPixels but together they
+	// do not, and the file is tiny.
+	data := []byte("GIF89a\xa0\x0f\x70\x17\x00\x00\x00")
+	for i := 0; i < 5; i++ {
+		data = append(data, 0x2C, 0, 0, 0, 0, 0xa0, 0x0f, 0x70, 0x17, 0, 2, 0)
+	}
+	data = append(data, 0x3B)
+	if _, err := Process(data, 4); err != ErrTooLarge {
+		t.Errorf("Process = %v, want ErrTooLarge", err)
+	}
+}
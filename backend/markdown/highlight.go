@@ -0,0 +1,208 @@
+package markdown
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// language describes just enough of a programming language to colour its
+// keywords, strings, comments and numbers.
+type language struct {
+	keywords      map[string]bool
+	caseFold      bool // keywords match regardless of case
+	lineComments  []string
+	blockComments [][2]string
+	quotes        string // characters that delimit strings
+}
+
+func words(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var cStyle = []string{"//"}
+var cBlock = [][2]string{{"/*", "*/"}}
+
+var languages = map[string]*language{
+	"go": {
+		keywords: words(`break case chan const continue default defer else fallthrough for func go goto if import
+			interface map package range return select struct switch type var nil true false iota`),
+		lineComments: cStyle, blockComments: cBlock, quotes: "\"'`",
+	},
+	"javascript": {
+		keywords: words(`break case catch class const continue debugger default delete do else export extends finally
+			for function if import in instanceof let new return super switch this throw try typeof var void while
+			with yield async await of null undefined true false interface type enum implements`),
+		lineComments: cStyle, blockComments: cBlock, quotes: "\"'`",
+	},
+	"python": {
+		keywords: words(`and as assert async await break class continue def del elif else except finally for from
+			global if import in is lambda nonlocal not or pass raise return try while with yield None True False self`),
+		lineComments: []string{"#"}, quotes: "\"'",
+	},
+	"sql": {
+		keywords: words(`select from where and or not insert into values update set delete create table index view
+			drop alter add join left right inner outer on as group by order having limit offset union all distinct
+			null is in exists between like case when then else end primary key foreign references default begin
+			commit rollback transaction asc desc count sum avg min max`),
+		caseFold: true, lineComments: []string{"--"}, blockComments: cBlock, quotes: "'\"",
+	},
+	"bash": {
+		keywords: words(`if then else elif fi for while until do done case esac in function return local export
+			echo exit set unset readonly shift source`),
+		lineComments: []string{"#"}, quotes: "\"'",
+	},
+	"c": {
+		keywords: words(`auto break case char const continue default do double else enum extern float for goto if
+			int long register return short signed sizeof static struct switch typedef union unsigned void volatile
+			while class public private protected new delete this true false null nullptr bool namespace using
+			template virtual final import package extends implements interface throws throw try catch finally
+			boolean byte string let mut fn impl pub use mod match trait self Self`),
+		lineComments: cStyle, blockComments: cBlock, quotes: "\"'",
+	},
+	"json": {
+		keywords: words(`true false null`),
+		quotes:   "\"",
+	},
+	"css": {
+		keywords:      words(`important inherit initial unset none auto`),
+		blockComments: cBlock, quotes: "\"'",
+	},
+}
+
+// languageAliases maps common info strings onto the definitions above.
+var languageAliases = map[string]string{
+	"golang": "go",
+	"js":     "javascript", "jsx": "javascript", "ts": "javascript", "tsx": "javascript", "typescript": "javascript",
+	"py": "python",
+	"sh": "bash", "shell": "bash", "zsh": "bash", "console": "bash",
+	"sqlite": "sql", "mysql": "sql", "postgresql": "sql", "postgres": "sql",
+	"cpp": "c", "c++": "c", "h": "c", "java": "c", "csharp": "c", "cs": "c", "rust": "c", "rs": "c",
+	"kotlin": "c", "swift": "c",
+}
+
+// highlight escapes code and wraps its tokens in spans with the classes
+// tok-kw, tok-str, tok-com and tok-num. Unknown languages are only escaped.
+func highlight(code, name string) string {
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+	lang, ok := languages[name]
+	if !ok {
+		return html.EscapeString(code)
+	}
+
+	var b strings.Builder
+	span := func(class, text string) {
+		b.WriteString(`<span class="` + class + `">` + html.EscapeString(text) + `</span>`)
+	}
+
+	for i := 0; i < len(code); {
+		rest := code[i:]
+
+		if prefix := matchPrefix(rest, lang.lineComments); prefix != "" {
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			span("tok-com", rest[:end])
+			i += end
+			continue
+		}
+
+		if pair, ok := matchBlock(rest, lang.blockComments); ok {
+			end := strings.Index(rest[len(pair[0]):], pair[1])
+			if end < 0 {
+				end = len(rest)
+			} else {
+				end += len(pair[0]) + len(pair[1])
+			}
+			span("tok-com", rest[:end])
+			i += end
+			continue
+		}
+
+		c := rest[0]
+		if strings.IndexByte(lang.quotes, c) >= 0 {
+			end := 1
+			for end < len(rest) && rest[end] != c {
+				if rest[end] == '\n' && c != '`' && name != "python" {
+					break
+				}
+				if rest[end] == '\\' && c != '`' && end+1 < len(rest) {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(rest))
+			span("tok-str", rest[:end])
+			i += end
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(rest)
+		if unicode.IsDigit(r) {
+			end := size
+			for end < len(rest) && (isIdentByte(rest[end]) || rest[end] == '.') {
+				end++
+			}
+			span("tok-num", rest[:end])
+			i += end
+			continue
+		}
+
+		if unicode.IsLetter(r) || r == '_' || r == '$' {
+			end := size
+			for end < len(rest) {
+				r, n := utf8.DecodeRuneInString(rest[end:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '$' {
+					break
+				}
+				end += n
+			}
+			word := rest[:end]
+			key := word
+			if lang.caseFold {
+				key = strings.ToLower(word)
+			}
+			if lang.keywords[key] {
+				span("tok-kw", word)
+			} else {
+				b.WriteString(html.EscapeString(word))
+			}
+			i += end
+			continue
+		}
+
+		b.WriteString(html.EscapeString(rest[:size]))
+		i += size
+	}
+	return b.String()
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func matchPrefix(s string, prefixes []string) string {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return p
+		}
+	}
+	return ""
+}
+
+func matchBlock(s string, pairs [][2]string) ([2]string, bool) {
+	for _, pair := range pairs {
+		if strings.HasPrefix(s, pair[0]) {
+			return pair, true
+		}
+	}
+	return [2]string{}, false
+}
@@ -0,0 +1,525 @@
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const linkRel = "nofollow ugc noopener"
+
+// maxLinkText bounds the search for a link's closing bracket so that text
+// full of unmatched brackets cannot make rendering quadratic.
+const maxLinkText = 1000
+
+// inlineNode is either finished HTML or a run of emphasis delimiters that
+// may still turn into tags once the whole line has been scanned.
+type inlineNode struct {
+	html string
+
+	delim    byte // '*', '_' or '~'; 0 for plain HTML
+	count    int  // delimiters not yet used
+	original int  // length of the run as written
+	canOpen  bool
+	canClose bool
+	close    []string // tags written before the remaining delimiters
+	open     []string // tags written after them
+}
+
+type inlineParser struct {
+	src   string
+	pos   int
+	nodes []inlineNode
+	text  bytes.Buffer
+
+	// unclosed holds the lengths of backtick runs known to have no closing
+	// run later in src, so each length is searched for at most once.
+	unclosed map[int]bool
+}
+
+// renderInline renders the inline content of a block: code spans, links,
+// autolinks, emphasis, strikethrough, escapes and line breaks.
+func renderInline(src string) string {
+	p := &inlineParser{src: src}
+	p.parse()
+	p.processEmphasis()
+
+	var b strings.Builder
+	for _, n := range p.nodes {
+		if n.delim == 0 {
+			b.WriteString(n.html)
+			continue
+		}
+		for _, tag := range n.close {
+			b.WriteString(tag)
+		}
+		b.WriteString(strings.Repeat(string(n.delim), n.count))
+		for _, tag := range n.open {
+			b.WriteString(tag)
+		}
+	}
+	return b.String()
+}
+
+// flush moves pending plain text into the node list.
+func (p *inlineParser) flush() {
+	if p.text.Len() > 0 {
+		p.nodes = append(p.nodes, inlineNode{html: html.EscapeString(p.text.String())})
+		p.text.Reset()
+	}
+}
+
+func (p *inlineParser) emit(s string) {
+	p.flush()
+	p.nodes = append(p.nodes, inlineNode{html: s})
+}
+
+func (p *inlineParser) parse() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\\':
+			p.parseEscape()
+		case c == '`':
+			p.parseCodeSpan()
+		case c == '\n':
+			p.parseNewline()
+		case c == '<':
+			if !p.parseAutolink() {
+				p.text.WriteByte(c)
+				p.pos++
+			}
+		case c == '[' || (c == '!' && strings.HasPrefix(p.src[p.pos:], "![")):
+			if !p.parseLink() {
+				p.text.WriteByte(c)
+				p.pos++
+			}
+		case c == '*' || c == '_' || c == '~':
+			p.parseDelimiterRun()
+		case c == 'h' && p.atWordStart() && (strings.HasPrefix(p.src[p.pos:], "http://") || strings.HasPrefix(p.src[p.pos:], "https://")):
+			if !p.parseBareURL() {
+				p.text.WriteByte(c)
+				p.pos++
+			}
+		default:
+			_, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			p.text.WriteString(p.src[p.pos : p.pos+size])
+			p.pos += size
+		}
+	}
+	p.flush()
+}
+
+func (p *inlineParser) parseEscape() {
+	if p.pos+1 < len(p.src) {
+		next := p.src[p.pos+1]
+		if next == '\n' {
+			p.emit("<br />\n")
+			p.pos += 2
+			return
+		}
+		if next < utf8.RuneSelf && (unicode.IsPunct(rune(next)) || unicode.IsSymbol(rune(next))) {
+			p.text.WriteByte(next)
+			p.pos += 2
+			return
+		}
+	}
+	p.text.WriteByte('\\')
+	p.pos++
+}
+
+// parseCodeSpan matches a backtick run with the next run of the same length.
+func (p *inlineParser) parseCodeSpan() {
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] == '`' {
+		p.pos++
+	}
+	fence := p.src[start:p.pos]
+	if p.unclosed[len(fence)] {
+		p.text.WriteString(fence)
+		return
+	}
+
+	for search := p.pos; search < len(p.src); {
+		idx := strings.Index(p.src[search:], fence)
+		if idx < 0 {
+			break
+		}
+		end := search + idx
+		after := end + len(fence)
+		if after < len(p.src) && p.src[after] == '`' {
+			// A longer run does not close this span.
+			for after < len(p.src) && p.src[after] == '`' {
+				after++
+			}
+			search = after
+			continue
+		}
+		code := strings.ReplaceAll(p.src[p.pos:end], "\n", " ")
+		if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+			code = code[1 : len(code)-1]
+		}
+		p.emit("<code>" + html.EscapeString(code) + "</code>")
+		p.pos = after
+		return
+	}
+	if p.unclosed == nil {
+		p.unclosed = map[int]bool{}
+	}
+	p.unclosed[len(fence)] = true
+	p.text.WriteString(fence)
+}
+
+// parseNewline drops the spaces ending the line in place, so a long
+// paragraph is not copied again at every line break.
+func (p *inlineParser) parseNewline() {
+	pending := p.text.Len()
+	p.text.Truncate(len(bytes.TrimRight(p.text.Bytes(), " ")))
+	if pending-p.text.Len() >= 2 {
+		p.emit("<br />\n")
+	} else {
+		p.text.WriteByte('\n')
+	}
+	p.pos++
+	// Leading spaces on the next line are not part of the text.
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// parseAutolink handles <https://example.com> and <user@example.com>.
+func (p *inlineParser) parseAutolink() bool {
+	end := strings.IndexAny(p.src[p.pos+1:], "<> \n")
+	if end < 0 || p.src[p.pos+1+end] != '>' {
+		return false
+	}
+	target := p.src[p.pos+1 : p.pos+1+end]
+	href := target
+	if !strings.Contains(target, ":") && strings.Contains(target, "@") && !strings.ContainsAny(target, "/\\") {
+		href = "mailto:" + target
+	} else if !strings.Contains(target, ":") {
+		return false
+	}
+	safe, ok := safeURL(href)
+	if !ok {
+		return false
+	}
+	p.emit(`<a href="` + safe + `" rel="` + linkRel + `">` + html.EscapeString(target) + `</a>`)
+	p.pos += end + 2
+	return true
+}
+
+// parseBareURL links a plain http(s) URL written in the text, leaving out
+// trailing punctuation that most likely ends the sentence.
+func (p *inlineParser) parseBareURL() bool {
+	end := p.pos
+	for end < len(p.src) && !strings.ContainsRune(" \t\n<", rune(p.src[end])) {
+		end++
+	}
+	for end > p.pos && strings.ContainsRune(".,:;!?'\")*_~", rune(p.src[end-1])) {
+		end--
+	}
+	target := p.src[p.pos:end]
+	safe, ok := safeURL(target)
+	if !ok || !strings.Contains(target[strings.Index(target, "//")+2:], ".") {
+		return false
+	}
+	p.emit(`<a href="` + safe + `" rel="` + linkRel + `">` + html.EscapeString(target) + `</a>`)
+	p.pos = end
+	return true
+}
+
+func (p *inlineParser) atWordStart() bool {
+	if p.pos == 0 {
+		return true
+	}
+	prev, _ := utf8.DecodeLastRuneInString(p.src[:p.pos])
+	return !unicode.IsLetter(prev) && !unicode.IsDigit(prev)
+}
+
+// parseLink handles [text](destination "title") and its image form, which
+// is rendered as a link to the image.
+func (p *inlineParser) parseLink() bool {
+	start := p.pos
+	image := p.src[start] == '!'
+	open := start
+	if image {
+		open++
+	}
+
+	// Find the matching ], skipping escapes and code spans.
+	depth := 0
+	closeBracket := -1
+	limit := min(len(p.src), open+maxLinkText)
+	for i := open; i < limit && closeBracket < 0; i++ {
+		switch p.src[i] {
+		case '\\':
+			i++
+		case '`':
+			j := i
+			for j < len(p.src) && p.src[j] == '`' {
+				j++
+			}
+			if k := strings.Index(p.src[j:], p.src[i:j]); k >= 0 {
+				i = j + k + (j - i) - 1
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closeBracket = i
+			}
+		}
+	}
+	if closeBracket < 0 || closeBracket+1 >= len(p.src) || p.src[closeBracket+1] != '(' {
+		return false
+	}
+
+	dest, title, end, ok := parseLinkTarget(p.src, closeBracket+2)
+	if !ok {
+		return false
+	}
+	text := p.src[open+1 : closeBracket]
+
+	href, safe := safeURL(dest)
+	var label string
+	if image {
+		label = html.EscapeString(text)
+		if label == "" {
+			label = html.EscapeString(dest)
+		}
+	} else {
+		label = renderInline(text)
+	}
+	if !safe {
+		// Keep the text but drop a link we are not willing to render.
+		p.emit(label)
+		p.pos = end
+		return true
+	}
+
+	a := `<a href="` + href + `"`
+	if title != "" {
+		a += ` title="` + html.EscapeString(title) + `"`
+	}
+	p.emit(a + ` rel="` + linkRel + `">` + label + `</a>`)
+	p.pos = end
+	return true
+}
+
+// parseLinkTarget reads `destination "title")` starting at i and returns
+// the position after the closing parenthesis.
+func parseLinkTarget(src string, i int) (dest, title string, end int, ok bool) {
+	skipSpace := func() {
+		for i < len(src) && (src[i] == ' ' || src[i] == '\n') {
+			i++
+		}
+	}
+	skipSpace()
+
+	if i < len(src) && src[i] == '<' {
+		close := strings.IndexAny(src[i+1:], ">\n")
+		if close < 0 || src[i+1+close] != '>' {
+			return "", "", 0, false
+		}
+		dest = src[i+1 : i+1+close]
+		i += close + 2
+	} else {
+		start, parens := i, 0
+		for i < len(src) && src[i] > ' ' {
+			if src[i] == '\\' && i+1 < len(src) {
+				i += 2
+				continue
+			}
+			if src[i] == '(' {
+				parens++
+			} else if src[i] == ')' {
+				if parens == 0 {
+					break
+				}
+				parens--
+			}
+			i++
+		}
+		dest = src[start:i]
+	}
+	dest = unescapeBackslashes(dest)
+	skipSpace()
+
+	if i < len(src) && (src[i] == '"' || src[i] == '\'' || src[i] == '(') {
+		closer := src[i]
+		if closer == '(' {
+			closer = ')'
+		}
+		close := strings.IndexByte(src[i+1:], closer)
+		if close < 0 {
+			return "", "", 0, false
+		}
+		title = unescapeBackslashes(src[i+1 : i+1+close])
+		i += close + 2
+		skipSpace()
+	}
+
+	if i >= len(src) || src[i] != ')' {
+		return "", "", 0, false
+	}
+	return dest, title, i + 1, true
+}
+
+func unescapeBackslashes(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && unicode.IsPunct(rune(s[i+1])) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// safeURL returns the attribute-escaped form of raw when it is an http,
+// https or mailto URL or a relative one.
+func safeURL(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.ContainsAny(raw, "\x00\n") {
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return "", false
+		}
+	case "mailto", "":
+	default:
+		return "", false
+	}
+	return html.EscapeString(raw), true
+}
+
+// parseDelimiterRun records a run of *, _ or ~ along with whether it can
+// open or close emphasis, following the CommonMark flanking rules.
+func (p *inlineParser) parseDelimiterRun() {
+	c := p.src[p.pos]
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] == c {
+		p.pos++
+	}
+	count := p.pos - start
+
+	before, after := ' ', ' '
+	if start > 0 {
+		before, _ = utf8.DecodeLastRuneInString(p.src[:start])
+	}
+	if p.pos < len(p.src) {
+		after, _ = utf8.DecodeRuneInString(p.src[p.pos:])
+	}
+	isSpace := func(r rune) bool { return unicode.IsSpace(r) }
+	isPunct := func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSymbol(r) }
+
+	leftFlanking := !isSpace(after) && (!isPunct(after) || isSpace(before) || isPunct(before))
+	rightFlanking := !isSpace(before) && (!isPunct(before) || isSpace(after) || isPunct(after))
+
+	n := inlineNode{delim: c, count: count, original: count}
+	if c == '_' {
+		n.canOpen = leftFlanking && (!rightFlanking || isPunct(before))
+		n.canClose = rightFlanking && (!leftFlanking || isPunct(after))
+	} else {
+		n.canOpen = leftFlanking
+		n.canClose = rightFlanking
+	}
+	if c == '~' && count != 2 {
+		// Only ~~double~~ tildes mark strikethrough.
+		n.canOpen, n.canClose = false, false
+	}
+
+	p.flush()
+	p.nodes = append(p.nodes, n)
+}
+
+// processEmphasis pairs delimiter runs into em, strong and del tags. Each
+// closer is matched with the nearest earlier opener of the same kind, and
+// runs left unmatched in between stay as literal text.
+//
+// Runs that can no longer open anything are unlinked from the chain of
+// candidates, and failed searches are remembered per kind of closer, so
+// long lines of stray delimiters stay linear as in the reference parsers.
+func (p *inlineParser) processEmphasis() {
+	type closerKind struct {
+		delim   byte
+		canOpen bool
+		mod3    int
+	}
+	bottom := map[closerKind]int{}
+	prev := make([]int, len(p.nodes))
+	top := -1
+
+	for closer := range p.nodes {
+		c := &p.nodes[closer]
+		if c.delim == 0 {
+			continue
+		}
+		prev[closer] = top
+
+		for c.canClose && c.count > 0 {
+			kind := closerKind{c.delim, c.canOpen, c.original % 3}
+			floor, ok := bottom[kind]
+			if !ok {
+				floor = -1
+			}
+			opener := -1
+			for i := prev[closer]; i > floor; i = prev[i] {
+				o := &p.nodes[i]
+				if o.delim != c.delim || !o.canOpen || o.count == 0 {
+					continue
+				}
+				// The "rule of three" from the spec.
+				if (o.canClose || c.canOpen) && (o.original+c.original)%3 == 0 &&
+					!(o.original%3 == 0 && c.original%3 == 0) {
+					continue
+				}
+				opener = i
+				break
+			}
+			if opener < 0 {
+				bottom[kind] = closer - 1
+				break
+			}
+
+			o := &p.nodes[opener]
+			used, tag := 1, "em"
+			switch {
+			case c.delim == '~':
+				used, tag = 2, "del"
+			case o.count >= 2 && c.count >= 2:
+				used, tag = 2, "strong"
+			}
+			o.count -= used
+			c.count -= used
+			o.open = append([]string{"<" + tag + ">"}, o.open...)
+			c.close = append(c.close, "</"+tag+">")
+
+			// Delimiters between the pair can no longer match anything.
+			prev[closer] = opener
+			if o.count == 0 {
+				prev[closer] = prev[opener]
+			}
+		}
+
+		if c.canOpen && c.count > 0 {
+			top = closer
+		} else {
+			top = prev[closer]
+		}
+	}
+}
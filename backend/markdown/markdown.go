@@ -0,0 +1,373 @@
+// Package markdown renders the CommonMark subset used for posts and comments
+// into HTML that is safe to insert into the page.
+//
+// Safety comes from construction rather than from cleaning up afterwards:
+// every piece of source text is HTML-escaped, raw HTML is never passed
+// through, and the renderer only ever emits the tags below. Link targets are
+// limited to http, https, mailto and relative URLs, and every link carries
+// rel="nofollow ugc noopener".
+//
+//	p br hr h1-h6 blockquote ul ol li pre code em strong del a span
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	atxHeading      = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	thematicBreak   = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	setextUnderline = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	fenceOpen       = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^`]*)$")
+	languageName    = regexp.MustCompile(`^[A-Za-z0-9_+-]+$`)
+)
+
+// maxNesting is how deep blockquotes and lists may nest. Markers beyond it
+// are left as text, since each level re-reads the lines it contains.
+const maxNesting = 16
+
+// Render converts markdown source to sanitized HTML.
+func Render(source string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+	lines := strings.Split(source, "\n")
+	for i, line := range lines {
+		lines[i] = expandTabs(line)
+	}
+
+	var b strings.Builder
+	renderBlocks(&b, lines, false, 0)
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// expandTabs replaces tabs in the leading whitespace of line with spaces,
+// using tab stops of four.
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	col := 0
+	for i, r := range line {
+		switch r {
+		case '\t':
+			n := 4 - col%4
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+		case ' ':
+			b.WriteByte(' ')
+			col++
+		default:
+			b.WriteString(line[i:])
+			return b.String()
+		}
+	}
+	return b.String()
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// renderBlocks renders a sequence of block-level lines nested depth
+// blockquotes and lists deep. In a tight list paragraphs are written
+// without <p> tags.
+func renderBlocks(b *strings.Builder, lines []string, tight bool, depth int) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+
+		case indentOf(line) >= 4:
+			i = renderIndentedCode(b, lines, i)
+
+		case fenceOpen.MatchString(line):
+			i = renderFencedCode(b, lines, i)
+
+		case atxHeading.MatchString(line):
+			m := atxHeading.FindStringSubmatch(line)
+			level := strconv.Itoa(len(m[1]))
+			b.WriteString("<h" + level + ">" + renderInline(m[2]) + "</h" + level + ">\n")
+			i++
+
+		case thematicBreak.MatchString(line):
+			b.WriteString("<hr />\n")
+			i++
+
+		case depth < maxNesting && isQuote(line):
+			i = renderQuote(b, lines, i, depth)
+
+		case depth < maxNesting && listMarkerOf(line).ok:
+			i = renderList(b, lines, i, depth)
+
+		default:
+			i = renderParagraph(b, lines, i, tight)
+		}
+	}
+}
+
+// startsBlock reports whether line interrupts a paragraph.
+func startsBlock(line string) bool {
+	return fenceOpen.MatchString(line) || atxHeading.MatchString(line) || thematicBreak.MatchString(line) ||
+		isQuote(line) || listMarkerOf(line).ok
+}
+
+func renderParagraph(b *strings.Builder, lines []string, i int, tight bool) int {
+	var text []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if isBlank(line) {
+			break
+		}
+		if len(text) > 0 && setextUnderline.MatchString(line) {
+			tag := "h1"
+			if strings.TrimSpace(line)[0] == '-' {
+				tag = "h2"
+			}
+			b.WriteString("<" + tag + ">" + renderInline(strings.Join(text, "\n")) + "</" + tag + ">\n")
+			return i + 1
+		}
+		if len(text) > 0 && startsBlock(line) {
+			break
+		}
+		text = append(text, strings.TrimLeft(line, " "))
+	}
+
+	content := renderInline(strings.TrimRight(strings.Join(text, "\n"), " "))
+	if tight {
+		b.WriteString(content + "\n")
+	} else {
+		b.WriteString("<p>" + content + "</p>\n")
+	}
+	return i
+}
+
+func renderIndentedCode(b *strings.Builder, lines []string, i int) int {
+	var code []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if isBlank(line) {
+			code = append(code, "")
+			continue
+		}
+		if indentOf(line) < 4 {
+			break
+		}
+		code = append(code, line[4:])
+	}
+	for len(code) > 0 && code[len(code)-1] == "" {
+		code = code[:len(code)-1]
+	}
+	writeCode(b, strings.Join(code, "\n"), "")
+	return i
+}
+
+func renderFencedCode(b *strings.Builder, lines []string, i int) int {
+	m := fenceOpen.FindStringSubmatch(lines[i])
+	indent, fence := len(m[1]), m[2]
+	lang := strings.Fields(m[3])
+
+	var code []string
+	for i++; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if indentOf(line) < 4 && strings.HasPrefix(trimmed, fence[:3]) &&
+			strings.Trim(trimmed, fence[:1]) == "" && len(trimmed) >= len(fence) {
+			i++
+			break
+		}
+		// Remove up to the opening fence's indentation from each line.
+		code = append(code, line[min(indent, indentOf(line)):])
+	}
+
+	language := ""
+	if len(lang) > 0 && languageName.MatchString(lang[0]) {
+		language = strings.ToLower(lang[0])
+	}
+	writeCode(b, strings.Join(code, "\n"), language)
+	return i
+}
+
+func writeCode(b *strings.Builder, code, language string) {
+	if language == "" {
+		b.WriteString("<pre><code>")
+		b.WriteString(html.EscapeString(code))
+	} else {
+		b.WriteString(`<pre><code class="language-` + language + `">`)
+		b.WriteString(highlight(code, language))
+	}
+	if code != "" {
+		b.WriteString("\n")
+	}
+	b.WriteString("</code></pre>\n")
+}
+
+func isQuote(line string) bool {
+	return indentOf(line) < 4 && strings.HasPrefix(strings.TrimLeft(line, " "), ">")
+}
+
+func renderQuote(b *strings.Builder, lines []string, i, depth int) int {
+	var inner []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if isQuote(line) {
+			line = strings.TrimLeft(line, " ")[1:]
+			line = strings.TrimPrefix(line, " ")
+			inner = append(inner, line)
+			continue
+		}
+		// A paragraph inside the quote may continue on unmarked lines.
+		if !isBlank(line) && len(inner) > 0 && !isBlank(inner[len(inner)-1]) && !startsBlock(line) {
+			inner = append(inner, line)
+			continue
+		}
+		break
+	}
+	b.WriteString("<blockquote>\n")
+	renderBlocks(b, inner, false, depth+1)
+	b.WriteString("</blockquote>\n")
+	return i
+}
+
+type listMarker struct {
+	ok        bool
+	ordered   bool
+	delimiter byte // the bullet character, or '.' or ')' after a number
+	start     int
+	offset    int // column where the item's content starts
+}
+
+func listMarkerOf(line string) listMarker {
+	indent := indentOf(line)
+	if indent >= 4 {
+		return listMarker{}
+	}
+	rest := line[indent:]
+	var m listMarker
+	width := 0
+	switch {
+	case rest == "":
+		return listMarker{}
+	case rest[0] == '-' || rest[0] == '+' || rest[0] == '*':
+		m.delimiter = rest[0]
+		width = 1
+	default:
+		digits := 0
+		for digits < len(rest) && digits < 9 && rest[digits] >= '0' && rest[digits] <= '9' {
+			digits++
+		}
+		if digits == 0 || digits >= len(rest) || (rest[digits] != '.' && rest[digits] != ')') {
+			return listMarker{}
+		}
+		m.ordered = true
+		m.delimiter = rest[digits]
+		m.start, _ = strconv.Atoi(rest[:digits])
+		width = digits + 1
+	}
+
+	after := rest[width:]
+	if after != "" && after[0] != ' ' {
+		return listMarker{}
+	}
+	spaces := indentOf(after)
+	if spaces == 0 || spaces > 4 || spaces == len(after) {
+		// Content indented further is code inside the item; a bare marker
+		// starts an empty item.
+		spaces = 1
+	}
+	m.ok = true
+	m.offset = indent + width + spaces
+	return m
+}
+
+func renderList(b *strings.Builder, lines []string, i, depth int) int {
+	first := listMarkerOf(lines[i])
+	var items [][]string
+	loose := false
+
+	for i < len(lines) {
+		m := listMarkerOf(lines[i])
+		if !m.ok || m.ordered != first.ordered || m.delimiter != first.delimiter {
+			break
+		}
+		item := []string{""}
+		if len(lines[i]) > m.offset {
+			item[0] = lines[i][m.offset:]
+		} else if len(lines[i]) > m.offset-1 {
+			item[0] = strings.TrimLeft(lines[i][m.offset-1:], " ")
+		}
+		i++
+
+		for i < len(lines) {
+			line := lines[i]
+			if isBlank(line) {
+				item = append(item, "")
+				i++
+				continue
+			}
+			if indentOf(line) >= m.offset {
+				item = append(item, line[m.offset:])
+				i++
+				continue
+			}
+			// Lazy continuation of a paragraph in the item.
+			if !isBlank(item[len(item)-1]) && !startsBlock(line) && indentOf(line) < 4 {
+				item = append(item, strings.TrimLeft(line, " "))
+				i++
+				continue
+			}
+			break
+		}
+
+		// Blank lines before the next item make the list loose; trailing
+		// blank lines at the very end do not.
+		trailing := 0
+		for len(item) > 1 && isBlank(item[len(item)-1]) {
+			item = item[:len(item)-1]
+			trailing++
+		}
+		if trailing > 0 && i < len(lines) && listMarkerOf(lines[i]).ok {
+			loose = true
+		}
+		for j := 1; j < len(item)-1; j++ {
+			if isBlank(item[j]) {
+				loose = true
+			}
+		}
+		items = append(items, item)
+
+		// Stop at blank lines that are not followed by another item.
+		if trailing > 0 && (i >= len(lines) || !listMarkerOf(lines[i]).ok) {
+			break
+		}
+	}
+
+	if first.ordered {
+		if first.start != 1 {
+			b.WriteString(`<ol start="` + strconv.Itoa(first.start) + `">` + "\n")
+		} else {
+			b.WriteString("<ol>\n")
+		}
+	} else {
+		b.WriteString("<ul>\n")
+	}
+	for _, item := range items {
+		var inner strings.Builder
+		renderBlocks(&inner, item, !loose, depth+1)
+		b.WriteString("<li>" + strings.TrimSuffix(inner.String(), "\n") + "</li>\n")
+	}
+	if first.ordered {
+		b.WriteString("</ol>\n")
+	} else {
+		b.WriteString("</ul>\n")
+	}
+	return i
+}
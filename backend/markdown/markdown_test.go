@@ -0,0 +1,111 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRenderEscapes(t *testing.T) {
+	tests := []struct {
+		name, source, want string
+	}{
+		{"script tag", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"special characters", `a & b < c > d "e" 'f'`, "<p>a &amp; b &lt; c &gt; d &#34;e&#34; &#39;f&#39;</p>"},
+		{"heading", "# <h1>", "<h1>&lt;h1&gt;</h1>"},
+		{"code span", "`<b>`", "<p><code>&lt;b&gt;</code></p>"},
+		{"fenced code", "```js\n<b>\n```", `<pre><code class="language-js">&lt;b&gt;` + "\n</code></pre>"},
+		{"link destination", `[x](https://example.com/?a="><script>)`,
+			`<p><a href="https://example.com/?a=&#34;&gt;&lt;script&gt;" rel="nofollow ugc noopener">x</a></p>`},
+		{"bare url", "https://example.com/a?b=c&d=e.",
+			`<p><a href="https://example.com/a?b=c&amp;d=e" rel="nofollow ugc noopener">https://example.com/a?b=c&amp;d=e</a>.</p>`},
+		{"emphasis", "*em* **strong** ~~del~~", "<p><em>em</em> <strong>strong</strong> <del>del</del></p>"},
+		{"hard break", "a  \nb", "<p>a<br />\nb</p>"},
+		{"soft break", "a \nb", "<p>a\nb</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.source); got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderLinks(t *testing.T) {
+	tests := []struct {
+		name, source, want string
+	}{
+		{"javascript", "[x](javascript:alert(1))", "<p>x</p>"},
+		{"javascript mixed case", "[x](JavaScript:alert(1))", "<p>x</p>"},
+		{"javascript after spaces", "[x](  javascript:alert(1))", "<p>x</p>"},
+		{"javascript image", "![img](javascript:alert(1))", "<p>img</p>"},
+		{"javascript autolink", "<javascript:alert(1)>", "<p>&lt;javascript:alert(1)&gt;</p>"},
+		{"data", "[x](data:text/html;base64,PHNjcmlwdD4=)", "<p>x</p>"},
+		{"data autolink", "<data:text/html,x>", "<p>&lt;data:text/html,x&gt;</p>"},
+		{"vbscript", "[x](vbscript:msgbox)", "<p>x</p>"},
+		{"https", "[x](https://example.com)", `<p><a href="https://example.com" rel="nofollow ugc noopener">x</a></p>`},
+		{"relative", "[x](/relative)", `<p><a href="/relative" rel="nofollow ugc noopener">x</a></p>`},
+		{"mailto", "[x](mailto:a@b.c)", `<p><a href="mailto:a@b.c" rel="nofollow ugc noopener">x</a></p>`},
+		{"autolink", "<https://example.com>",
+			`<p><a href="https://example.com" rel="nofollow ugc noopener">https://example.com</a></p>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.source); got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderNestingLimit(t *testing.T) {
+	for _, marker := range []string{"> ", "- "} {
+		got := Render(strings.Repeat(marker, 1000) + "x")
+		for _, tag := range []string{"<blockquote>", "<ul>"} {
+			if n := strings.Count(got, tag); n > maxNesting {
+				t.Errorf("Render(%q...) nests %d %s, want at most %d", marker, n, tag, maxNesting)
+			}
+		}
+	}
+}
+
+var (
+	tagPattern  = regexp.MustCompile(`<(/?)([A-Za-z0-9]+)([^>]*)>`)
+	hrefPattern = regexp.MustCompile(`href="([^"]*)"`)
+	allowedTags = map[string]bool{
+		"p": true, "br": true, "hr": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+		"blockquote": true, "ul": true, "ol": true, "li": true, "pre": true, "code": true,
+		"em": true, "strong": true, "del": true, "a": true, "span": true,
+	}
+)
+
+// FuzzRender checks that whatever the source, only the documented tags come
+// out and links never point at a script or data URL.
+func FuzzRender(f *testing.F) {
+	for _, seed := range []string{
+		"<script>alert(1)</script>",
+		"[x](javascript:alert(1))",
+		"[x](data:text/html,<b>)",
+		"> - *a* `b` [c](https://example.com \"t\")\n\n    code",
+		"```go\nfunc main() { fmt.Println(\"<b>\") }\n```",
+		"1. a\n2. b\n\n- c\n  > d",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, source string) {
+		out := Render(source)
+		for _, m := range tagPattern.FindAllStringSubmatch(out, -1) {
+			if !allowedTags[m[2]] {
+				t.Fatalf("Render(%q) produced tag %q", source, m[0])
+			}
+		}
+		for _, m := range hrefPattern.FindAllStringSubmatch(out, -1) {
+			href := strings.ToLower(strings.TrimSpace(html.UnescapeString(m[1])))
+			if strings.HasPrefix(href, "javascript:") || strings.HasPrefix(href, "data:") {
+				t.Fatalf("Render(%q) linked to %q", source, m[1])
+			}
+		}
+	})
+}
@@ -0,0 +1,161 @@
+// Package mentions finds @nickname mentions in post, comment and message
+// text. It only parses; resolving names to users is up to the caller.
+package mentions
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxNameLength is the longest name, in characters, read after an "@".
+const MaxNameLength = 50
+
+// Span is one mention. Start and End are offsets in UTF-16 code units, the
+// way JavaScript indexes strings, and include the "@".
+type Span struct {
+	Name  string
+	Start int
+	End   int
+}
+
+// Find returns the mentions in text in order. A mention is an "@" that does
+// not follow a name character or a backslash, followed by letters, digits,
+// "_", "-" or "."; a trailing "." or "-" ends the sentence rather than the
+// name. Mentions inside markdown code spans and fenced code blocks are
+// ignored.
+func Find(text string) []Span {
+	var spans []Span
+	offset := 0 // UTF-16 offset of the current line
+	fence := ""
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if marker := fenceMarker(trimmed); marker != "" && (fence == "" || strings.HasPrefix(marker, fence)) {
+			if fence == "" {
+				fence = marker
+			} else {
+				fence = ""
+			}
+		} else if fence == "" {
+			spans = findInLine(line, offset, spans)
+		}
+		offset += utf16Len(line)
+	}
+	return spans
+}
+
+// fenceMarker returns the run of backticks or tildes opening line, if it is
+// long enough to open or close a fenced code block.
+func fenceMarker(line string) string {
+	if line == "" || (line[0] != '`' && line[0] != '~') {
+		return ""
+	}
+	n := 0
+	for n < len(line) && line[n] == line[0] {
+		n++
+	}
+	if n < 3 {
+		return ""
+	}
+	return line[:n]
+}
+
+func findInLine(line string, offset int, spans []Span) []Span {
+	pos := offset
+	prev := rune(0)
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+
+		if r == '`' {
+			// Skip a code span up to a closing run of the same length.
+			n := 0
+			for i+n < len(line) && line[i+n] == '`' {
+				n++
+			}
+			run := line[i : i+n]
+			end := i + n
+			if close := closingRun(line[end:], run); close >= 0 {
+				end += close + n
+			}
+			pos += utf16Len(line[i:end])
+			i = end
+			prev = '`'
+			continue
+		}
+
+		if r == '@' && !isNameRune(prev) && prev != '\\' && prev != '@' {
+			if name := readName(line[i+1:]); name != "" {
+				length := 1 + utf16Len(name)
+				spans = append(spans, Span{Name: name, Start: pos, End: pos + length})
+				pos += length
+				i += 1 + len(name)
+				prev, _ = utf8.DecodeLastRuneInString(name)
+				continue
+			}
+		}
+
+		pos += utf16RuneLen(r)
+		i += size
+		prev = r
+	}
+	return spans
+}
+
+// closingRun finds run in s where it is not part of a longer run of
+// backticks, or returns -1.
+func closingRun(s, run string) int {
+	for i := 0; i < len(s); {
+		j := strings.Index(s[i:], run)
+		if j < 0 {
+			return -1
+		}
+		start := i + j
+		end := start + len(run)
+		if (start == 0 || s[start-1] != '`') && (end == len(s) || s[end] != '`') {
+			return start
+		}
+		i = end
+		for i < len(s) && s[i] == '`' {
+			i++
+		}
+	}
+	return -1
+}
+
+func readName(s string) string {
+	end, count := 0, 0
+	for end < len(s) && count < MaxNameLength {
+		r, size := utf8.DecodeRuneInString(s[end:])
+		if !isNameRune(r) {
+			break
+		}
+		end += size
+		count++
+	}
+	if end < len(s) && count == MaxNameLength {
+		if r, _ := utf8.DecodeRuneInString(s[end:]); isNameRune(r) {
+			return ""
+		}
+	}
+	return strings.TrimRight(s[:end], ".-")
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.'
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16RuneLen(r)
+	}
+	return n
+}
+
+// utf16RuneLen is the number of UTF-16 code units encoding r.
+func utf16RuneLen(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
@@ -13,20 +13,188 @@ type User struct {
 }
 
 type Post struct {
-	ID        string `json:"id"`
-	UserID    string `json:"user_id"`
-	Nickname  string `json:"nickname,omitempty"`
-	Category  string `json:"category"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
+	ID             string         `json:"id"`
+	UserID         string         `json:"user_id"`
+	Nickname       string         `json:"nickname,omitempty"`
+	Title          string         `json:"title"`
+	Slug           string         `json:"slug"`
+	Category       string         `json:"category"`
+	Categories     []string       `json:"categories"`
+	Tags           []string       `json:"tags"`
+	Content        string         `json:"content"`
+	ContentHTML    string         `json:"content_html"`
+	CreatedAt      string         `json:"created_at"`
+	Edited         bool           `json:"edited"`
+	EditedAt       string         `json:"edited_at,omitempty"`
+	Deleted        bool           `json:"deleted,omitempty"`
+	Hidden         bool           `json:"hidden,omitempty"`
+	Pinned         bool           `json:"pinned"`
+	Locked         bool           `json:"locked"`
+	Reactions      map[string]int `json:"reactions"`
+	MyReactions    []string       `json:"my_reactions"`
+	CommentCount   int            `json:"comment_count"`
+	LastCommentAt  string         `json:"last_comment_at,omitempty"`
+	LastCommenter  string         `json:"last_commenter,omitempty"`
+	LastActivityAt string         `json:"last_activity_at"`
+	AttachmentIDs  []string       `json:"attachment_ids,omitempty"`
+	Attachments    []Attachment   `json:"attachments"`
+	Saved          bool           `json:"saved"`
+	BookmarkFolder string         `json:"bookmark_folder,omitempty"`
+	SavedAt        string         `json:"saved_at,omitempty"`
+	Subscribed     bool           `json:"subscribed"`
+	Mentions       []Mention      `json:"mentions"`
+	Poll           *Poll          `json:"poll,omitempty"`
 }
 
-type Comment struct {
+// Poll is a vote attached to a post. Voters are only listed on polls that
+// are not anonymous, and MyVotes holds the options the viewer chose.
+type Poll struct {
+	ID        string       `json:"id"`
+	Question  string       `json:"question"`
+	Multiple  bool         `json:"multiple"`
+	Anonymous bool         `json:"anonymous"`
+	ClosesAt  string       `json:"closes_at,omitempty"`
+	Closed    bool         `json:"closed"`
+	Options   []PollOption `json:"options"`
+	Voters    int          `json:"voters"`
+	MyVotes   []string     `json:"my_votes"`
+}
+
+type PollOption struct {
+	ID     string   `json:"id"`
+	Text   string   `json:"text"`
+	Votes  int      `json:"votes"`
+	Voters []string `json:"voters,omitempty"`
+}
+
+// Mention is an @nickname in some content that resolved to a user. Start
+// and End are UTF-16 offsets into the content and include the "@".
+type Mention struct {
+	UserID   string `json:"user_id"`
+	Nickname string `json:"nickname"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// Notification tells a user about activity on a post they follow or on
+// something they wrote. Detail names the reaction or moderation action.
+type Notification struct {
 	ID        string `json:"id"`
+	Type      string `json:"type"`
 	PostID    string `json:"post_id"`
-	UserID    string `json:"user_id"`
-	Content   string `json:"content"`
+	PostTitle string `json:"post_title"`
+	PostSlug  string `json:"post_slug"`
+	CommentID string `json:"comment_id,omitempty"`
+	ActorID   string `json:"actor_id,omitempty"`
+	Actor     string `json:"actor,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+	ReportID  string `json:"report_id,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
+	Target    string `json:"target,omitempty"`
 	CreatedAt string `json:"created_at"`
+	Read      bool   `json:"read"`
+}
+
+// Attachment is an uploaded image. The original and its thumbnail are
+// served from URL and ThumbnailURL.
+type Attachment struct {
+	ID           string `json:"id"`
+	Filename     string `json:"filename"`
+	ContentType  string `json:"content_type"`
+	Size         int    `json:"size"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// ModerationAction is an entry in the moderation log. Detail says what a
+// move changed, as "old categories -> new categories".
+type ModerationAction struct {
+	ID          string `json:"id"`
+	Action      string `json:"action"`
+	ModeratorID string `json:"moderator_id"`
+	Moderator   string `json:"moderator"`
+	TargetType  string `json:"target_type"`
+	TargetID    string `json:"target_id"`
+	PostID      string `json:"post_id,omitempty"`
+	PostTitle   string `json:"post_title,omitempty"`
+	Detail      string `json:"detail,omitempty"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// ReportCase groups the reports about one post, comment, message or user
+// until staff resolve it. Preview is the post title, the start of the
+// comment or message, or the user's nickname. FilterReason is set when the
+// content filters held the target for review.
+type ReportCase struct {
+	ID             string   `json:"id"`
+	TargetType     string   `json:"target_type"`
+	TargetID       string   `json:"target_id"`
+	PostID         string   `json:"post_id,omitempty"`
+	Preview        string   `json:"preview"`
+	AuthorID       string   `json:"author_id"`
+	Author         string   `json:"author"`
+	Hidden         bool     `json:"hidden"`
+	Status         string   `json:"status"`
+	ClaimedBy      string   `json:"claimed_by,omitempty"`
+	Claimer        string   `json:"claimer,omitempty"`
+	ResolvedBy     string   `json:"resolved_by,omitempty"`
+	Action         string   `json:"action,omitempty"`
+	ResolutionNote string   `json:"resolution_note,omitempty"`
+	FilterReason   string   `json:"filter_reason,omitempty"`
+	CreatedAt      string   `json:"created_at"`
+	ResolvedAt     string   `json:"resolved_at,omitempty"`
+	Reports        []Report `json:"reports"`
+}
+
+type Report struct {
+	ID         string `json:"id"`
+	ReporterID string `json:"reporter_id"`
+	Reporter   string `json:"reporter"`
+	Reason     string `json:"reason"`
+	Note       string `json:"note,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type Revision struct {
+	ID             string `json:"id"`
+	Action         string `json:"action"`
+	Title          string `json:"title,omitempty"`
+	Content        string `json:"content"`
+	EditorID       string `json:"editor_id"`
+	EditorNickname string `json:"editor_nickname"`
+	CreatedAt      string `json:"created_at"`
+}
+
+type Category struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Color       string `json:"color"`
+	SortOrder   int    `json:"sort_order"`
+	PostCount   int    `json:"post_count"`
+}
+
+// Tag is a free-form label on posts. Banned and MergedInto are only shown
+// to admins.
+type Tag struct {
+	Name       string `json:"name"`
+	PostCount  int    `json:"post_count"`
+	Banned     bool   `json:"banned,omitempty"`
+	MergedInto string `json:"merged_into,omitempty"`
+}
+
+type Comment struct {
+	ID              string       `json:"id"`
+	PostID          string       `json:"post_id"`
+	ParentCommentID string       `json:"parent_comment_id,omitempty"`
+	UserID          string       `json:"user_id"`
+	Content         string       `json:"content"`
+	CreatedAt       string       `json:"created_at"`
+	AttachmentIDs   []string     `json:"attachment_ids,omitempty"`
+	Attachments     []Attachment `json:"attachments,omitempty"`
 }
 
 type LoginRequest struct {
@@ -35,11 +203,28 @@ type LoginRequest struct {
 }
 
 type Message struct {
-	ID             string `json:"id"`
-	SenderID       string `json:"sender_id"`
-	SenderNickname string `json:"sender_nickname,omitempty"`
-	ReceiverID     string `json:"receiver_id"`
-	Content        string `json:"content"`
-	CreatedAt      string `json:"created_at"`
-	Sequence       int    `json:"sequence"`
+	ID             string    `json:"id"`
+	SenderID       string    `json:"sender_id"`
+	SenderNickname string    `json:"sender_nickname,omitempty"`
+	ReceiverID     string    `json:"receiver_id"`
+	Content        string    `json:"content"`
+	CreatedAt      string    `json:"created_at"`
+	Sequence       int       `json:"sequence"`
+	Mentions       []Mention `json:"mentions,omitempty"`
+	Hidden         bool      `json:"hidden,omitempty"`
+}
+
+// Draft is a post, comment or reply its author has not published yet.
+// Context says which: "post", "comment:{post id}" or "reply:{comment id}".
+// PostTitle and ParentAuthor describe what a comment or reply answers.
+type Draft struct {
+	Context         string `json:"context"`
+	PostID          string `json:"post_id,omitempty"`
+	PostTitle       string `json:"post_title,omitempty"`
+	ParentCommentID string `json:"parent_comment_id,omitempty"`
+	ParentAuthor    string `json:"parent_author,omitempty"`
+	Title           string `json:"title"`
+	Content         string `json:"content"`
+	CreatedAt       string `json:"created_at"`
+	UpdatedAt       string `json:"updated_at"`
 }
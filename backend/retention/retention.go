@@ -0,0 +1,355 @@
+package retention
+
+import (
+	"database/sql"
+	"log"
+	"real-time-forum/backend/config"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/storage"
+	"real-time-forum/backend/utils"
+	"sync"
+	"time"
+)
+
+type AccountSummary struct {
+	ID         string `json:"id"`
+	Nickname   string `json:"nickname"`
+	CreatedAt  string `json:"created_at,omitempty"`
+	LastSeenAt string `json:"last_seen_at,omitempty"`
+}
+
+// Report describes what a retention run removes (or would remove, when it
+// is a dry run or a preview).
+type Report struct {
+	DryRun             bool             `json:"dry_run"`
+	Messages           int              `json:"messages"`
+	UnverifiedAccounts []AccountSummary `json:"unverified_accounts"`
+	InactiveAccounts   []AccountSummary `json:"inactive_accounts"`
+	UnattachedUploads  int              `json:"unattached_uploads"`
+	GeneratedAt        string           `json:"generated_at"`
+}
+
+var (
+	mutex   = &sync.Mutex{}
+	nextRun time.Time
+	lastRun *Report
+)
+
+// Start runs the retention job every config.RetentionInterval.
+func Start() {
+	mutex.Lock()
+	nextRun = time.Now().Add(config.RetentionInterval)
+	mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(config.RetentionInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			mutex.Lock()
+			nextRun = time.Now().Add(config.RetentionInterval)
+			mutex.Unlock()
+
+			report, err := Run(config.RetentionDryRun)
+			if err != nil {
+				log.Println("Error running retention job:", err)
+				continue
+			}
+			format := "Retention run deleted %d messages, purged %d unverified accounts, anonymized %d inactive accounts and deleted %d unattached uploads"
+			if report.DryRun {
+				format = "Retention dry run would delete %d messages, purge %d unverified accounts, anonymize %d inactive accounts and delete %d unattached uploads"
+			}
+			log.Printf(format, report.Messages, len(report.UnverifiedAccounts), len(report.InactiveAccounts), report.UnattachedUploads)
+		}
+	}()
+}
+
+// NextRun returns when the job will run next and the report of the last run.
+func NextRun() (time.Time, *Report) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return nextRun, lastRun
+}
+
+// Preview reports what the next run would remove without changing anything.
+func Preview() (Report, error) {
+	return collect(database.DB, true)
+}
+
+// Run applies every retention policy. With dryRun it only reports.
+func Run(dryRun bool) (Report, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return Report{}, err
+	}
+	defer tx.Rollback()
+
+	report, err := collect(tx, dryRun)
+	if err != nil {
+		return report, err
+	}
+
+	if !dryRun {
+		blobKeys, err := apply(tx)
+		if err != nil {
+			return report, err
+		}
+		if err := tx.Commit(); err != nil {
+			return report, err
+		}
+		var userIDs []string
+		for _, a := range append(report.UnverifiedAccounts, report.InactiveAccounts...) {
+			userIDs = append(userIDs, a.ID)
+		}
+		utils.DestroyUserSessions(userIDs...)
+		deleteBlobs(blobKeys)
+	}
+
+	mutex.Lock()
+	lastRun = &report
+	mutex.Unlock()
+	return report, nil
+}
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func cutoff(days int) string {
+	return utils.FormatTime(time.Now().AddDate(0, 0, -days))
+}
+
+// expiredMessages selects messages past either the deployment-wide limit
+// or their conversation's own opt-in limit, whichever is stricter.
+func expiredMessages() (string, []interface{}) {
+	globalDays := config.MessageRetentionDays
+	globalApplies := globalDays > 0 && !config.MessageRetentionOptIn
+	query := `
+		SELECT m.rowid FROM messages m
+		LEFT JOIN conversation_retention cr
+			ON cr.user_a = min(m.sender_id, m.receiver_id) AND cr.user_b = max(m.sender_id, m.receiver_id)
+		WHERE (cr.days IS NOT NULL AND m.created_at < strftime('%Y-%m-%dT%H:%M:%fZ', 'now', '-' || cr.days || ' days'))
+			OR (? AND m.created_at < ?)`
+	return query, []interface{}{globalApplies, cutoff(globalDays)}
+}
+
+// unverifiedAccounts selects accounts that never signed in, have no content
+// and were created before the configured window.
+func unverifiedAccounts() (string, []interface{}, bool) {
+	days := config.UnverifiedAccountDays
+	query := `
+		SELECT u.id, u.nickname, COALESCE(u.created_at, ''), '' FROM users u
+		WHERE u.role = 'user' AND u.last_seen_at IS NULL AND u.anonymized_at IS NULL AND u.created_at < ?
+			AND NOT EXISTS (SELECT 1 FROM posts WHERE user_id = u.id)
+			AND NOT EXISTS (SELECT 1 FROM comments WHERE user_id = u.id)
+			AND NOT EXISTS (SELECT 1 FROM messages WHERE sender_id = u.id OR receiver_id = u.id)`
+	return query, []interface{}{cutoff(days)}, days > 0
+}
+
+// inactiveAccounts selects regular accounts not seen within the window.
+func inactiveAccounts() (string, []interface{}, bool) {
+	days := config.InactiveAccountDays
+	query := `
+		SELECT id, nickname, COALESCE(created_at, ''), last_seen_at FROM users
+		WHERE role = 'user' AND anonymized_at IS NULL AND last_seen_at < ?`
+	return query, []interface{}{cutoff(days)}, days > 0
+}
+
+// unattachedUploads selects uploads that were never attached to a post or
+// comment within the window.
+func unattachedUploads() (string, []interface{}, bool) {
+	hours := config.UnattachedUploadHours
+	query := `SELECT id FROM attachments WHERE target_id IS NULL AND created_at < ?`
+	return query, []interface{}{utils.FormatTime(time.Now().Add(-time.Duration(hours) * time.Hour))}, hours > 0
+}
+
+func collect(q querier, dryRun bool) (Report, error) {
+	report := Report{
+		DryRun:             dryRun,
+		UnverifiedAccounts: []AccountSummary{},
+		InactiveAccounts:   []AccountSummary{},
+		GeneratedAt:        utils.Now(),
+	}
+
+	query, args := expiredMessages()
+	if err := q.QueryRow("SELECT COUNT(*) FROM ("+query+")", args...).Scan(&report.Messages); err != nil {
+		return report, err
+	}
+
+	var err error
+	if query, args, enabled := unverifiedAccounts(); enabled {
+		if report.UnverifiedAccounts, err = listAccounts(q, query, args); err != nil {
+			return report, err
+		}
+	}
+	if query, args, enabled := inactiveAccounts(); enabled {
+		if report.InactiveAccounts, err = listAccounts(q, query, args); err != nil {
+			return report, err
+		}
+	}
+	if query, args, enabled := unattachedUploads(); enabled {
+		if err := q.QueryRow("SELECT COUNT(*) FROM ("+query+")", args...).Scan(&report.UnattachedUploads); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func listAccounts(q querier, query string, args []interface{}) ([]AccountSummary, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []AccountSummary{}
+	for rows.Next() {
+		var a AccountSummary
+		if err := rows.Scan(&a.ID, &a.Nickname, &a.CreatedAt, &a.LastSeenAt); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+// messageDependents delete what refers to the messages in
+// temp.retention_messages: mentions and the notifications about them, and
+// report cases with their reports and the notifications about them. Foreign keys are not enforced, so nothing
+// else removes them.
+var messageDependents = []string{
+	`DELETE FROM mentions WHERE target_type = 'message' AND target_id IN (SELECT id FROM temp.retention_messages)`,
+	`DELETE FROM notifications WHERE message_id IN (SELECT id FROM temp.retention_messages)`,
+	`DELETE FROM notifications WHERE report_id IN (SELECT id FROM report_cases
+		WHERE target_type = 'message' AND target_id IN (SELECT id FROM temp.retention_messages))`,
+	`DELETE FROM reports WHERE case_id IN (SELECT id FROM report_cases
+		WHERE target_type = 'message' AND target_id IN (SELECT id FROM temp.retention_messages))`,
+	`DELETE FROM report_cases WHERE target_type = 'message' AND target_id IN (SELECT id FROM temp.retention_messages)`,
+}
+
+// userDependents delete the rows of the accounts in temp.retention_users
+// that other tables keep about them.
+var userDependents = []string{
+	`DELETE FROM reactions WHERE user_id IN (SELECT id FROM temp.retention_users)`,
+	`DELETE FROM bookmarks WHERE user_id IN (SELECT id FROM temp.retention_users)`,
+	`DELETE FROM post_subscriptions WHERE user_id IN (SELECT id FROM temp.retention_users)`,
+	`DELETE FROM notification_preferences WHERE user_id IN (SELECT id FROM temp.retention_users)`,
+	`DELETE FROM notifications WHERE user_id IN (SELECT id FROM temp.retention_users)
+		OR actor_id IN (SELECT id FROM temp.retention_users)`,
+	`DELETE FROM mentions WHERE user_id IN (SELECT id FROM temp.retention_users)`,
+	`DELETE FROM drafts WHERE user_id IN (SELECT id FROM temp.retention_users)`,
+	`DELETE FROM attachments WHERE user_id IN (SELECT id FROM temp.retention_users)`,
+	`DELETE FROM poll_votes WHERE user_id IN (SELECT id FROM temp.retention_users)`,
+	`DELETE FROM conversation_retention WHERE user_a IN (SELECT id FROM temp.retention_users)
+		OR user_b IN (SELECT id FROM temp.retention_users)`,
+	`DELETE FROM reports WHERE reporter_id IN (SELECT id FROM temp.retention_users)
+		OR case_id IN (SELECT id FROM report_cases WHERE target_type = 'user' AND target_id IN (SELECT id FROM temp.retention_users))`,
+	`DELETE FROM notifications WHERE report_id IN (SELECT id FROM report_cases
+		WHERE target_type = 'user' AND target_id IN (SELECT id FROM temp.retention_users))`,
+	`DELETE FROM report_cases WHERE target_type = 'user' AND target_id IN (SELECT id FROM temp.retention_users)`,
+}
+
+// deleteWith fills temp table with the ids query selects, runs dependents
+// and then deletes the rows themselves from table.
+func deleteWith(tx *sql.Tx, temp, table, query string, args []interface{}, dependents []string) error {
+	if _, err := tx.Exec("CREATE TEMP TABLE "+temp+" AS SELECT id FROM ("+query+")", args...); err != nil {
+		return err
+	}
+	statements := append(append([]string{}, dependents...),
+		"DELETE FROM "+table+" WHERE id IN (SELECT id FROM temp."+temp+")",
+		"DROP TABLE temp."+temp)
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply removes and anonymizes what collect reported. It returns the keys
+// of stored files that belonged to removed rows, to delete once the
+// transaction has committed.
+func apply(tx *sql.Tx) ([]string, error) {
+	query, args := expiredMessages()
+	err := deleteWith(tx, "retention_messages", "messages",
+		"SELECT id FROM messages WHERE rowid IN ("+query+")", args, messageDependents)
+	if err != nil {
+		return nil, err
+	}
+
+	var blobKeys []string
+	if query, args, enabled := unverifiedAccounts(); enabled {
+		// Such accounts have no posts or comments, but may have uploads
+		// they never attached.
+		blobKeys, err = attachmentBlobs(tx, "user_id IN (SELECT id FROM ("+query+"))", args)
+		if err != nil {
+			return nil, err
+		}
+		if err := deleteWith(tx, "retention_users", "users", query, args, userDependents); err != nil {
+			return nil, err
+		}
+	}
+
+	// Anonymized accounts keep their ID so posts, comments and messages stay
+	// attached, but lose every personal field and unpublished draft and can
+	// no longer sign in.
+	if query, args, enabled := inactiveAccounts(); enabled {
+		if _, err := tx.Exec("DELETE FROM drafts WHERE user_id IN (SELECT id FROM ("+query+"))", args...); err != nil {
+			return nil, err
+		}
+		_, err := tx.Exec(`
+			UPDATE users SET
+				nickname = 'deleted-' || id,
+				email = id || '@deleted.invalid',
+				password = '',
+				first_name = '',
+				last_name = '',
+				age = 0,
+				gender = '',
+				anonymized_at = ?
+			WHERE id IN (SELECT id FROM (`+query+`))`, append([]interface{}{utils.Now()}, args...)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if query, args, enabled := unattachedUploads(); enabled {
+		keys, err := attachmentBlobs(tx, "id IN ("+query+")", args)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("DELETE FROM attachments WHERE id IN ("+query+")", args...); err != nil {
+			return nil, err
+		}
+		blobKeys = append(blobKeys, keys...)
+	}
+	return blobKeys, nil
+}
+
+// attachmentBlobs returns the stored files of the attachments matching where.
+func attachmentBlobs(tx *sql.Tx, where string, args []interface{}) ([]string, error) {
+	rows, err := tx.Query("SELECT blob_key, thumbnail_key FROM attachments WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var blobKey, thumbnailKey string
+		if err := rows.Scan(&blobKey, &thumbnailKey); err != nil {
+			return nil, err
+		}
+		keys = append(keys, blobKey, thumbnailKey)
+	}
+	return keys, rows.Err()
+}
+
+// deleteBlobs removes stored files whose rows are gone. Failures are only
+// logged; the files are unreachable either way.
+func deleteBlobs(keys []string) {
+	for _, key := range keys {
+		if err := storage.Blobs.Delete(key); err != nil {
+			log.Printf("Failed to delete blob %s: %v", key, err)
+		}
+	}
+}
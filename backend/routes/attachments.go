@@ -0,0 +1,381 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"real-time-forum/backend/config"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/images"
+	"real-time-forum/backend/models"
+	"real-time-forum/backend/storage"
+	"real-time-forum/backend/utils"
+	"strings"
+
+	"github.com/gofrs/uuid"
+)
+
+const maxFilenameLength = 255
+
+// UploadAttachmentHandler accepts one image as the "file" field of a
+// multipart form. The image is checked, stripped of metadata and stored with
+// a thumbnail; its id can then be passed as attachment_ids when creating a
+// post or comment.
+func UploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	maxBytes := int64(config.AttachmentMaxBytes)
+	tooLarge := fmt.Sprintf("Images must be at most %.1f MB", float64(maxBytes)/(1<<20))
+	// Leave room for the multipart headers around the file.
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+64<<10)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, tooLarge, http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Missing file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		http.Error(w, "Failed to read upload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > maxBytes {
+		http.Error(w, tooLarge, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	img, err := images.Process(data, config.ThumbnailSize)
+	if errors.Is(err, images.ErrUnsupported) || errors.Is(err, images.ErrInvalid) || errors.Is(err, images.ErrTooLarge) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to process image: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id := uuid.Must(uuid.NewV4()).String()
+	blobKey := "attachments/" + id
+	thumbnailKey := "attachments/" + id + "-thumb"
+	if err := storage.Blobs.Put(blobKey, img.Data, img.ContentType); err != nil {
+		http.Error(w, "Failed to store image: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := storage.Blobs.Put(thumbnailKey, img.Thumbnail, img.ThumbnailType); err != nil {
+		deleteBlobs(blobKey)
+		http.Error(w, "Failed to store image: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	attachment := models.Attachment{
+		ID:          id,
+		Filename:    cleanFilename(header.Filename),
+		ContentType: img.ContentType,
+		Size:        len(img.Data),
+		Width:       img.Width,
+		Height:      img.Height,
+		CreatedAt:   utils.Now(),
+	}
+	setAttachmentURLs(&attachment)
+	_, err = database.DB.Exec(`
+		INSERT INTO attachments (id, user_id, filename, content_type, size, width, height,
+			blob_key, thumbnail_key, thumbnail_type, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		attachment.ID, currentUserID, attachment.Filename, attachment.ContentType, attachment.Size,
+		attachment.Width, attachment.Height, blobKey, thumbnailKey, img.ThumbnailType, attachment.CreatedAt)
+	if err != nil {
+		deleteBlobs(blobKey, thumbnailKey)
+		http.Error(w, "Failed to save attachment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// cleanFilename keeps the base name of an uploaded file for display.
+func cleanFilename(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, `\`, "/")))
+	if name == "." || name == "/" {
+		return ""
+	}
+	if runes := []rune(name); len(runes) > maxFilenameLength {
+		name = string(runes[:maxFilenameLength])
+	}
+	return name
+}
+
+func setAttachmentURLs(a *models.Attachment) {
+	a.URL = "/api/attachments/" + a.ID
+	a.ThumbnailURL = "/api/attachments/" + a.ID + "/thumbnail"
+}
+
+// deleteBlobs removes stored files that are no longer referenced. Failures
+// are only logged, as the upload they belonged to has already failed.
+func deleteBlobs(keys ...string) {
+	for _, key := range keys {
+		if err := storage.Blobs.Delete(key); err != nil {
+			log.Printf("Failed to delete blob %s: %v", key, err)
+		}
+	}
+}
+
+// storedAttachment is what is needed to serve or delete an attachment.
+// targetRemoved is set when the post or comment it is attached to is deleted
+// or hidden pending review, or belongs to a post that is.
+type storedAttachment struct {
+	userID        string
+	targetType    string
+	targetRemoved bool
+	contentType   string
+	blobKey       string
+	thumbnailKey  string
+	thumbnailType string
+}
+
+func loadStoredAttachment(id string) (storedAttachment, error) {
+	var a storedAttachment
+	err := database.DB.QueryRow(`
+		SELECT a.user_id, COALESCE(a.target_type, ''), a.content_type, a.blob_key, a.thumbnail_key, a.thumbnail_type,
+			CASE a.target_type
+				WHEN 'post' THEN COALESCE((
+					SELECT deleted_at IS NOT NULL OR hidden_at IS NOT NULL FROM posts WHERE id = a.target_id), 1)
+				WHEN 'comment' THEN COALESCE((
+					SELECT c.deleted_at IS NOT NULL OR c.hidden_at IS NOT NULL OR p.deleted_at IS NOT NULL OR p.hidden_at IS NOT NULL
+					FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.id = a.target_id), 1)
+				ELSE 0
+			END
+		FROM attachments a WHERE a.id = ?`, id).Scan(&a.userID, &a.targetType, &a.contentType, &a.blobKey,
+		&a.thumbnailKey, &a.thumbnailType, &a.targetRemoved)
+	return a, err
+}
+
+// AttachmentHandler serves an attachment (GET) or lets its uploader discard
+// it before it has been attached to anything (DELETE).
+func AttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		serveAttachment(w, r, false)
+	case http.MethodDelete:
+		deleteAttachment(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func AttachmentThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	serveAttachment(w, r, true)
+}
+
+// serveAttachment streams an image from the blob store. Attachments that are
+// not attached yet are only visible to their uploader, and those of deleted
+// or hidden posts and comments only to the uploader and moderators.
+func serveAttachment(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	a, err := loadStoredAttachment(r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch attachment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	visible := a.targetType != "" && !a.targetRemoved
+	if !visible && a.targetType != "" {
+		if visible, err = canModerate(currentUserID, a.userID); err != nil {
+			http.Error(w, "Failed to check permissions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if !visible && currentUserID != a.userID {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+
+	key, contentType := a.blobKey, a.contentType
+	if thumbnail {
+		key, contentType = a.thumbnailKey, a.thumbnailType
+	}
+	blob, err := storage.Blobs.Get(key)
+	if err == storage.ErrNotFound {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch attachment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", "inline")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	io.Copy(w, blob)
+}
+
+func deleteAttachment(w http.ResponseWriter, r *http.Request) {
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	a, err := loadStoredAttachment(id)
+	if err == sql.ErrNoRows || (err == nil && a.userID != currentUserID) {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch attachment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if a.targetType != "" {
+		http.Error(w, "Attachment is already in use", http.StatusConflict)
+		return
+	}
+
+	res, err := database.DB.Exec("DELETE FROM attachments WHERE id = ? AND target_id IS NULL", id)
+	if err != nil {
+		http.Error(w, "Failed to delete attachment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Attachment is already in use", http.StatusConflict)
+		return
+	}
+	deleteBlobs(a.blobKey, a.thumbnailKey)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkAttachments validates the attachment ids sent with a new post or
+// comment: each must be an unattached upload of userID. Duplicates are
+// dropped.
+func checkAttachments(userID string, ids []string) ([]string, error) {
+	var unique []string
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		var ownerID string
+		var attached bool
+		err := database.DB.QueryRow("SELECT user_id, target_id IS NOT NULL FROM attachments WHERE id = ?", id).Scan(&ownerID, &attached)
+		if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+			return nil, errors.New("Unknown attachment: " + id)
+		} else if err != nil {
+			return nil, err
+		}
+		if attached {
+			return nil, errors.New("Attachment is already in use: " + id)
+		}
+		unique = append(unique, id)
+	}
+	if len(unique) > config.AttachmentsPerItem {
+		return nil, fmt.Errorf("At most %d images can be attached", config.AttachmentsPerItem)
+	}
+	return unique, nil
+}
+
+// attachAttachments links uploads checked by checkAttachments to a new post
+// or comment.
+func attachAttachments(tx *sql.Tx, userID, targetType, targetID string, ids []string) error {
+	for _, id := range ids {
+		res, err := tx.Exec(`
+			UPDATE attachments SET target_type = ?, target_id = ?
+			WHERE id = ? AND user_id = ? AND target_id IS NULL`,
+			targetType, targetID, id, userID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return errors.New("attachment " + id + " is already in use")
+		}
+	}
+	return nil
+}
+
+// loadAttachments returns the attachments of each of ids in upload order.
+func loadAttachments(targetType string, ids []string) (map[string][]models.Attachment, error) {
+	attachments := make(map[string][]models.Attachment, len(ids))
+	if len(ids) == 0 {
+		return attachments, nil
+	}
+	placeholders := make([]string, len(ids))
+	args := []interface{}{targetType}
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args = append(args, id)
+		attachments[id] = []models.Attachment{}
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT target_id, id, filename, content_type, size, width, height, CAST(created_at AS TEXT)
+		FROM attachments
+		WHERE target_type = ? AND target_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY created_at ASC, id ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var targetID string
+		var a models.Attachment
+		if err := rows.Scan(&targetID, &a.ID, &a.Filename, &a.ContentType, &a.Size, &a.Width, &a.Height, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		setAttachmentURLs(&a)
+		attachments[targetID] = append(attachments[targetID], a)
+	}
+	return attachments, rows.Err()
+}
+
+// loadPostAttachments fills in Attachments for every post. Deleted posts
+// show none.
+func loadPostAttachments(posts []models.Post) error {
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	attachments, err := loadAttachments("post", ids)
+	if err != nil {
+		return err
+	}
+	for i, post := range posts {
+		posts[i].Attachments = attachments[post.ID]
+		if post.Deleted || post.Hidden {
+			posts[i].Attachments = []models.Attachment{}
+		}
+	}
+	return nil
+}
@@ -81,9 +81,9 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	user.Password = string(hashedPassword)
 
 	_, err = database.DB.Exec(`
-		INSERT INTO users (id, nickname, email, password, first_name, last_name, age, gender)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		user.ID, user.Nickname, user.Email, user.Password, user.FirstName, user.LastName, user.Age, user.Gender)
+		INSERT INTO users (id, nickname, email, password, first_name, last_name, age, gender, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.ID, user.Nickname, user.Email, user.Password, user.FirstName, user.LastName, user.Age, user.Gender, utils.Now())
 	if err != nil {
 		errorMsg := fmt.Sprintf("Failed to create user: %v", err.Error())
 		http.Error(w, errorMsg, http.StatusInternalServerError)
@@ -107,13 +107,14 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var user models.User
+	var role string
 	// Case-insensitive query
 	row := database.DB.QueryRow(`
-		SELECT id, nickname, email, password FROM users
+		SELECT id, nickname, email, password, role FROM users
 		WHERE LOWER(email) = LOWER(?) OR LOWER(nickname) = LOWER(?)`,
 		loginReq.Identifier, loginReq.Identifier)
 
-	err := row.Scan(&user.ID, &user.Nickname, &user.Email, &user.Password)
+	err := row.Scan(&user.ID, &user.Nickname, &user.Email, &user.Password, &role)
 	if err == sql.ErrNoRows {
 		http.Error(w, "Invalid email/nickname or password", http.StatusUnauthorized)
 		return
@@ -129,11 +130,13 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	utils.CreateSession(w, user.ID)
+	touchLastSeen(user.ID)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"id":       user.ID,
 		"nickname": user.Nickname,
+		"role":     role,
 	})
 }
 
@@ -154,15 +157,17 @@ func SessionHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	var nickname string
-	err = database.DB.QueryRow("SELECT nickname FROM users WHERE id = ?", userID).Scan(&nickname)
+	var nickname, role string
+	err = database.DB.QueryRow("SELECT nickname, role FROM users WHERE id = ?", userID).Scan(&nickname, &role)
 	if err != nil {
 		http.Error(w, "Failed to fetch session user: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	touchLastSeen(userID)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"id":       userID,
 		"nickname": nickname,
+		"role":     role,
 	})
 }
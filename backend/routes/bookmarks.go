@@ -0,0 +1,245 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/models"
+	"real-time-forum/backend/utils"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	bookmarkCursorSort = "saved"
+	maxFolderLength    = 50
+)
+
+// BookmarkHandler saves a post for the current user (POST, optionally with
+// {"folder": "..."}) or removes it from their bookmarks (DELETE). Saving an
+// already saved post moves it to the given folder.
+func BookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	postID := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodPost:
+		var input struct {
+			Folder string `json:"folder"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil && err != io.EOF {
+			http.Error(w, "Invalid input data", http.StatusBadRequest)
+			return
+		}
+		folder := strings.TrimSpace(input.Folder)
+		if utf8.RuneCountInString(folder) > maxFolderLength {
+			http.Error(w, "Folder names must be at most 50 characters", http.StatusBadRequest)
+			return
+		}
+
+		var deleted bool
+		err := database.DB.QueryRow("SELECT deleted_at IS NOT NULL FROM posts WHERE id = ?", postID).Scan(&deleted)
+		if err == sql.ErrNoRows || deleted {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch post: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		_, err = database.DB.Exec(`
+			INSERT INTO bookmarks (user_id, post_id, folder, created_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(user_id, post_id) DO UPDATE SET folder = excluded.folder`,
+			currentUserID, postID, folder, utils.Now())
+		if err != nil {
+			http.Error(w, "Failed to save post: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"saved": true, "folder": folder})
+
+	case http.MethodDelete:
+		if _, err := database.DB.Exec("DELETE FROM bookmarks WHERE user_id = ? AND post_id = ?", currentUserID, postID); err != nil {
+			http.Error(w, "Failed to remove bookmark: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GetBookmarksHandler lists the current user's saved posts, most recently
+// saved first. It pages like the feed, with limit and cursor, and folder
+// restricts the list to one folder ("" is not a filter).
+func GetBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	limit := defaultFeedLimit
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "Limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxFeedLimit)
+	}
+
+	conditions := []string{"bookmarks.user_id = ?", "posts.id = bookmarks.post_id"}
+	args := []interface{}{currentUserID}
+	if folder := strings.TrimSpace(q.Get("folder")); folder != "" {
+		conditions = append(conditions, "bookmarks.folder = ?")
+		args = append(args, folder)
+	}
+	if c := q.Get("cursor"); c != "" {
+		cursor, err := decodeFeedCursor(c)
+		if err == nil && cursor.Sort != bookmarkCursorSort {
+			err = errors.New("Cursor belongs to a different list")
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "(bookmarks.created_at < ? OR (bookmarks.created_at = ? AND posts.id < ?))")
+		args = append(args, cursor.Key, cursor.Key, cursor.ID)
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT `+postColumns+`, CAST(bookmarks.created_at AS TEXT), bookmarks.folder
+		FROM bookmarks, `+postTables+`
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY bookmarks.created_at DESC, posts.id DESC LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		http.Error(w, "Failed to fetch bookmarks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	posts := []models.Post{}
+	for rows.Next() {
+		var savedAt, folder string
+		post, err := scanPost(rows, &savedAt, &folder)
+		if err != nil {
+			http.Error(w, "Failed to scan post: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		post.Saved, post.SavedAt, post.BookmarkFolder = true, savedAt, folder
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to fetch bookmarks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	nextCursor := ""
+	if len(posts) > limit {
+		posts = posts[:limit]
+		last := posts[limit-1]
+		nextCursor = feedCursor{Sort: bookmarkCursorSort, Key: last.SavedAt, ID: last.ID}.encode()
+	}
+
+	if err := loadPostDetails(posts, currentUserID); err != nil {
+		http.Error(w, "Failed to fetch bookmarks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"posts":       posts,
+		"next_cursor": nextCursor,
+	})
+}
+
+// GetBookmarkFoldersHandler lists the current user's folders with how many
+// posts each holds.
+func GetBookmarkFoldersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT folder, COUNT(*) FROM bookmarks
+		WHERE user_id = ? AND folder != ''
+		GROUP BY folder ORDER BY folder COLLATE NOCASE`, currentUserID)
+	if err != nil {
+		http.Error(w, "Failed to fetch folders: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	type folderCount struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+	folders := []folderCount{}
+	for rows.Next() {
+		var f folderCount
+		if err := rows.Scan(&f.Name, &f.Count); err != nil {
+			http.Error(w, "Failed to scan folder: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		folders = append(folders, f)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(folders)
+}
+
+// loadPostBookmarks marks the posts userID has saved.
+func loadPostBookmarks(posts []models.Post, userID string) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(posts))
+	args := []interface{}{userID}
+	index := make(map[string]int, len(posts))
+	for i, post := range posts {
+		placeholders[i] = "?"
+		args = append(args, post.ID)
+		index[post.ID] = i
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT post_id, folder, CAST(created_at AS TEXT) FROM bookmarks
+		WHERE user_id = ? AND post_id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID, folder, savedAt string
+		if err := rows.Scan(&postID, &folder, &savedAt); err != nil {
+			return err
+		}
+		post := &posts[index[postID]]
+		post.Saved, post.BookmarkFolder, post.SavedAt = true, folder, savedAt
+	}
+	return rows.Err()
+}
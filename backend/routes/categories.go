@@ -0,0 +1,274 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/models"
+	"real-time-forum/backend/utils"
+	"regexp"
+	"strings"
+
+	"github.com/gofrs/uuid"
+)
+
+const maxPostCategories = 5
+
+var colorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+func GetCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT c.id, c.name, c.description, c.color, c.sort_order, COUNT(p.id)
+		FROM categories c
+		LEFT JOIN post_categories pc ON pc.category_id = c.id
+		LEFT JOIN posts p ON p.id = pc.post_id AND p.deleted_at IS NULL AND p.hidden_at IS NULL
+		GROUP BY c.id
+		ORDER BY c.sort_order ASC, c.name ASC`)
+	if err != nil {
+		http.Error(w, "Failed to fetch categories: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		var c models.Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.Color, &c.SortOrder, &c.PostCount); err != nil {
+			http.Error(w, "Failed to scan category: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		categories = append(categories, c)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to fetch categories: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories)
+}
+
+// decodeCategory reads and validates a category from the request body.
+func decodeCategory(r *http.Request) (models.Category, error) {
+	var c models.Category
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		return c, errors.New("Invalid input data")
+	}
+	c.Name = strings.TrimSpace(c.Name)
+	c.Description = strings.TrimSpace(c.Description)
+	if c.Name == "" || len(c.Name) > 50 {
+		return c, errors.New("Name is required and must be at most 50 characters")
+	}
+	if c.Color == "" {
+		c.Color = "#888888"
+	}
+	if !colorPattern.MatchString(c.Color) {
+		return c, errors.New("Color must be a hex color such as #3366ff")
+	}
+	return c, nil
+}
+
+func CreateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	c, err := decodeCategory(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.ID = uuid.Must(uuid.NewV4()).String()
+	_, err = database.DB.Exec(`
+		INSERT INTO categories (id, name, description, color, sort_order, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		c.ID, c.Name, c.Description, c.Color, c.SortOrder, utils.Now())
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			http.Error(w, "Category already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to create category: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+// CategoryHandler updates (PUT) or deletes (DELETE) /api/admin/categories/{id}.
+func CategoryHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodPut:
+		c, err := decodeCategory(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.ID = id
+
+		tx, err := database.DB.Begin()
+		if err != nil {
+			http.Error(w, "Failed to update category: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		var oldName string
+		err = tx.QueryRow("SELECT name FROM categories WHERE id = ?", c.ID).Scan(&oldName)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to update category: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		_, err = tx.Exec(`
+			UPDATE categories SET name = ?, description = ?, color = ?, sort_order = ?
+			WHERE id = ?`,
+			c.Name, c.Description, c.Color, c.SortOrder, c.ID)
+		if err != nil {
+			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+				http.Error(w, "Category already exists", http.StatusConflict)
+				return
+			}
+			http.Error(w, "Failed to update category: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Keep the primary category name on posts in step with a rename.
+		_, err = tx.Exec("UPDATE posts SET category = ? WHERE LOWER(category) = LOWER(?)", c.Name, oldName)
+		if err != nil {
+			http.Error(w, "Failed to update category: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to update category: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c)
+
+	case http.MethodDelete:
+		var used int
+		err := database.DB.QueryRow("SELECT COUNT(*) FROM post_categories WHERE category_id = ?", id).Scan(&used)
+		if err != nil {
+			http.Error(w, "Failed to delete category: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if used > 0 {
+			http.Error(w, "Category is still used by posts", http.StatusConflict)
+			return
+		}
+		res, err := database.DB.Exec("DELETE FROM categories WHERE id = ?", id)
+		if err != nil {
+			http.Error(w, "Failed to delete category: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// setPostCategories replaces the categories of a post with ones returned by
+// resolveCategories. The first becomes the post's main category.
+func setPostCategories(tx *sql.Tx, postID string, ids, names []string) error {
+	if _, err := tx.Exec("DELETE FROM post_categories WHERE post_id = ?", postID); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := tx.Exec("INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)", postID, id); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec("UPDATE posts SET category = ? WHERE id = ?", names[0], postID)
+	return err
+}
+
+// resolveCategories checks names against the categories table and returns
+// their IDs and canonical names in the order given, without duplicates.
+func resolveCategories(names []string) ([]string, []string, error) {
+	var ids, canonical []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		var id, stored string
+		err := database.DB.QueryRow("SELECT id, name FROM categories WHERE name = ?", name).Scan(&id, &stored)
+		if err == sql.ErrNoRows {
+			return nil, nil, errors.New("Unknown category: " + name)
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+			canonical = append(canonical, stored)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil, errors.New("At least one category is required")
+	}
+	if len(ids) > maxPostCategories {
+		return nil, nil, errors.New("A post can have at most 5 categories")
+	}
+	return ids, canonical, nil
+}
+
+// loadPostCategories fills in Categories for every post with one query.
+func loadPostCategories(posts []models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(posts))
+	args := make([]interface{}, len(posts))
+	index := make(map[string]int, len(posts))
+	for i, post := range posts {
+		placeholders[i] = "?"
+		args[i] = post.ID
+		index[post.ID] = i
+		posts[i].Categories = []string{}
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT pc.post_id, c.name
+		FROM post_categories pc
+		JOIN categories c ON c.id = pc.category_id
+		WHERE pc.post_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY c.sort_order ASC, c.name ASC`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID, name string
+		if err := rows.Scan(&postID, &name); err != nil {
+			return err
+		}
+		i := index[postID]
+		posts[i].Categories = append(posts[i].Categories, name)
+	}
+	return rows.Err()
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"real-time-forum/backend/contentfilter"
 	"real-time-forum/backend/database"
+	"real-time-forum/backend/encryption"
 	"real-time-forum/backend/models"
 	"real-time-forum/backend/utils"
 	"strconv"
@@ -21,10 +23,61 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-var clients = make(map[*websocket.Conn]string)
+// sendQueueSize is how many messages and events may wait for one
+// connection. A client that falls that far behind is disconnected and loads
+// what it missed when it reconnects.
+const sendQueueSize = 64
+
+// writeWait is how long a single write to a connection may take.
+const writeWait = 10 * time.Second
+
+// client is one WebSocket connection. Only its writer goroutine writes to
+// conn; everything else queues on send, so a slow reader holds up no one.
+type client struct {
+	conn   *websocket.Conn
+	userID string
+	send   chan interface{}
+}
+
+var clients = make(map[*client]bool)
 var broadcast = make(chan models.Message)
 var mutex = &sync.Mutex{}
 
+// queue hands v to c's writer without waiting for it. The caller must hold
+// mutex.
+func (c *client) queue(v interface{}) {
+	select {
+	case c.send <- v:
+	default:
+		fmt.Println("Disconnecting slow WebSocket client of user", c.userID)
+		c.remove()
+	}
+}
+
+// remove unregisters c, stops its writer and closes the connection, which
+// also ends its read loop. The caller must hold mutex.
+func (c *client) remove() {
+	if !clients[c] {
+		return
+	}
+	delete(clients, c)
+	close(c.send)
+	c.conn.Close()
+}
+
+// writeLoop writes what is queued for c until the queue is closed or a
+// write fails.
+func (c *client) writeLoop() {
+	defer c.conn.Close()
+	for v := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := c.conn.WriteJSON(v); err != nil {
+			fmt.Println("Error sending message:", err)
+			return
+		}
+	}
+}
+
 func ChatHandler(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -33,15 +86,20 @@ func ChatHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	senderID := r.URL.Query().Get("sender_id")
-	if senderID == "" {
-		fmt.Println("Missing sender_id in query params")
+	// The connection belongs to the signed-in user, whatever sender_id the
+	// client puts in the URL or in its messages.
+	senderID, err := utils.GetSession(r)
+	if err != nil || senderID == "" {
+		fmt.Println("WebSocket connection without a session")
 		return
 	}
 
+	c := &client{conn: conn, userID: senderID, send: make(chan interface{}, sendQueueSize)}
 	mutex.Lock()
-	clients[conn] = senderID
+	clients[c] = true
 	mutex.Unlock()
+	go c.writeLoop()
+	touchLastSeen(senderID)
 
 	for {
 		var msg models.Message
@@ -49,13 +107,29 @@ func ChatHandler(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			//fmt.Println("Error reading message:", err) - for debugging
 			mutex.Lock()
-			delete(clients, conn)
+			c.remove()
 			mutex.Unlock()
 			break
 		}
 
+		msg.SenderID = senderID
+
+		verdict, err := contentfilter.Check(contentfilter.Content{Kind: "message", AuthorID: senderID, Text: msg.Content})
+		if err != nil {
+			fmt.Println("Error filtering message:", err)
+			continue
+		}
+		if verdict.Action == contentfilter.Reject {
+			sendEventTo(senderID, "message_rejected", map[string]string{
+				"receiver_id": msg.ReceiverID,
+				"reason":      verdict.Reason,
+			})
+			continue
+		}
+		msg.Content = verdict.Text
+
 		msg.ID = uuid.Must(uuid.NewV4()).String()
-		msg.CreatedAt = time.Now().Format(time.RFC3339Nano) // Use more precise format with nanoseconds
+		msg.CreatedAt = utils.Now()
 
 		// Get the last sequence number for the conversation between these users
 		var lastSequence int
@@ -72,37 +146,98 @@ func ChatHandler(w http.ResponseWriter, r *http.Request) {
 		// Increment the sequence number
 		newSequence := lastSequence + 1
 
-		// Save the message with the sequence number
-		_, dbErr := database.DB.Exec(`
-			INSERT INTO messages (id, sender_id, receiver_id, content, created_at, sequence)
-			VALUES (?, ?, ?, ?, ?, ?)`,
-			msg.ID, msg.SenderID, msg.ReceiverID, msg.Content, msg.CreatedAt, newSequence)
-		if dbErr != nil {
-			fmt.Println("Error saving message to database:", dbErr)
+		// Encrypt the content at rest; the broadcast below carries the plaintext
+		storedContent, err := encryption.Encrypt(msg.Content, msg.ID)
+		if err != nil {
+			fmt.Println("Error encrypting message:", err)
 			continue
 		}
 
 		// Add sequence number to the message before broadcasting
 		msg.Sequence = newSequence
+		held := verdict.Action == contentfilter.Hold
+		participants, err := conversationUsers(senderID, msg.ReceiverID)
+		if err != nil {
+			fmt.Println("Error fetching conversation users:", err)
+		}
+		msg.Mentions = messageMentions(msg.Content, participants...)
+
+		notifications, err := saveMessage(msg, storedContent, held, verdict.Reason)
+		if err != nil {
+			fmt.Println("Error saving message to database:", err)
+			continue
+		}
+		pushNotifications(notifications)
+		if held {
+			// Both sides see the placeholder until a moderator decides.
+			msg.Content = ""
+			msg.Hidden = true
+			msg.Mentions = nil
+		}
 		broadcast <- msg
 	}
 }
 
+// saveMessage stores msg with its content sealed as storedContent, along
+// with its mentions. A held message goes to the report queue; otherwise the
+// receiver is notified when mentioned.
+func saveMessage(msg models.Message, storedContent string, held bool, reason string) (map[string]models.Notification, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO messages (id, sender_id, receiver_id, content, created_at, sequence)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		msg.ID, msg.SenderID, msg.ReceiverID, storedContent, msg.CreatedAt, msg.Sequence)
+	if err != nil {
+		return nil, err
+	}
+	mentioned := false
+	for _, m := range msg.Mentions {
+		_, err := tx.Exec(`
+			INSERT INTO mentions (target_type, target_id, user_id, start_offset, end_offset)
+			VALUES ('message', ?, ?, ?, ?)`, msg.ID, m.UserID, m.Start, m.End)
+		if err != nil {
+			return nil, err
+		}
+		mentioned = mentioned || m.UserID == msg.ReceiverID
+	}
+
+	var notifications map[string]models.Notification
+	if held {
+		err = holdForReview(tx, "message", msg.ID, msg.SenderID, "", reason)
+	} else if mentioned && msg.ReceiverID != msg.SenderID {
+		notifications, err = notify(tx, []string{msg.ReceiverID}, models.Notification{
+			Type:      notificationMention,
+			ActorID:   msg.SenderID,
+			MessageID: msg.ID,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return notifications, tx.Commit()
+}
+
 func HandleMessages() {
 	for {
-		msg := <-broadcast
-		mutex.Lock()
-		for client, userID := range clients {
-			if userID == msg.ReceiverID || userID == msg.SenderID {
-				err := client.WriteJSON(msg)
-				if err != nil {
-					fmt.Println("Error sending message:", err)
-					client.Close()
-					delete(clients, client)
+		select {
+		case msg := <-broadcast:
+			mutex.Lock()
+			for c := range clients {
+				if c.userID == msg.ReceiverID || c.userID == msg.SenderID {
+					c.queue(msg)
 				}
 			}
+			mutex.Unlock()
+		case e := <-events:
+			mutex.Lock()
+			sendEvent(e)
+			mutex.Unlock()
 		}
-		mutex.Unlock()
 	}
 }
 
@@ -142,11 +277,17 @@ func GetChatHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	// For simplicity, just get ALL messages for this chat
 	// We can paginate on the client side to save complexity
 	query := `
-		SELECT m.id, m.sender_id, u.nickname, m.receiver_id, m.content, m.created_at, m.sequence
+		SELECT m.id, m.sender_id, u.nickname, m.receiver_id, m.content, m.created_at, m.sequence, m.hidden_at IS NOT NULL
 		FROM messages m
 		JOIN users u ON m.sender_id = u.id
 		WHERE ((m.sender_id = ? AND m.receiver_id = ?) OR (m.sender_id = ? AND m.receiver_id = ?))
-		ORDER BY created_at ASC`
+		ORDER BY m.created_at ASC`
+
+	participants, err := conversationUsers(currentUserID, otherUserID)
+	if err != nil {
+		http.Error(w, "Failed to fetch chat history: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	rows, err := database.DB.Query(query, currentUserID, otherUserID, otherUserID, currentUserID)
 	if err != nil {
@@ -155,15 +296,25 @@ func GetChatHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
-	var allMessages []map[string]string
+	var allMessages []map[string]interface{}
 	for rows.Next() {
 		var id, senderID, senderNickname, receiverID, content, createdAt string
 		var sequence int
-		if err := rows.Scan(&id, &senderID, &senderNickname, &receiverID, &content, &createdAt, &sequence); err != nil {
+		var hidden bool
+		if err := rows.Scan(&id, &senderID, &senderNickname, &receiverID, &content, &createdAt, &sequence, &hidden); err != nil {
 			http.Error(w, "Failed to scan message: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
-		msg := map[string]string{
+		content, err = encryption.Decrypt(content, id)
+		if err != nil {
+			http.Error(w, "Failed to decrypt message: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Reported messages hidden pending review keep their place.
+		if hidden {
+			content = ""
+		}
+		msg := map[string]interface{}{
 			"id":              id,
 			"sender_id":       senderID,
 			"sender_nickname": senderNickname,
@@ -171,6 +322,10 @@ func GetChatHistoryHandler(w http.ResponseWriter, r *http.Request) {
 			"content":         content,
 			"created_at":      createdAt,
 			"sequence":        strconv.Itoa(sequence),
+			"mentions":        messageMentions(content, participants...),
+		}
+		if hidden {
+			msg["hidden"] = true
 		}
 		allMessages = append(allMessages, msg)
 	}
@@ -201,7 +356,7 @@ func GetChatHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the slice of messages to return
-	var messages []map[string]string
+	var messages []map[string]interface{}
 	if startIndex < endIndex {
 		messages = allMessages[startIndex:endIndex]
 	}
@@ -254,10 +409,29 @@ func GetChatMessageCountHandler(w http.ResponseWriter, r *http.Request) {
 func IsUserOnline(userID string) bool {
 	mutex.Lock()
 	defer mutex.Unlock()
-	for _, id := range clients {
-		if id == userID {
+	for c := range clients {
+		if c.userID == userID {
 			return true
 		}
 	}
 	return false
 }
+
+// conversationUsers loads the IDs and nicknames of the people in a
+// conversation.
+func conversationUsers(userA, userB string) ([]models.User, error) {
+	rows, err := database.DB.Query("SELECT id, nickname FROM users WHERE id IN (?, ?)", userA, userB)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Nickname); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
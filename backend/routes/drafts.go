@@ -0,0 +1,232 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/models"
+	"real-time-forum/backend/utils"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	postDraftContext = "post"
+	maxDraftLength   = 50000
+	maxDraftsPerUser = 50
+)
+
+// commentDraftContext is the draft context of a comment on postID, or of a
+// reply when parentCommentID is set.
+func commentDraftContext(postID, parentCommentID string) string {
+	if parentCommentID != "" {
+		return "reply:" + parentCommentID
+	}
+	return "comment:" + postID
+}
+
+// parseDraftContext splits a draft context into its kind, "post", "comment"
+// or "reply", and the id it points at.
+func parseDraftContext(context string) (kind, id string, ok bool) {
+	if context == postDraftContext {
+		return postDraftContext, "", true
+	}
+	kind, id, _ = strings.Cut(context, ":")
+	return kind, id, (kind == "comment" || kind == "reply") && id != ""
+}
+
+// draftTarget returns the post a comment or reply draft belongs to and the
+// comment a reply answers. It returns sql.ErrNoRows when either is gone.
+func draftTarget(kind, id string) (postID, parentCommentID string, err error) {
+	var deleted bool
+	switch kind {
+	case "comment":
+		postID = id
+		err = database.DB.QueryRow("SELECT deleted_at IS NOT NULL FROM posts WHERE id = ?", postID).Scan(&deleted)
+	case "reply":
+		parentCommentID = id
+		err = database.DB.QueryRow(`
+			SELECT c.post_id, c.deleted_at IS NOT NULL OR p.deleted_at IS NOT NULL
+			FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.id = ?`, parentCommentID).Scan(&postID, &deleted)
+	}
+	if err == nil && deleted {
+		err = sql.ErrNoRows
+	}
+	return postID, parentCommentID, err
+}
+
+// discardDraft deletes userID's draft for context once what it was for has
+// been published.
+func discardDraft(tx *sql.Tx, userID, context string) error {
+	_, err := tx.Exec("DELETE FROM drafts WHERE user_id = ? AND context = ?", userID, context)
+	return err
+}
+
+const draftColumns = `d.context, COALESCE(d.post_id, ''), COALESCE(p.title, ''), COALESCE(d.parent_comment_id, ''),
+	COALESCE(u.nickname, ''), d.title, d.content, CAST(d.created_at AS TEXT), CAST(d.updated_at AS TEXT)`
+
+const draftTables = `drafts d
+	LEFT JOIN posts p ON p.id = d.post_id
+	LEFT JOIN comments c ON c.id = d.parent_comment_id
+	LEFT JOIN users u ON u.id = c.user_id`
+
+func scanDraft(row interface{ Scan(...interface{}) error }) (models.Draft, error) {
+	var d models.Draft
+	err := row.Scan(&d.Context, &d.PostID, &d.PostTitle, &d.ParentCommentID,
+		&d.ParentAuthor, &d.Title, &d.Content, &d.CreatedAt, &d.UpdatedAt)
+	return d, err
+}
+
+// GetDraftsHandler lists the current user's drafts, most recently saved
+// first.
+func GetDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT `+draftColumns+` FROM `+draftTables+`
+		WHERE d.user_id = ? ORDER BY d.updated_at DESC, d.context`, currentUserID)
+	if err != nil {
+		http.Error(w, "Failed to fetch drafts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	drafts := []models.Draft{}
+	for rows.Next() {
+		d, err := scanDraft(rows)
+		if err != nil {
+			http.Error(w, "Failed to scan draft: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		drafts = append(drafts, d)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to fetch drafts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(drafts)
+}
+
+// DraftHandler reads (GET), autosaves (PUT {"title", "content"}) or
+// discards (DELETE) the current user's draft for /api/drafts/{context}.
+// Saving an empty draft discards it.
+func DraftHandler(w http.ResponseWriter, r *http.Request) {
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	context := r.PathValue("context")
+
+	switch r.Method {
+	case http.MethodGet:
+		d, err := scanDraft(database.DB.QueryRow(`
+			SELECT `+draftColumns+` FROM `+draftTables+`
+			WHERE d.user_id = ? AND d.context = ?`, currentUserID, context))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Draft not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch draft: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d)
+
+	case http.MethodPut:
+		var input struct {
+			Title   string `json:"title"`
+			Content string `json:"content"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid input data", http.StatusBadRequest)
+			return
+		}
+		kind, id, ok := parseDraftContext(context)
+		if !ok {
+			http.Error(w, "Context must be post, comment:{post id} or reply:{comment id}", http.StatusBadRequest)
+			return
+		}
+		postID, parentCommentID, err := draftTarget(kind, id)
+		if err == sql.ErrNoRows && kind == "reply" {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		} else if err == sql.ErrNoRows {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to save draft: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Only posts have a title.
+		if kind != postDraftContext {
+			input.Title = ""
+		}
+		if utf8.RuneCountInString(input.Title) > maxTitleLength {
+			http.Error(w, "Title must be at most 120 characters", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(input.Content) > maxDraftLength {
+			http.Error(w, "Drafts must be at most 50000 characters", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(input.Title) == "" && strings.TrimSpace(input.Content) == "" {
+			if _, err := database.DB.Exec("DELETE FROM drafts WHERE user_id = ? AND context = ?", currentUserID, context); err != nil {
+				http.Error(w, "Failed to discard draft: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		var count int
+		var exists bool
+		err = database.DB.QueryRow(`
+			SELECT COUNT(*), COALESCE(MAX(context = ?), 0) FROM drafts WHERE user_id = ?`,
+			context, currentUserID).Scan(&count, &exists)
+		if err != nil {
+			http.Error(w, "Failed to save draft: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists && count >= maxDraftsPerUser {
+			http.Error(w, "You have too many drafts; discard some first", http.StatusConflict)
+			return
+		}
+
+		now := utils.Now()
+		_, err = database.DB.Exec(`
+			INSERT INTO drafts (user_id, context, post_id, parent_comment_id, title, content, created_at, updated_at)
+			VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?)
+			ON CONFLICT(user_id, context) DO UPDATE SET
+				title = excluded.title, content = excluded.content, updated_at = excluded.updated_at`,
+			currentUserID, context, postID, parentCommentID, input.Title, input.Content, now, now)
+		if err != nil {
+			http.Error(w, "Failed to save draft: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"context": context, "updated_at": now})
+
+	case http.MethodDelete:
+		if _, err := database.DB.Exec("DELETE FROM drafts WHERE user_id = ? AND context = ?", currentUserID, context); err != nil {
+			http.Error(w, "Failed to discard draft: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,503 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"real-time-forum/backend/contentfilter"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/markdown"
+	"real-time-forum/backend/models"
+	"real-time-forum/backend/utils"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	revisionEdit   = "edit"
+	revisionDelete = "delete"
+)
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// editTarget is the current state of a post or comment being changed.
+type editTarget struct {
+	postID   string
+	authorID string
+	title    string
+	content  string
+	deleted  bool
+	hidden   bool
+}
+
+// cleanTitle trims and validates a post title.
+func cleanTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return "", errors.New("Title is required")
+	}
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		return "", errors.New("Title must be at most 120 characters")
+	}
+	return title, nil
+}
+
+// checkContentLength limits the markdown source of a post or comment.
+func checkContentLength(content string) error {
+	if utf8.RuneCountInString(content) > maxContentLength {
+		return errors.New("Content must be at most 50000 characters")
+	}
+	return nil
+}
+
+func loadEditTarget(db queryRower, targetType, id string) (editTarget, error) {
+	query := "SELECT id, user_id, title, content, deleted_at IS NOT NULL, hidden_at IS NOT NULL FROM posts WHERE id = ?"
+	if targetType == "comment" {
+		query = "SELECT post_id, user_id, '', content, deleted_at IS NOT NULL, hidden_at IS NOT NULL FROM comments WHERE id = ?"
+	}
+	var t editTarget
+	err := db.QueryRow(query, id).Scan(&t.postID, &t.authorID, &t.title, &t.content, &t.deleted, &t.hidden)
+	return t, err
+}
+
+// canModerate reports whether userID may change content written by authorID:
+// authors may change their own, moderators and admins anything.
+func canModerate(userID, authorID string) (bool, error) {
+	if userID == authorID {
+		return true, nil
+	}
+	return isStaff(userID)
+}
+
+// recordRevision stores the version of a post or comment that is about to be
+// replaced or deleted.
+func recordRevision(tx *sql.Tx, targetType, targetID, action string, old editTarget, editorID string) error {
+	_, err := tx.Exec(`
+		INSERT INTO revisions (id, target_type, target_id, action, title, content, editor_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		uuid.Must(uuid.NewV4()).String(), targetType, targetID, action, old.title, old.content, editorID, utils.Now())
+	return err
+}
+
+// beginEdit starts a transaction and loads the target, checking that it
+// exists, is not deleted and that the caller may change it. It writes the
+// error response itself; on success the caller must roll back or commit tx.
+func beginEdit(w http.ResponseWriter, targetType, id, currentUserID string) (*sql.Tx, editTarget, bool) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to update "+targetType+": "+err.Error(), http.StatusInternalServerError)
+		return nil, editTarget{}, false
+	}
+
+	target, err := loadEditTarget(tx, targetType, id)
+	if err == sql.ErrNoRows || (err == nil && target.deleted) {
+		tx.Rollback()
+		http.Error(w, strings.ToUpper(targetType[:1])+targetType[1:]+" not found", http.StatusNotFound)
+		return nil, target, false
+	} else if err != nil {
+		tx.Rollback()
+		http.Error(w, "Failed to fetch "+targetType+": "+err.Error(), http.StatusInternalServerError)
+		return nil, target, false
+	}
+
+	allowed, err := canModerate(currentUserID, target.authorID)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, "Failed to fetch user role: "+err.Error(), http.StatusInternalServerError)
+		return nil, target, false
+	}
+	if !allowed {
+		tx.Rollback()
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, target, false
+	}
+	return tx, target, true
+}
+
+// PostHandler serves /api/posts/{id}: GET reads, PUT edits and DELETE
+// soft-deletes the post.
+func PostHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		GetPostHandler(w, r)
+	case http.MethodPut:
+		UpdatePostHandler(w, r)
+	case http.MethodDelete:
+		DeletePostHandler(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CommentHandler serves /api/comments/{id}: PUT edits and DELETE
+// soft-deletes the comment.
+func CommentHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		UpdateCommentHandler(w, r)
+	case http.MethodDelete:
+		DeleteCommentHandler(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func UpdatePostHandler(w http.ResponseWriter, r *http.Request) {
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input models.Post
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+	title, err := cleanTitle(input.Title)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(input.Content) == "" {
+		http.Error(w, "Content is required", http.StatusBadRequest)
+		return
+	}
+	if err := checkContentLength(input.Content); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Tags are left alone unless the request has a tags list, which may be
+	// empty to remove them all.
+	var tags []string
+	if input.Tags != nil {
+		if tags, err = cleanTags(input.Tags); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	// Categories are left alone unless the request names them.
+	var categoryIDs, categories []string
+	if len(input.Categories) > 0 {
+		if categoryIDs, categories, err = resolveCategories(input.Categories); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	id := r.PathValue("id")
+	tx, old, ok := beginEdit(w, "post", id, currentUserID)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	verdict, ok := filterContent(w, contentfilter.Content{Kind: "post", AuthorID: old.authorID, Title: title, Text: input.Content})
+	if !ok {
+		return
+	}
+	title, input.Content = verdict.Title, verdict.Text
+
+	if err := recordRevision(tx, "post", id, revisionEdit, old, currentUserID); err != nil {
+		http.Error(w, "Failed to update post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec("UPDATE posts SET title = ?, slug = ?, content = ?, content_html = ?, edited_at = ? WHERE id = ?",
+		title, utils.Slugify(title), input.Content, markdown.Render(input.Content), utils.Now(), id)
+	if err != nil {
+		http.Error(w, "Failed to update post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(categoryIDs) > 0 {
+		if err := setPostCategories(tx, id, categoryIDs, categories); err != nil {
+			http.Error(w, "Failed to update post: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if tags != nil {
+		if err := setPostTags(tx, id, tags); err != nil {
+			http.Error(w, "Failed to update post: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	mentioned, err := saveMentions(tx, "post", id, input.Content, old.authorID)
+	if err != nil {
+		http.Error(w, "Failed to update post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Mentions in a post that is hidden pending review are notified when a
+	// moderator lets it through.
+	var notifications map[string]models.Notification
+	if verdict.Action == contentfilter.Hold {
+		err = holdForReview(tx, "post", id, old.authorID, id, verdict.Reason)
+	} else if !old.hidden {
+		notifications, err = notifyMentions(tx, mentioned, id, "", old.authorID)
+	}
+	if err != nil {
+		http.Error(w, "Failed to update post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Moderators changing someone else's post are logged.
+	if old.authorID != currentUserID {
+		if err := logModeration(tx, currentUserID, revisionEdit, "post", id, id, ""); err != nil {
+			http.Error(w, "Failed to update post: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	moderation, err := notifyModeration(tx, old.authorID, currentUserID, id, "", revisionEdit)
+	if err != nil {
+		http.Error(w, "Failed to notify author: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pushNotifications(notifications)
+	pushNotifications(moderation)
+
+	post, err := fetchPost(id, currentUserID)
+	if err != nil {
+		http.Error(w, "Failed to fetch post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(post)
+}
+
+func DeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	deleteTarget(w, r, "post", "posts")
+}
+
+func UpdateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input models.Comment
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(input.Content) == "" {
+		http.Error(w, "Content is required", http.StatusBadRequest)
+		return
+	}
+	if err := checkContentLength(input.Content); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("id")
+	tx, old, ok := beginEdit(w, "comment", id, currentUserID)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	verdict, ok := filterContent(w, contentfilter.Content{Kind: "comment", AuthorID: old.authorID, Text: input.Content})
+	if !ok {
+		return
+	}
+	input.Content = verdict.Text
+	held := verdict.Action == contentfilter.Hold
+
+	if err := recordRevision(tx, "comment", id, revisionEdit, old, currentUserID); err != nil {
+		http.Error(w, "Failed to update comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	editedAt := utils.Now()
+	contentHTML := markdown.Render(input.Content)
+	_, err = tx.Exec("UPDATE comments SET content = ?, content_html = ?, edited_at = ? WHERE id = ?", input.Content, contentHTML, editedAt, id)
+	if err != nil {
+		http.Error(w, "Failed to update comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	mentioned, err := saveMentions(tx, "comment", id, input.Content, old.authorID)
+	if err != nil {
+		http.Error(w, "Failed to update comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var notifications map[string]models.Notification
+	if held {
+		err = holdForReview(tx, "comment", id, old.authorID, old.postID, verdict.Reason)
+	} else if !old.hidden {
+		notifications, err = notifyMentions(tx, mentioned, old.postID, id, old.authorID)
+	}
+	if err != nil {
+		http.Error(w, "Failed to update comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if old.authorID != currentUserID {
+		if err := logModeration(tx, currentUserID, revisionEdit, "comment", id, old.postID, ""); err != nil {
+			http.Error(w, "Failed to update comment: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	moderation, err := notifyModeration(tx, old.authorID, currentUserID, old.postID, id, revisionEdit)
+	if err != nil {
+		http.Error(w, "Failed to notify author: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pushNotifications(notifications)
+	pushNotifications(moderation)
+	found, err := loadMentions("comment", []string{id})
+	if err != nil {
+		http.Error(w, "Failed to fetch mentions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":           id,
+		"content":      input.Content,
+		"content_html": contentHTML,
+		"edited":       true,
+		"edited_at":    editedAt,
+		"mentions":     found[id],
+		"hidden":       held,
+	})
+}
+
+func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	deleteTarget(w, r, "comment", "comments")
+}
+
+// deleteTarget soft-deletes a post or comment: the row stays so threads keep
+// their shape, and its last version is kept as a revision.
+func deleteTarget(w http.ResponseWriter, r *http.Request, targetType, table string) {
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	tx, old, ok := beginEdit(w, targetType, id, currentUserID)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	notifications, err := softDelete(tx, targetType, table, id, old, currentUserID)
+	if err != nil {
+		http.Error(w, "Failed to delete "+targetType+": "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to delete "+targetType+": "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pushNotifications(notifications)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// softDelete marks a post or comment deleted by userID, logging it and
+// telling the author when userID is a moderator. The notifications are
+// returned to be pushed once tx commits.
+func softDelete(tx *sql.Tx, targetType, table, id string, old editTarget, userID string) (map[string]models.Notification, error) {
+	if err := recordRevision(tx, targetType, id, revisionDelete, old, userID); err != nil {
+		return nil, err
+	}
+	_, err := tx.Exec("UPDATE "+table+" SET deleted_at = ?, deleted_by = ? WHERE id = ?", utils.Now(), userID, id)
+	if err != nil {
+		return nil, err
+	}
+	// Drafts answering what was deleted can no longer be published.
+	draftColumn := "post_id"
+	commentID := ""
+	if targetType == "comment" {
+		draftColumn, commentID = "parent_comment_id", id
+		if err := database.RefreshPostActivity(tx, old.postID); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM drafts WHERE "+draftColumn+" = ?", id); err != nil {
+		return nil, err
+	}
+	if old.authorID != userID {
+		if err := logModeration(tx, userID, revisionDelete, targetType, id, old.postID, ""); err != nil {
+			return nil, err
+		}
+	}
+	return notifyModeration(tx, old.authorID, userID, old.postID, commentID, revisionDelete)
+}
+
+func PostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	revisionsHandler(w, r, "post")
+}
+
+func CommentRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	revisionsHandler(w, r, "comment")
+}
+
+// revisionsHandler lists earlier versions of a post or comment, oldest first.
+// Once deleted or while hidden pending review, the history is only shown to
+// the author and moderators.
+func revisionsHandler(w http.ResponseWriter, r *http.Request, targetType string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	target, err := loadEditTarget(database.DB, targetType, id)
+	notFound := err == sql.ErrNoRows
+	if err == nil && (target.deleted || target.hidden) {
+		allowed, err := canModerate(currentUserID, target.authorID)
+		if err != nil {
+			http.Error(w, "Failed to fetch user role: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		notFound = !allowed
+	} else if err != nil && !notFound {
+		http.Error(w, "Failed to fetch "+targetType+": "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if notFound {
+		http.Error(w, strings.ToUpper(targetType[:1])+targetType[1:]+" not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT r.id, r.action, r.title, r.content, r.editor_id, u.nickname, r.created_at
+		FROM revisions r
+		JOIN users u ON u.id = r.editor_id
+		WHERE r.target_type = ? AND r.target_id = ?
+		ORDER BY r.created_at ASC`, targetType, id)
+	if err != nil {
+		http.Error(w, "Failed to fetch revisions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	revisions := []models.Revision{}
+	for rows.Next() {
+		var rev models.Revision
+		if err := rows.Scan(&rev.ID, &rev.Action, &rev.Title, &rev.Content, &rev.EditorID, &rev.EditorNickname, &rev.CreatedAt); err != nil {
+			http.Error(w, "Failed to scan revision: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		revisions = append(revisions, rev)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
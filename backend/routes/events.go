@@ -0,0 +1,35 @@
+package routes
+
+// Event is a live update pushed to every connected WebSocket client next to
+// chat messages. Chat messages have no type field, which is how clients tell
+// the two apart.
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+
+	// userID limits delivery to that user's connections when set.
+	userID string
+}
+
+var events = make(chan Event, 64)
+
+// broadcastEvent queues e for delivery by HandleMessages.
+func broadcastEvent(eventType string, data interface{}) {
+	events <- Event{Type: eventType, Data: data}
+}
+
+// sendEventTo queues e for delivery to userID's connections only.
+func sendEventTo(userID, eventType string, data interface{}) {
+	events <- Event{Type: eventType, Data: data, userID: userID}
+}
+
+// sendEvent queues e for every client, or only for its user's clients when
+// it has one. The caller must hold mutex.
+func sendEvent(e Event) {
+	for c := range clients {
+		if e.userID != "" && c.userID != e.userID {
+			continue
+		}
+		c.queue(e)
+	}
+}
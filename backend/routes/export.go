@@ -0,0 +1,381 @@
+package routes
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"real-time-forum/backend/config"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/encryption"
+	"real-time-forum/backend/models"
+	"real-time-forum/backend/utils"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const exportDir = "exports"
+
+const (
+	exportPending = "pending"
+	exportReady   = "ready"
+	exportFailed  = "failed"
+)
+
+type ExportJob struct {
+	ID          string `json:"id"`
+	UserID      string `json:"-"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	CompletedAt string `json:"completed_at,omitempty"`
+	ExpiresAt   string `json:"expires_at,omitempty"`
+}
+
+var (
+	exportJobs  = make(map[string]*ExportJob)
+	exportMutex = &sync.Mutex{}
+)
+
+type exportArchive struct {
+	Profile  models.User      `json:"profile"`
+	Posts    []models.Post    `json:"posts"`
+	Comments []models.Comment `json:"comments"`
+	Messages []models.Message `json:"messages"`
+}
+
+var exportIndexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{"join": strings.Join}).Parse(`{{define "attachments"}}{{if .}}<div class="meta">Attachments: {{range $i, $a := .}}{{if $i}}, {{end}}{{$a.Filename}} ({{$a.ContentType}}, {{$a.Size}} bytes){{end}}</div>{{end}}{{end}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<title>Data export for {{.Profile.Nickname}}</title>
+<style>body{font-family:sans-serif;max-width:800px;margin:2em auto}section{margin-bottom:2em}.item{border-bottom:1px solid #ddd;padding:.5em 0}.meta{color:#666;font-size:.9em}</style>
+</head>
+<body>
+<h1>Data export for {{.Profile.Nickname}}</h1>
+<section>
+<h2>Profile</h2>
+<p>Nickname: {{.Profile.Nickname}}<br>Email: {{.Profile.Email}}<br>Name: {{.Profile.FirstName}} {{.Profile.LastName}}<br>Age: {{.Profile.Age}}<br>Gender: {{.Profile.Gender}}</p>
+</section>
+<section>
+<h2>Posts ({{len .Posts}})</h2>
+{{range .Posts}}<div class="item"><h3>{{.Title}}</h3><div class="meta">{{.CreatedAt}} in {{join .Categories ", "}}{{if .Tags}} · tagged {{join .Tags ", "}}{{end}}</div><div>{{.Content}}</div>{{template "attachments" .Attachments}}</div>
+{{end}}</section>
+<section>
+<h2>Comments ({{len .Comments}})</h2>
+{{range .Comments}}<div class="item"><div class="meta">{{.CreatedAt}} on post {{.PostID}}</div><div>{{.Content}}</div>{{template "attachments" .Attachments}}</div>
+{{end}}</section>
+<section>
+<h2>Messages ({{len .Messages}})</h2>
+{{range .Messages}}<div class="item"><div class="meta">{{.CreatedAt}} from {{.SenderNickname}}</div><div>{{.Content}}</div></div>
+{{end}}</section>
+<p class="meta">The same data is available as JSON files in this archive.</p>
+</body>
+</html>
+`))
+
+func StartExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	exportMutex.Lock()
+	// Only one export per user runs at a time; a second request returns it.
+	for _, job := range exportJobs {
+		if job.UserID == currentUserID && job.Status == exportPending {
+			exportMutex.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(job)
+			return
+		}
+	}
+	job := &ExportJob{
+		ID:        uuid.Must(uuid.NewV4()).String(),
+		UserID:    currentUserID,
+		Status:    exportPending,
+		CreatedAt: utils.Now(),
+	}
+	exportJobs[job.ID] = job
+	snapshot := *job
+	exportMutex.Unlock()
+
+	go runExport(job.ID, currentUserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+func ExportStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, ok := exportJobForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+func DownloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, ok := exportJobForRequest(w, r)
+	if !ok {
+		return
+	}
+	if job.Status != exportReady {
+		http.Error(w, "Export is not ready yet", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="forum-export-%s.zip"`, job.CreatedAt[:10]))
+	http.ServeFile(w, r, exportPath(job.ID))
+}
+
+// exportJobForRequest looks up the job named by the id parameter and makes
+// sure it belongs to the caller. It writes the error response itself.
+func exportJobForRequest(w http.ResponseWriter, r *http.Request) (ExportJob, bool) {
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return ExportJob{}, false
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing id parameter", http.StatusBadRequest)
+		return ExportJob{}, false
+	}
+
+	exportMutex.Lock()
+	job, ok := exportJobs[id]
+	var snapshot ExportJob
+	if ok {
+		snapshot = *job
+	}
+	exportMutex.Unlock()
+
+	if !ok || snapshot.UserID != currentUserID {
+		http.Error(w, "Export not found", http.StatusNotFound)
+		return ExportJob{}, false
+	}
+	return snapshot, true
+}
+
+// CleanExports removes archives left behind by an earlier run. Jobs only
+// live in memory, so nobody can download those any more.
+func CleanExports() {
+	if err := os.RemoveAll(exportDir); err != nil {
+		log.Println("Error removing old data exports:", err)
+	}
+}
+
+// expireExport forgets a finished job and deletes its archive, which holds
+// the user's personal data.
+func expireExport(jobID string) {
+	exportMutex.Lock()
+	delete(exportJobs, jobID)
+	exportMutex.Unlock()
+	if err := os.Remove(exportPath(jobID)); err != nil && !os.IsNotExist(err) {
+		log.Println("Error removing data export:", err)
+	}
+}
+
+func exportPath(jobID string) string {
+	return filepath.Join(exportDir, jobID+".zip")
+}
+
+func runExport(jobID, userID string) {
+	size, err := buildExport(exportPath(jobID), userID)
+
+	exportMutex.Lock()
+	defer exportMutex.Unlock()
+	job := exportJobs[jobID]
+	job.CompletedAt = utils.Now()
+	job.ExpiresAt = utils.FormatTime(time.Now().Add(config.ExportTTL))
+	time.AfterFunc(config.ExportTTL, func() { expireExport(jobID) })
+	if err != nil {
+		log.Println("Error building data export:", err)
+		job.Status = exportFailed
+		job.Error = "Failed to build export"
+		return
+	}
+	job.Status = exportReady
+	job.Size = size
+}
+
+func buildExport(path, userID string) (int64, error) {
+	archive, err := collectExportData(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(exportDir, 0700); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	files := map[string]interface{}{
+		"profile.json":  archive.Profile,
+		"posts.json":    archive.Posts,
+		"comments.json": archive.Comments,
+		"messages.json": archive.Messages,
+	}
+	for name, data := range files {
+		entry, err := zw.Create(name)
+		if err != nil {
+			return 0, err
+		}
+		enc := json.NewEncoder(entry)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data); err != nil {
+			return 0, err
+		}
+	}
+
+	entry, err := zw.Create("index.html")
+	if err != nil {
+		return 0, err
+	}
+	if err := exportIndexTemplate.Execute(entry, archive); err != nil {
+		return 0, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func collectExportData(userID string) (exportArchive, error) {
+	archive := exportArchive{
+		Posts:    []models.Post{},
+		Comments: []models.Comment{},
+		Messages: []models.Message{},
+	}
+
+	err := database.DB.QueryRow(`
+		SELECT id, nickname, email, COALESCE(first_name, ''), COALESCE(last_name, ''), COALESCE(age, 0), COALESCE(gender, '')
+		FROM users WHERE id = ?`, userID).
+		Scan(&archive.Profile.ID, &archive.Profile.Nickname, &archive.Profile.Email,
+			&archive.Profile.FirstName, &archive.Profile.LastName, &archive.Profile.Age, &archive.Profile.Gender)
+	if err != nil {
+		return archive, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, user_id, title, slug, category, content, created_at
+		FROM posts WHERE user_id = ? ORDER BY created_at ASC`, userID)
+	if err != nil {
+		return archive, err
+	}
+	for rows.Next() {
+		post := models.Post{Nickname: archive.Profile.Nickname}
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Title, &post.Slug, &post.Category, &post.Content, &post.CreatedAt); err != nil {
+			rows.Close()
+			return archive, err
+		}
+		archive.Posts = append(archive.Posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return archive, err
+	}
+	rows.Close()
+	if err := loadPostCategories(archive.Posts); err != nil {
+		return archive, err
+	}
+	if err := loadPostTags(archive.Posts); err != nil {
+		return archive, err
+	}
+	if err := loadPostAttachments(archive.Posts); err != nil {
+		return archive, err
+	}
+
+	rows, err = database.DB.Query(`
+		SELECT id, post_id, COALESCE(parent_comment_id, ''), user_id, content, created_at
+		FROM comments WHERE user_id = ? ORDER BY created_at ASC`, userID)
+	if err != nil {
+		return archive, err
+	}
+	for rows.Next() {
+		var comment models.Comment
+		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.ParentCommentID, &comment.UserID, &comment.Content, &comment.CreatedAt); err != nil {
+			rows.Close()
+			return archive, err
+		}
+		archive.Comments = append(archive.Comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return archive, err
+	}
+	rows.Close()
+	commentIDs := make([]string, len(archive.Comments))
+	for i, comment := range archive.Comments {
+		commentIDs[i] = comment.ID
+	}
+	attachments, err := loadAttachments("comment", commentIDs)
+	if err != nil {
+		return archive, err
+	}
+	for i, comment := range archive.Comments {
+		archive.Comments[i].Attachments = attachments[comment.ID]
+	}
+
+	rows, err = database.DB.Query(`
+		SELECT m.id, m.sender_id, u.nickname, m.receiver_id, m.content, m.created_at, m.sequence
+		FROM messages m
+		JOIN users u ON m.sender_id = u.id
+		WHERE m.sender_id = ? OR m.receiver_id = ?
+		ORDER BY m.created_at ASC`, userID, userID)
+	if err != nil {
+		return archive, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var msg models.Message
+		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.SenderNickname, &msg.ReceiverID, &msg.Content, &msg.CreatedAt, &msg.Sequence); err != nil {
+			return archive, err
+		}
+		if msg.Content, err = encryption.Decrypt(msg.Content, msg.ID); err != nil {
+			return archive, err
+		}
+		archive.Messages = append(archive.Messages, msg)
+	}
+	return archive, rows.Err()
+}
@@ -0,0 +1,184 @@
+package routes
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultFeedLimit = 20
+	maxFeedLimit     = 100
+)
+
+// feedSort describes one way of ordering the feed. Every sort is descending
+// and falls back to the post ID when keys tie.
+type feedSort struct {
+	column  string // the indexed column ordered on
+	key     string // the expression whose value goes into the cursor
+	numeric bool
+}
+
+const defaultFeedSort = "newest"
+
+var feedSorts = map[string]feedSort{
+	"newest":   {"posts.created_at", "CAST(posts.created_at AS TEXT)", false},
+	"active":   {"posts.last_activity_at", "CAST(posts.last_activity_at AS TEXT)", false},
+	"comments": {"posts.comment_count", "posts.comment_count", true},
+	"hot":      {"posts.hot_score", "posts.hot_score", true},
+}
+
+// feedCursor marks the last post of a page: the sort it belongs to, its sort
+// key and ID, so the next page starts strictly after it even when keys tie.
+type feedCursor struct {
+	Sort string
+	Key  string
+	ID   string
+}
+
+func (c feedCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Sort + "|" + c.Key + "|" + c.ID))
+}
+
+func decodeFeedCursor(s string) (feedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return feedCursor{}, errors.New("Invalid cursor")
+	}
+	parts := strings.Split(string(raw), "|")
+	// Cursors issued before sort modes existed hold only key and ID.
+	if len(parts) == 2 {
+		parts = append([]string{defaultFeedSort}, parts...)
+	}
+	if len(parts) != 3 || parts[2] == "" {
+		return feedCursor{}, errors.New("Invalid cursor")
+	}
+	return feedCursor{Sort: parts[0], Key: parts[1], ID: parts[2]}, nil
+}
+
+// cursorKey formats a sort key scanned from the database for a cursor.
+// Floats use the shortest form that parses back to the same value.
+func cursorKey(v interface{}) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+// keyArg converts a cursor key back into a query argument for sort.
+func (s feedSort) keyArg(key string) (interface{}, error) {
+	if !s.numeric {
+		return key, nil
+	}
+	n, err := strconv.ParseFloat(key, 64)
+	if err != nil {
+		return nil, errors.New("Invalid cursor")
+	}
+	return n, nil
+}
+
+type feedFilter struct {
+	Limit      int
+	Sort       string
+	Cursor     *feedCursor
+	Category   string
+	Tag        string
+	Author     string
+	From       string
+	To         string
+	NoComments bool
+}
+
+// parseFeedFilter reads the paging and filter parameters of the post feed.
+func parseFeedFilter(r *http.Request) (feedFilter, error) {
+	q := r.URL.Query()
+	f := feedFilter{
+		Limit:    defaultFeedLimit,
+		Sort:     defaultFeedSort,
+		Category: strings.TrimSpace(q.Get("category")),
+		Author:   strings.TrimSpace(q.Get("author")),
+	}
+
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			return f, errors.New("Limit must be a positive number")
+		}
+		f.Limit = min(n, maxFeedLimit)
+	}
+
+	if s := q.Get("sort"); s != "" {
+		if _, ok := feedSorts[s]; !ok {
+			return f, errors.New("Sort must be one of newest, active, comments or hot")
+		}
+		f.Sort = s
+	}
+
+	if c := q.Get("cursor"); c != "" {
+		cursor, err := decodeFeedCursor(c)
+		if err != nil {
+			return f, err
+		}
+		if cursor.Sort != f.Sort {
+			return f, errors.New("Cursor belongs to a different sort")
+		}
+		f.Cursor = &cursor
+	}
+
+	// A merged tag lists the posts of the tag it was merged into.
+	if t := q.Get("tag"); t != "" {
+		name, err := normalizeTag(t)
+		if err != nil {
+			return f, err
+		}
+		if _, f.Tag, _, _, err = canonicalTag(database.DB, name); err != nil {
+			return f, err
+		}
+	}
+
+	var err error
+	if f.From, err = parseFeedDate(q.Get("from"), false); err != nil {
+		return f, errors.New("Invalid from date")
+	}
+	if f.To, err = parseFeedDate(q.Get("to"), true); err != nil {
+		return f, errors.New("Invalid to date")
+	}
+
+	if nc := q.Get("no_comments"); nc != "" {
+		if f.NoComments, err = strconv.ParseBool(nc); err != nil {
+			return f, errors.New("no_comments must be true or false")
+		}
+	}
+	return f, nil
+}
+
+// parseFeedDate accepts an RFC3339 timestamp or a YYYY-MM-DD date. A bare
+// date used as the upper bound covers that whole day.
+func parseFeedDate(value string, endOfDay bool) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return utils.FormatTime(t), nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return "", err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Millisecond)
+	}
+	return utils.FormatTime(t), nil
+}
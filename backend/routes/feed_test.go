@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"encoding/base64"
+	"math"
+	"testing"
+)
+
+func TestFeedCursorRoundTrip(t *testing.T) {
+	for _, c := range []feedCursor{
+		{Sort: "newest", Key: "2026-01-02T03:04:05.678Z", ID: "1cc5c2f6-55a0-42a1-a9c2-ccc6525d8d38"},
+		{Sort: "comments", Key: "42", ID: "b8d41b37-53a8-4576-861c-c09793834405"},
+		{Sort: "hot", Key: cursorKey(-1.2345678901234567e+06), ID: "x"},
+		{Sort: "active", Key: "", ID: "no-activity-yet"},
+	} {
+		encoded := c.encode()
+		if _, err := base64.RawURLEncoding.DecodeString(encoded); err != nil {
+			t.Errorf("encode(%v) = %q is not URL-safe base64", c, encoded)
+		}
+		got, err := decodeFeedCursor(encoded)
+		if err != nil || got != c {
+			t.Errorf("decodeFeedCursor(encode(%v)) = %v, %v", c, got, err)
+		}
+	}
+}
+
+func TestDecodeFeedCursorLegacy(t *testing.T) {
+	// Cursors issued before sort modes existed hold only key and ID.
+	legacy := base64.RawURLEncoding.EncodeToString([]byte("2026-01-02T03:04:05.678Z|post-1"))
+	got, err := decodeFeedCursor(legacy)
+	want := feedCursor{Sort: defaultFeedSort, Key: "2026-01-02T03:04:05.678Z", ID: "post-1"}
+	if err != nil || got != want {
+		t.Errorf("decodeFeedCursor(legacy) = %v, %v; want %v", got, err, want)
+	}
+}
+
+func TestDecodeFeedCursorInvalid(t *testing.T) {
+	for name, s := range map[string]string{
+		"not base64":  "!!!",
+		"padded":      base64.URLEncoding.EncodeToString([]byte("newest|k|id")),
+		"one part":    base64.RawURLEncoding.EncodeToString([]byte("newest")),
+		"four parts":  base64.RawURLEncoding.EncodeToString([]byte("newest|k|id|x")),
+		"empty id":    base64.RawURLEncoding.EncodeToString([]byte("newest|k|")),
+		"empty input": "",
+	} {
+		if c, err := decodeFeedCursor(s); err == nil {
+			t.Errorf("%s: decodeFeedCursor(%q) = %v, want an error", name, s, c)
+		}
+	}
+}
+
+func TestCursorKeyParsesBack(t *testing.T) {
+	numeric := feedSorts["hot"]
+	for _, v := range []float64{0, 1.5, -3.25, 1e-300, math.MaxFloat64, 123456.78901234567} {
+		arg, err := numeric.keyArg(cursorKey(v))
+		if err != nil || arg != v {
+			t.Errorf("keyArg(cursorKey(%v)) = %v, %v", v, arg, err)
+		}
+	}
+	if _, err := numeric.keyArg("not a number"); err == nil {
+		t.Error("keyArg accepted a non-numeric key for a numeric sort")
+	}
+	for v, want := range map[interface{}]string{int64(7): "7", "text": "text", nil: ""} {
+		if got := cursorKey(v); got != want {
+			t.Errorf("cursorKey(%v) = %q, want %q", v, got, want)
+		}
+	}
+	if got := cursorKey([]byte("2026-01-02")); got != "2026-01-02" {
+		t.Errorf("cursorKey([]byte) = %q", got)
+	}
+}
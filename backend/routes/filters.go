@@ -0,0 +1,111 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"real-time-forum/backend/contentfilter"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/utils"
+)
+
+// filterContent runs content through the content filters before it is
+// stored. It writes the error response itself when the content is rejected
+// or the check fails.
+func filterContent(w http.ResponseWriter, c contentfilter.Content) (contentfilter.Verdict, bool) {
+	verdict, err := contentfilter.Check(c)
+	if err != nil {
+		http.Error(w, "Failed to check "+c.Kind+": "+err.Error(), http.StatusInternalServerError)
+		return verdict, false
+	}
+	if verdict.Action == contentfilter.Reject {
+		http.Error(w, verdict.Reason, http.StatusBadRequest)
+		return verdict, false
+	}
+	return verdict, true
+}
+
+// BannedWordsHandler lists the banned words (GET) or adds or changes one
+// (POST {"pattern": "...", "action": "mask"}).
+func BannedWordsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rows, err := database.DB.Query("SELECT pattern, action FROM banned_words ORDER BY pattern")
+		if err != nil {
+			http.Error(w, "Failed to fetch banned words: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		words := []contentfilter.BannedWord{}
+		for rows.Next() {
+			var word contentfilter.BannedWord
+			if err := rows.Scan(&word.Pattern, &word.Action); err != nil {
+				http.Error(w, "Failed to scan banned word: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			words = append(words, word)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, "Failed to fetch banned words: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(words)
+
+	case http.MethodPost:
+		var input contentfilter.BannedWord
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid input data", http.StatusBadRequest)
+			return
+		}
+		pattern, err := contentfilter.CleanPattern(input.Pattern)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		action, err := contentfilter.ParseAction(input.Action)
+		if err != nil || action == contentfilter.Allow {
+			http.Error(w, "Action must be mask, hold or reject", http.StatusBadRequest)
+			return
+		}
+		_, err = database.DB.Exec(`
+			INSERT INTO banned_words (pattern, action, created_at) VALUES (?, ?, ?)
+			ON CONFLICT(pattern) DO UPDATE SET action = excluded.action`,
+			pattern, action.String(), utils.Now())
+		if err != nil {
+			http.Error(w, "Failed to save banned word: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		contentfilter.ReloadBannedWords()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(contentfilter.BannedWord{Pattern: pattern, Action: action.String()})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// BannedWordHandler removes /api/admin/banned-words/{pattern} (DELETE).
+func BannedWordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	pattern, err := contentfilter.CleanPattern(r.PathValue("pattern"))
+	if err != nil {
+		http.Error(w, "Banned word not found", http.StatusNotFound)
+		return
+	}
+	res, err := database.DB.Exec("DELETE FROM banned_words WHERE pattern = ?", pattern)
+	if err != nil {
+		http.Error(w, "Failed to delete banned word: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Banned word not found", http.StatusNotFound)
+		return
+	}
+	contentfilter.ReloadBannedWords()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,216 @@
+package routes
+
+import (
+	"database/sql"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/mentions"
+	"real-time-forum/backend/models"
+	"strings"
+)
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// resolveMentions finds the @nicknames in content that name an active user.
+// Nicknames match case-insensitively; anything else stays plain text.
+func resolveMentions(db queryer, content string) ([]models.Mention, error) {
+	spans := mentions.Find(content)
+	if len(spans) == 0 {
+		return nil, nil
+	}
+	seen := make(map[string]bool)
+	var placeholders []string
+	var args []interface{}
+	for _, span := range spans {
+		name := strings.ToLower(span.Name)
+		if !seen[name] {
+			seen[name] = true
+			placeholders = append(placeholders, "LOWER(?)")
+			args = append(args, span.Name)
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT id, nickname FROM users
+		WHERE anonymized_at IS NULL AND LOWER(nickname) IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Nickname); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return matchMentions(spans, users), nil
+}
+
+// matchMentions keeps the spans naming one of users.
+func matchMentions(spans []mentions.Span, users []models.User) []models.Mention {
+	var found []models.Mention
+	for _, span := range spans {
+		for _, u := range users {
+			if strings.EqualFold(u.Nickname, span.Name) {
+				found = append(found, models.Mention{UserID: u.ID, Nickname: u.Nickname, Start: span.Start, End: span.End})
+				break
+			}
+		}
+	}
+	return found
+}
+
+// saveMentions replaces the stored mentions of a post or comment with the
+// ones in content. It returns the users mentioned for the first time, other
+// than the author, who should be notified.
+func saveMentions(tx *sql.Tx, targetType, targetID, content, authorID string) ([]string, error) {
+	found, err := resolveMentions(tx, content)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query("SELECT DISTINCT user_id FROM mentions WHERE target_type = ? AND target_id = ?", targetType, targetID)
+	if err != nil {
+		return nil, err
+	}
+	notified := map[string]bool{authorID: true}
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		notified[userID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM mentions WHERE target_type = ? AND target_id = ?", targetType, targetID); err != nil {
+		return nil, err
+	}
+	var added []string
+	for _, m := range found {
+		_, err := tx.Exec(`
+			INSERT INTO mentions (target_type, target_id, user_id, start_offset, end_offset)
+			VALUES (?, ?, ?, ?, ?)`, targetType, targetID, m.UserID, m.Start, m.End)
+		if err != nil {
+			return nil, err
+		}
+		if !notified[m.UserID] {
+			notified[m.UserID] = true
+			added = append(added, m.UserID)
+		}
+	}
+	return added, nil
+}
+
+// notifyMentions tells the users saveMentions returned that they were
+// mentioned in a post, or in one of its comments when commentID is set.
+func notifyMentions(tx *sql.Tx, userIDs []string, postID, commentID, actorID string) (map[string]models.Notification, error) {
+	return notify(tx, userIDs, models.Notification{
+		Type:      notificationMention,
+		PostID:    postID,
+		CommentID: commentID,
+		ActorID:   actorID,
+	})
+}
+
+// pendingMentions returns the users mentioned in a post, comment or message
+// who have not been notified about it, such as those mentioned while it was
+// hidden pending review. The author is left out.
+func pendingMentions(tx *sql.Tx, targetType, targetID, authorID string) ([]string, error) {
+	notified := map[string]string{
+		"post":    "notifications.post_id = mentions.target_id AND notifications.comment_id IS NULL",
+		"comment": "notifications.comment_id = mentions.target_id",
+		"message": "notifications.message_id = mentions.target_id",
+	}[targetType]
+	rows, err := tx.Query(`
+		SELECT DISTINCT user_id FROM mentions
+		WHERE target_type = ? AND target_id = ? AND user_id != ? AND NOT EXISTS (
+			SELECT 1 FROM notifications WHERE notifications.user_id = mentions.user_id
+				AND notifications.type = ? AND `+notified+`)`,
+		targetType, targetID, authorID, notificationMention)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+// loadMentions returns the mentions in each of ids in content order.
+func loadMentions(targetType string, ids []string) (map[string][]models.Mention, error) {
+	found := make(map[string][]models.Mention, len(ids))
+	if len(ids) == 0 {
+		return found, nil
+	}
+	placeholders := make([]string, len(ids))
+	args := []interface{}{targetType}
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args = append(args, id)
+		found[id] = []models.Mention{}
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT mentions.target_id, mentions.user_id, users.nickname, mentions.start_offset, mentions.end_offset
+		FROM mentions JOIN users ON users.id = mentions.user_id
+		WHERE mentions.target_type = ? AND mentions.target_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY mentions.start_offset ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var targetID string
+		var m models.Mention
+		if err := rows.Scan(&targetID, &m.UserID, &m.Nickname, &m.Start, &m.End); err != nil {
+			return nil, err
+		}
+		found[targetID] = append(found[targetID], m)
+	}
+	return found, rows.Err()
+}
+
+// loadPostMentions fills in Mentions for every post. Deleted posts show none.
+func loadPostMentions(posts []models.Post) error {
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	found, err := loadMentions("post", ids)
+	if err != nil {
+		return err
+	}
+	for i, post := range posts {
+		posts[i].Mentions = found[post.ID]
+		if post.Deleted || post.Hidden {
+			posts[i].Mentions = []models.Mention{}
+		}
+	}
+	return nil
+}
+
+// messageMentions finds the mentions in a direct message, resolved against
+// the two people in the conversation since nobody else can read it. They are
+// stored when the message is sent, and resolved again from the decrypted
+// text when history is read, which also covers messages sent before.
+func messageMentions(content string, participants ...models.User) []models.Mention {
+	return matchMentions(mentions.Find(content), participants)
+}
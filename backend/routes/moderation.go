@@ -0,0 +1,272 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/models"
+	"real-time-forum/backend/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	moderationPin    = "pin"
+	moderationUnpin  = "unpin"
+	moderationLock   = "lock"
+	moderationUnlock = "unlock"
+	moderationMove   = "move"
+
+	moderationCursorSort = "moderation"
+)
+
+// logModeration records a moderator's action in the moderation log.
+func logModeration(tx *sql.Tx, moderatorID, action, targetType, targetID, postID, detail string) error {
+	_, err := tx.Exec(`
+		INSERT INTO moderation_log (id, moderator_id, action, target_type, target_id, post_id, detail, created_at)
+		VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)`,
+		uuid.Must(uuid.NewV4()).String(), moderatorID, action, targetType, targetID, postID, detail, utils.Now())
+	return err
+}
+
+// PinPostHandler pins a post to the top of the feed (PUT) or unpins it
+// (DELETE).
+func PinPostHandler(w http.ResponseWriter, r *http.Request) {
+	setPostFlag(w, r, "pinned_at", moderationPin, moderationUnpin)
+}
+
+// LockPostHandler locks a post against new comments (PUT) or unlocks it
+// (DELETE).
+func LockPostHandler(w http.ResponseWriter, r *http.Request) {
+	setPostFlag(w, r, "locked_at", moderationLock, moderationUnlock)
+}
+
+// setPostFlag sets or clears one of the moderator timestamps on a post and
+// logs it. Setting a flag that is already set changes nothing.
+func setPostFlag(w http.ResponseWriter, r *http.Request, column, setAction, clearAction string) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	action, query := setAction, "UPDATE posts SET "+column+" = ? WHERE id = ? AND "+column+" IS NULL AND deleted_at IS NULL"
+	args := []interface{}{utils.Now(), id}
+	if r.Method == http.MethodDelete {
+		action, query = clearAction, "UPDATE posts SET "+column+" = NULL WHERE id = ? AND "+column+" IS NOT NULL AND deleted_at IS NULL"
+		args = args[1:]
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to "+action+" post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to "+action+" post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		if err := logModeration(tx, currentUserID, action, "post", id, id, ""); err != nil {
+			http.Error(w, "Failed to "+action+" post: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to "+action+" post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondModeratedPost(w, id, currentUserID, action)
+}
+
+// MovePostHandler moves a post to other categories (POST {"categories":
+// [...]}).
+func MovePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Categories []string `json:"categories"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+	categoryIDs, categories, err := resolveCategories(input.Categories)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("id")
+	var deleted bool
+	err = database.DB.QueryRow("SELECT deleted_at IS NOT NULL FROM posts WHERE id = ?", id).Scan(&deleted)
+	if err == sql.ErrNoRows || deleted {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	old := []models.Post{{ID: id}}
+	if err := loadPostCategories(old); err != nil {
+		http.Error(w, "Failed to fetch post categories: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to move post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := setPostCategories(tx, id, categoryIDs, categories); err != nil {
+		http.Error(w, "Failed to move post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	detail := strings.Join(old[0].Categories, ", ") + " -> " + strings.Join(categories, ", ")
+	if err := logModeration(tx, currentUserID, moderationMove, "post", id, id, detail); err != nil {
+		http.Error(w, "Failed to move post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to move post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondModeratedPost(w, id, currentUserID, moderationMove)
+}
+
+// respondModeratedPost tells every client a post was pinned, locked or
+// moved, and returns the post as it now is.
+func respondModeratedPost(w http.ResponseWriter, id, userID, action string) {
+	post, err := fetchPost(id, userID)
+	if err == sql.ErrNoRows || (err == nil && post.Deleted) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	broadcastEvent("post_moderated", map[string]interface{}{
+		"post_id":    post.ID,
+		"action":     action,
+		"pinned":     post.Pinned,
+		"locked":     post.Locked,
+		"categories": post.Categories,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(post)
+}
+
+// ModerationLogHandler lists moderator actions, newest first, paged with
+// limit and cursor like the feed. post narrows it to one post.
+func ModerationLogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	limit := defaultFeedLimit
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "Limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxFeedLimit)
+	}
+
+	var conditions []string
+	var args []interface{}
+	if postID := q.Get("post"); postID != "" {
+		conditions = append(conditions, "moderation_log.post_id = ?")
+		args = append(args, postID)
+	}
+	if c := q.Get("cursor"); c != "" {
+		cursor, err := decodeFeedCursor(c)
+		if err == nil && cursor.Sort != moderationCursorSort {
+			err = errors.New("Cursor belongs to a different list")
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "(moderation_log.created_at < ? OR (moderation_log.created_at = ? AND moderation_log.id < ?))")
+		args = append(args, cursor.Key, cursor.Key, cursor.ID)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT moderation_log.id, moderation_log.action, moderation_log.moderator_id, users.nickname,
+			moderation_log.target_type, moderation_log.target_id, COALESCE(moderation_log.post_id, ''), COALESCE(posts.title, ''),
+			moderation_log.detail, CAST(moderation_log.created_at AS TEXT)
+		FROM moderation_log
+		JOIN users ON users.id = moderation_log.moderator_id
+		LEFT JOIN posts ON posts.id = moderation_log.post_id
+		`+where+`
+		ORDER BY moderation_log.created_at DESC, moderation_log.id DESC LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		http.Error(w, "Failed to fetch moderation log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	actions := []models.ModerationAction{}
+	for rows.Next() {
+		var a models.ModerationAction
+		err := rows.Scan(&a.ID, &a.Action, &a.ModeratorID, &a.Moderator,
+			&a.TargetType, &a.TargetID, &a.PostID, &a.PostTitle, &a.Detail, &a.CreatedAt)
+		if err != nil {
+			http.Error(w, "Failed to scan moderation log: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		actions = append(actions, a)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to fetch moderation log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	nextCursor := ""
+	if len(actions) > limit {
+		actions = actions[:limit]
+		last := actions[limit-1]
+		nextCursor = feedCursor{Sort: moderationCursorSort, Key: last.CreatedAt, ID: last.ID}.encode()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"actions":     actions,
+		"next_cursor": nextCursor,
+	})
+}
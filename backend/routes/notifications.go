@@ -0,0 +1,606 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/models"
+	"real-time-forum/backend/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid"
+)
+
+const notificationCursorSort = "notifications"
+
+// Notification types. Users can turn each of them off.
+const (
+	notificationComment    = "comment"
+	notificationReply      = "reply"
+	notificationMention    = "mention"
+	notificationReaction   = "reaction"
+	notificationModeration = "moderation"
+	notificationReport     = "report"
+)
+
+var notificationTypes = []string{
+	notificationComment,
+	notificationReply,
+	notificationMention,
+	notificationReaction,
+	notificationModeration,
+	notificationReport,
+}
+
+// visibleNotifications hides notifications about deleted posts and
+// comments, and about posts, comments and messages hidden for review, except
+// those telling the author that a moderator removed them and those telling
+// reporters how their report was resolved.
+const visibleNotifications = `
+	(notifications.type IN ('moderation', 'report') OR (posts.deleted_at IS NULL AND posts.hidden_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM comments WHERE comments.id = notifications.comment_id
+			AND (comments.deleted_at IS NOT NULL OR comments.hidden_at IS NOT NULL))
+		AND NOT EXISTS (SELECT 1 FROM messages WHERE messages.id = notifications.message_id AND messages.hidden_at IS NOT NULL)))`
+
+// subscribe follows postID for userID unless they turned off following the
+// posts they take part in, or already unfollowed this one.
+func subscribe(tx *sql.Tx, userID, postID string) error {
+	_, err := tx.Exec(`
+		INSERT OR IGNORE INTO post_subscriptions (user_id, post_id, created_at)
+		SELECT id, ?, ? FROM users WHERE id = ? AND auto_subscribe = 1`,
+		postID, utils.Now(), userID)
+	return err
+}
+
+// notifySubscribers stores a notification about a new comment for everyone
+// following postID except its author and the users in skip, who were told
+// about it another way. It returns them by recipient so they can be pushed
+// once the transaction commits.
+func notifySubscribers(tx *sql.Tx, postID, commentID, actorID string, skip map[string]models.Notification) (map[string]models.Notification, error) {
+	rows, err := tx.Query(`
+		SELECT user_id FROM post_subscriptions
+		WHERE post_id = ? AND subscribed = 1 AND user_id != ?`, postID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	var recipients []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if _, ok := skip[userID]; !ok {
+			recipients = append(recipients, userID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return notify(tx, recipients, models.Notification{
+		Type:      notificationComment,
+		PostID:    postID,
+		CommentID: commentID,
+		ActorID:   actorID,
+	})
+}
+
+// notifyReply tells the author of parentCommentID that commentID answered
+// it, unless they wrote the reply themselves.
+func notifyReply(tx *sql.Tx, postID, parentCommentID, commentID, actorID string, skip map[string]models.Notification) (map[string]models.Notification, error) {
+	if parentCommentID == "" {
+		return nil, nil
+	}
+	var parentAuthorID string
+	if err := tx.QueryRow("SELECT user_id FROM comments WHERE id = ?", parentCommentID).Scan(&parentAuthorID); err != nil {
+		return nil, err
+	}
+	if _, ok := skip[parentAuthorID]; ok || parentAuthorID == actorID {
+		return nil, nil
+	}
+	return notify(tx, []string{parentAuthorID}, models.Notification{
+		Type:      notificationReply,
+		PostID:    postID,
+		CommentID: commentID,
+		ActorID:   actorID,
+	})
+}
+
+// notifyReaction tells the author of a post, or of commentID on it, that
+// actorID reacted. Taking a reaction back and giving it again does not
+// notify twice.
+func notifyReaction(tx *sql.Tx, authorID, postID, commentID, actorID, reaction string) (map[string]models.Notification, error) {
+	if authorID == actorID {
+		return nil, nil
+	}
+	var notified bool
+	err := tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM notifications
+		WHERE user_id = ? AND type = ? AND actor_id = ? AND post_id = ? AND COALESCE(comment_id, '') = ? AND detail = ?)`,
+		authorID, notificationReaction, actorID, postID, commentID, reaction).Scan(&notified)
+	if err != nil || notified {
+		return nil, err
+	}
+	return notify(tx, []string{authorID}, models.Notification{
+		Type:      notificationReaction,
+		PostID:    postID,
+		CommentID: commentID,
+		ActorID:   actorID,
+		Detail:    reaction,
+	})
+}
+
+// notifyModeration tells an author that a moderator acted on their post, or
+// on commentID in it. Moderators stay anonymous, and authors acting on
+// their own content are not notified.
+func notifyModeration(tx *sql.Tx, authorID, moderatorID, postID, commentID, action string) (map[string]models.Notification, error) {
+	if authorID == moderatorID {
+		return nil, nil
+	}
+	return notify(tx, []string{authorID}, models.Notification{
+		Type:      notificationModeration,
+		PostID:    postID,
+		CommentID: commentID,
+		Detail:    action,
+	})
+}
+
+// notify stores a copy of template for each recipient who has not turned
+// its type off, and returns them by recipient. Notifications about reports
+// on messages and users, and about mentions in messages, have no post.
+func notify(tx *sql.Tx, recipients []string, template models.Notification) (map[string]models.Notification, error) {
+	recipients, err := wantNotification(tx, recipients, template.Type)
+	if err != nil || len(recipients) == 0 {
+		return nil, err
+	}
+	template.CreatedAt = utils.Now()
+	if template.PostID != "" {
+		err = tx.QueryRow(`
+			SELECT posts.title, posts.slug, COALESCE(users.nickname, '')
+			FROM posts LEFT JOIN users ON users.id = ?
+			WHERE posts.id = ?`, template.ActorID, template.PostID).Scan(&template.PostTitle, &template.PostSlug, &template.Actor)
+	} else if template.ActorID != "" {
+		err = tx.QueryRow("SELECT nickname FROM users WHERE id = ?", template.ActorID).Scan(&template.Actor)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	notifications := make(map[string]models.Notification, len(recipients))
+	for _, userID := range recipients {
+		n := template
+		n.ID = uuid.Must(uuid.NewV4()).String()
+		_, err := tx.Exec(`
+			INSERT INTO notifications (id, user_id, type, post_id, comment_id, actor_id, report_id, message_id, detail, created_at)
+			VALUES (?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?, ?)`,
+			n.ID, userID, n.Type, n.PostID, n.CommentID, n.ActorID, n.ReportID, n.MessageID, n.Detail, n.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		notifications[userID] = n
+	}
+	return notifications, nil
+}
+
+// wantNotification leaves out the recipients who turned notificationType off.
+func wantNotification(tx *sql.Tx, recipients []string, notificationType string) ([]string, error) {
+	if len(recipients) == 0 {
+		return nil, nil
+	}
+	placeholders := make([]string, len(recipients))
+	args := []interface{}{notificationType}
+	for i, userID := range recipients {
+		placeholders[i] = "?"
+		args = append(args, userID)
+	}
+	rows, err := tx.Query(`
+		SELECT user_id FROM notification_preferences
+		WHERE type = ? AND enabled = 0 AND user_id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	disabled := make(map[string]bool)
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		disabled[userID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var wanted []string
+	for _, userID := range recipients {
+		if !disabled[userID] {
+			wanted = append(wanted, userID)
+		}
+	}
+	return wanted, nil
+}
+
+// pushNotifications delivers stored notifications to recipients who are
+// online. Everyone else sees them in their list on the next load.
+func pushNotifications(notifications map[string]models.Notification) {
+	for userID, n := range notifications {
+		sendEventTo(userID, "notification", n)
+	}
+}
+
+// SubscriptionHandler reports whether the current user follows a post (GET),
+// follows it (POST) or unfollows it (DELETE). Unfollowing is remembered, so
+// commenting on the post later does not follow it again.
+func SubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	postID := r.PathValue("id")
+
+	var deleted bool
+	err = database.DB.QueryRow("SELECT deleted_at IS NOT NULL FROM posts WHERE id = ?", postID).Scan(&deleted)
+	if err == sql.ErrNoRows || deleted {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var subscribed bool
+	switch r.Method {
+	case http.MethodGet:
+		err := database.DB.QueryRow(`
+			SELECT subscribed FROM post_subscriptions WHERE user_id = ? AND post_id = ?`,
+			currentUserID, postID).Scan(&subscribed)
+		if err != nil && err != sql.ErrNoRows {
+			http.Error(w, "Failed to fetch subscription: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	case http.MethodPost, http.MethodDelete:
+		subscribed = r.Method == http.MethodPost
+		_, err := database.DB.Exec(`
+			INSERT INTO post_subscriptions (user_id, post_id, subscribed, created_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(user_id, post_id) DO UPDATE SET subscribed = excluded.subscribed`,
+			currentUserID, postID, subscribed, utils.Now())
+		if err != nil {
+			http.Error(w, "Failed to update subscription: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"subscribed": subscribed})
+}
+
+// GetNotificationsHandler lists the current user's notifications, newest
+// first, with the number still unread. It pages like the feed, with limit
+// and cursor, and unread=1 leaves out the ones already read.
+func GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	limit := defaultFeedLimit
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "Limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxFeedLimit)
+	}
+
+	conditions := []string{"notifications.user_id = ?", visibleNotifications}
+	args := []interface{}{currentUserID}
+	if q.Get("unread") == "1" {
+		conditions = append(conditions, "notifications.read_at IS NULL")
+	}
+	if c := q.Get("cursor"); c != "" {
+		cursor, err := decodeFeedCursor(c)
+		if err == nil && cursor.Sort != notificationCursorSort {
+			err = errors.New("Cursor belongs to a different list")
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "(notifications.created_at < ? OR (notifications.created_at = ? AND notifications.id < ?))")
+		args = append(args, cursor.Key, cursor.Key, cursor.ID)
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT notifications.id, notifications.type, COALESCE(notifications.post_id, ''),
+			COALESCE(posts.title, ''), COALESCE(posts.slug, ''),
+			COALESCE(notifications.comment_id, ''), COALESCE(notifications.actor_id, ''), COALESCE(users.nickname, ''),
+			notifications.detail, COALESCE(notifications.report_id, ''), COALESCE(notifications.message_id, ''),
+			COALESCE(report_cases.target_type, ''),
+			CAST(notifications.created_at AS TEXT), notifications.read_at IS NOT NULL
+		FROM notifications
+		LEFT JOIN posts ON posts.id = notifications.post_id
+		LEFT JOIN users ON users.id = notifications.actor_id
+		LEFT JOIN report_cases ON report_cases.id = notifications.report_id
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY notifications.created_at DESC, notifications.id DESC LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		http.Error(w, "Failed to fetch notifications: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		err := rows.Scan(&n.ID, &n.Type, &n.PostID, &n.PostTitle, &n.PostSlug,
+			&n.CommentID, &n.ActorID, &n.Actor, &n.Detail, &n.ReportID, &n.MessageID, &n.Target, &n.CreatedAt, &n.Read)
+		if err != nil {
+			http.Error(w, "Failed to scan notification: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to fetch notifications: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	nextCursor := ""
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		last := notifications[limit-1]
+		nextCursor = feedCursor{Sort: notificationCursorSort, Key: last.CreatedAt, ID: last.ID}.encode()
+	}
+
+	unread, err := countUnreadNotifications(currentUserID)
+	if err != nil {
+		http.Error(w, "Failed to count notifications: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": notifications,
+		"unread":        unread,
+		"next_cursor":   nextCursor,
+	})
+}
+
+// MarkNotificationsReadHandler marks the notifications listed in
+// {"ids": [...]} as read, or all of the current user's when ids is empty.
+func MarkNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && err != io.EOF {
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+	if len(input.IDs) > maxFeedLimit {
+		http.Error(w, "Too many notifications", http.StatusBadRequest)
+		return
+	}
+
+	query := "UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL"
+	args := []interface{}{utils.Now(), currentUserID}
+	if len(input.IDs) > 0 {
+		placeholders := make([]string, len(input.IDs))
+		for i, id := range input.IDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		query += " AND id IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+	if _, err := database.DB.Exec(query, args...); err != nil {
+		http.Error(w, "Failed to update notifications: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	unread, err := countUnreadNotifications(currentUserID)
+	if err != nil {
+		http.Error(w, "Failed to count notifications: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"unread": unread})
+}
+
+// UnreadNotificationsHandler returns how many notifications the current
+// user has not read.
+func UnreadNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	unread, err := countUnreadNotifications(currentUserID)
+	if err != nil {
+		http.Error(w, "Failed to count notifications: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"unread": unread})
+}
+
+// NotificationSettingsHandler reads (GET) or changes (PUT) whether the
+// current user automatically follows the posts they write or comment on,
+// and which notification types they receive. PUT only changes the fields
+// and types it names.
+func NotificationSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+
+	case http.MethodPut:
+		var input struct {
+			AutoSubscribe *bool           `json:"auto_subscribe"`
+			Types         map[string]bool `json:"types"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid input data", http.StatusBadRequest)
+			return
+		}
+		for notificationType := range input.Types {
+			if !isNotificationType(notificationType) {
+				http.Error(w, "Unknown notification type: "+notificationType, http.StatusBadRequest)
+				return
+			}
+		}
+
+		tx, err := database.DB.Begin()
+		if err != nil {
+			http.Error(w, "Failed to update settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		if input.AutoSubscribe != nil {
+			if _, err := tx.Exec("UPDATE users SET auto_subscribe = ? WHERE id = ?", *input.AutoSubscribe, currentUserID); err != nil {
+				http.Error(w, "Failed to update settings: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		for notificationType, enabled := range input.Types {
+			_, err := tx.Exec(`
+				INSERT INTO notification_preferences (user_id, type, enabled) VALUES (?, ?, ?)
+				ON CONFLICT(user_id, type) DO UPDATE SET enabled = excluded.enabled`,
+				currentUserID, notificationType, enabled)
+			if err != nil {
+				http.Error(w, "Failed to update settings: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to update settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settings := struct {
+		AutoSubscribe bool            `json:"auto_subscribe"`
+		Types         map[string]bool `json:"types"`
+	}{Types: make(map[string]bool, len(notificationTypes))}
+	err = database.DB.QueryRow("SELECT auto_subscribe FROM users WHERE id = ?", currentUserID).Scan(&settings.AutoSubscribe)
+	if err != nil {
+		http.Error(w, "Failed to fetch settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, notificationType := range notificationTypes {
+		settings.Types[notificationType] = true
+	}
+	rows, err := database.DB.Query("SELECT type, enabled FROM notification_preferences WHERE user_id = ?", currentUserID)
+	if err != nil {
+		http.Error(w, "Failed to fetch settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var notificationType string
+		var enabled bool
+		if err := rows.Scan(&notificationType, &enabled); err != nil {
+			http.Error(w, "Failed to fetch settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if isNotificationType(notificationType) {
+			settings.Types[notificationType] = enabled
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+func isNotificationType(notificationType string) bool {
+	for _, t := range notificationTypes {
+		if t == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+func countUnreadNotifications(userID string) (int, error) {
+	var unread int
+	err := database.DB.QueryRow(`
+		SELECT COUNT(*) FROM notifications
+		LEFT JOIN posts ON posts.id = notifications.post_id
+		WHERE notifications.user_id = ? AND notifications.read_at IS NULL AND `+visibleNotifications,
+		userID).Scan(&unread)
+	return unread, err
+}
+
+// loadPostSubscriptions marks the posts userID follows.
+func loadPostSubscriptions(posts []models.Post, userID string) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(posts))
+	args := []interface{}{userID}
+	index := make(map[string]int, len(posts))
+	for i, post := range posts {
+		placeholders[i] = "?"
+		args = append(args, post.ID)
+		index[post.ID] = i
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT post_id FROM post_subscriptions
+		WHERE user_id = ? AND subscribed = 1 AND post_id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID string
+		if err := rows.Scan(&postID); err != nil {
+			return err
+		}
+		posts[index[postID]].Subscribed = true
+	}
+	return rows.Err()
+}
@@ -0,0 +1,369 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/models"
+	"real-time-forum/backend/utils"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	maxPollQuestionLength = 200
+	maxPollOptionLength   = 100
+	maxPollOptions        = 10
+)
+
+// cleanPoll checks the poll sent with a new post and returns it trimmed,
+// with closes_at in the stored time format. A nil poll stays nil.
+func cleanPoll(poll *models.Poll) (*models.Poll, error) {
+	if poll == nil {
+		return nil, nil
+	}
+	question := strings.TrimSpace(poll.Question)
+	if question == "" {
+		return nil, errors.New("Poll question is required")
+	}
+	if utf8.RuneCountInString(question) > maxPollQuestionLength {
+		return nil, fmt.Errorf("Poll question must be at most %d characters", maxPollQuestionLength)
+	}
+
+	var options []models.PollOption
+	seen := make(map[string]bool)
+	for _, option := range poll.Options {
+		text := strings.TrimSpace(option.Text)
+		if text == "" {
+			continue
+		}
+		if utf8.RuneCountInString(text) > maxPollOptionLength {
+			return nil, fmt.Errorf("Poll options must be at most %d characters", maxPollOptionLength)
+		}
+		if seen[strings.ToLower(text)] {
+			return nil, errors.New("Poll options must be different")
+		}
+		seen[strings.ToLower(text)] = true
+		options = append(options, models.PollOption{Text: text})
+	}
+	if len(options) < 2 || len(options) > maxPollOptions {
+		return nil, fmt.Errorf("A poll needs between 2 and %d options", maxPollOptions)
+	}
+
+	closesAt := ""
+	if poll.ClosesAt != "" {
+		t, err := time.Parse(time.RFC3339, poll.ClosesAt)
+		if err != nil {
+			return nil, errors.New("Poll close time must be an RFC3339 timestamp")
+		}
+		if !t.After(time.Now()) {
+			return nil, errors.New("Poll close time must be in the future")
+		}
+		closesAt = utils.FormatTime(t)
+	}
+
+	return &models.Poll{
+		Question:  question,
+		Multiple:  poll.Multiple,
+		Anonymous: poll.Anonymous,
+		ClosesAt:  closesAt,
+		Options:   options,
+		MyVotes:   []string{},
+	}, nil
+}
+
+// createPoll stores a poll checked by cleanPoll on a post, filling in the
+// ids of the poll and its options.
+func createPoll(tx *sql.Tx, postID string, poll *models.Poll) error {
+	poll.ID = uuid.Must(uuid.NewV4()).String()
+	var closesAt interface{}
+	if poll.ClosesAt != "" {
+		closesAt = poll.ClosesAt
+	}
+	_, err := tx.Exec(`
+		INSERT INTO polls (id, post_id, question, multiple, anonymous, closes_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		poll.ID, postID, poll.Question, poll.Multiple, poll.Anonymous, closesAt, utils.Now())
+	if err != nil {
+		return err
+	}
+	for i := range poll.Options {
+		poll.Options[i].ID = uuid.Must(uuid.NewV4()).String()
+		_, err := tx.Exec("INSERT INTO poll_options (id, poll_id, position, text) VALUES (?, ?, ?, ?)",
+			poll.Options[i].ID, poll.ID, i, poll.Options[i].Text)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PollVotesHandler casts the caller's vote on a poll (POST {"option_ids":
+// [...]}), replacing any earlier vote, or takes it back (DELETE). Single
+// choice polls take exactly one option. The new tally is pushed to every
+// connected client.
+func PollVotesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		OptionIDs []string `json:"option_ids"`
+	}
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid input data", http.StatusBadRequest)
+			return
+		}
+	}
+
+	pollID := r.PathValue("id")
+	var postID, closesAt string
+	var multiple, gone bool
+	// Polls on deleted posts and on posts hidden pending review take no votes.
+	err = database.DB.QueryRow(`
+		SELECT polls.post_id, polls.multiple, COALESCE(CAST(polls.closes_at AS TEXT), ''),
+			posts.deleted_at IS NOT NULL OR posts.hidden_at IS NOT NULL
+		FROM polls JOIN posts ON posts.id = polls.post_id
+		WHERE polls.id = ?`, pollID).Scan(&postID, &multiple, &closesAt, &gone)
+	if err == sql.ErrNoRows || gone {
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch poll: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if pollClosed(closesAt) {
+		http.Error(w, "Poll is closed", http.StatusConflict)
+		return
+	}
+
+	var optionIDs []string
+	if r.Method == http.MethodPost {
+		optionIDs, err = checkPollOptions(pollID, input.OptionIDs, multiple)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to save vote: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM poll_votes WHERE poll_id = ? AND user_id = ?", pollID, currentUserID); err != nil {
+		http.Error(w, "Failed to save vote: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := utils.Now()
+	for _, optionID := range optionIDs {
+		_, err := tx.Exec("INSERT INTO poll_votes (poll_id, option_id, user_id, created_at) VALUES (?, ?, ?, ?)",
+			pollID, optionID, currentUserID, now)
+		if err != nil {
+			http.Error(w, "Failed to save vote: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to save vote: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	polls, err := loadPolls([]string{postID}, currentUserID)
+	if err != nil {
+		http.Error(w, "Failed to fetch poll: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	poll := polls[postID]
+
+	// Everyone gets the tally; which options the voter chose stays with them.
+	tally := *poll
+	tally.MyVotes = nil
+	broadcastEvent("poll", map[string]interface{}{
+		"post_id": postID,
+		"poll":    tally,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(poll)
+}
+
+// checkPollOptions returns the distinct option ids chosen, making sure they
+// belong to the poll and that a single choice poll gets only one.
+func checkPollOptions(pollID string, ids []string, multiple bool) ([]string, error) {
+	var chosen []string
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			chosen = append(chosen, id)
+		}
+	}
+	if len(chosen) == 0 {
+		return nil, errors.New("Choose an option")
+	}
+	if len(chosen) > 1 && !multiple {
+		return nil, errors.New("This poll allows only one choice")
+	}
+
+	placeholders := make([]string, len(chosen))
+	args := []interface{}{pollID}
+	for i, id := range chosen {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+	var count int
+	err := database.DB.QueryRow(`
+		SELECT COUNT(*) FROM poll_options
+		WHERE poll_id = ? AND id IN (`+strings.Join(placeholders, ", ")+`)`, args...).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count != len(chosen) {
+		return nil, errors.New("Unknown poll option")
+	}
+	return chosen, nil
+}
+
+func pollClosed(closesAt string) bool {
+	return closesAt != "" && closesAt <= utils.Now()
+}
+
+// loadPolls returns the polls on postIDs, keyed by post, with their tallies
+// and the options userID voted for. Posts without a poll have no entry.
+func loadPolls(postIDs []string, userID string) (map[string]*models.Poll, error) {
+	polls := make(map[string]*models.Poll)
+	if len(postIDs) == 0 {
+		return polls, nil
+	}
+	placeholders := make([]string, len(postIDs))
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, post_id, question, multiple, anonymous, COALESCE(CAST(closes_at AS TEXT), '')
+		FROM polls WHERE post_id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*models.Poll)
+	var pollPlaceholders []string
+	var pollArgs []interface{}
+	for rows.Next() {
+		var postID string
+		poll := &models.Poll{Options: []models.PollOption{}, MyVotes: []string{}}
+		if err := rows.Scan(&poll.ID, &postID, &poll.Question, &poll.Multiple, &poll.Anonymous, &poll.ClosesAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		poll.Closed = pollClosed(poll.ClosesAt)
+		polls[postID] = poll
+		byID[poll.ID] = poll
+		pollPlaceholders = append(pollPlaceholders, "?")
+		pollArgs = append(pollArgs, poll.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(byID) == 0 {
+		return polls, nil
+	}
+	in := "(" + strings.Join(pollPlaceholders, ", ") + ")"
+
+	rows, err = database.DB.Query(`
+		SELECT id, poll_id, text FROM poll_options
+		WHERE poll_id IN `+in+` ORDER BY position ASC`, pollArgs...)
+	if err != nil {
+		return nil, err
+	}
+	// Index into each poll's Options, by option id.
+	optionIndex := make(map[string]int)
+	for rows.Next() {
+		var pollID string
+		var option models.PollOption
+		if err := rows.Scan(&option.ID, &pollID, &option.Text); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		poll := byID[pollID]
+		optionIndex[option.ID] = len(poll.Options)
+		poll.Options = append(poll.Options, option)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = database.DB.Query(`
+		SELECT v.poll_id, v.option_id, v.user_id, u.nickname
+		FROM poll_votes v JOIN users u ON u.id = v.user_id
+		WHERE v.poll_id IN `+in+` ORDER BY v.created_at ASC`, pollArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	voters := make(map[string]map[string]bool)
+	for rows.Next() {
+		var pollID, optionID, voterID, nickname string
+		if err := rows.Scan(&pollID, &optionID, &voterID, &nickname); err != nil {
+			return nil, err
+		}
+		poll := byID[pollID]
+		option := &poll.Options[optionIndex[optionID]]
+		option.Votes++
+		if !poll.Anonymous {
+			option.Voters = append(option.Voters, nickname)
+		}
+		if voterID == userID {
+			poll.MyVotes = append(poll.MyVotes, optionID)
+		}
+		if voters[pollID] == nil {
+			voters[pollID] = make(map[string]bool)
+		}
+		voters[pollID][voterID] = true
+	}
+	for pollID, poll := range byID {
+		poll.Voters = len(voters[pollID])
+	}
+	return polls, rows.Err()
+}
+
+// loadPostPolls fills in Poll for every post that has one. Deleted posts
+// show none.
+func loadPostPolls(posts []models.Post, userID string) error {
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	polls, err := loadPolls(ids, userID)
+	if err != nil {
+		return err
+	}
+	for i, post := range posts {
+		posts[i].Poll = nil
+		if !post.Deleted && !post.Hidden {
+			posts[i].Poll = polls[post.ID]
+		}
+	}
+	return nil
+}
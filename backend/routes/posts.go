@@ -1,78 +1,468 @@
 package routes
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"real-time-forum/backend/config"
+	"real-time-forum/backend/contentfilter"
 	"real-time-forum/backend/database"
+	"real-time-forum/backend/markdown"
 	"real-time-forum/backend/models"
+	"real-time-forum/backend/utils"
+	"strings"
 
 	"github.com/gofrs/uuid"
 )
 
+const (
+	maxTitleLength   = 120
+	maxContentLength = 50000
+)
+
+type CommentResponse struct {
+	ID              string              `json:"id"`
+	PostID          string              `json:"post_id"`
+	UserID          string              `json:"user_id"`
+	Nickname        string              `json:"nickname"`
+	Content         string              `json:"content"`
+	ContentHTML     string              `json:"content_html"`
+	CreatedAt       string              `json:"created_at"`
+	Edited          bool                `json:"edited"`
+	EditedAt        string              `json:"edited_at,omitempty"`
+	Deleted         bool                `json:"deleted,omitempty"`
+	Hidden          bool                `json:"hidden,omitempty"`
+	ParentCommentID string              `json:"parent_comment_id,omitempty"`
+	Depth           int                 `json:"depth"`
+	Path            string              `json:"path"`
+	ReplyCount      int                 `json:"reply_count"`
+	Reactions       map[string]int      `json:"reactions"`
+	MyReactions     []string            `json:"my_reactions"`
+	Attachments     []models.Attachment `json:"attachments"`
+	Mentions        []models.Mention    `json:"mentions"`
+}
+
+// postColumns is the select list read by scanPost; queries using it must
+// select FROM postTables.
+const postColumns = `posts.id, posts.user_id, users.nickname, posts.title, posts.slug, posts.category, posts.content, posts.content_html,
+	posts.created_at, COALESCE(CAST(posts.edited_at AS TEXT), ''), posts.deleted_at IS NOT NULL,
+	posts.comment_count, COALESCE(CAST(posts.last_comment_at AS TEXT), ''), COALESCE(last_commenter.nickname, ''),
+	COALESCE(CAST(posts.last_activity_at AS TEXT), ''), posts.pinned_at IS NOT NULL, posts.locked_at IS NOT NULL,
+	posts.hidden_at IS NOT NULL`
+
+const postTables = `posts
+	JOIN users ON posts.user_id = users.id
+	LEFT JOIN users last_commenter ON last_commenter.id = posts.last_commenter_id`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPost reads postColumns, followed by any extra columns into extra.
+// Deleted posts keep their place but lose their author, title and content.
+func scanPost(row rowScanner, extra ...interface{}) (models.Post, error) {
+	var post models.Post
+	dest := []interface{}{&post.ID, &post.UserID, &post.Nickname, &post.Title, &post.Slug, &post.Category, &post.Content, &post.ContentHTML,
+		&post.CreatedAt, &post.EditedAt, &post.Deleted,
+		&post.CommentCount, &post.LastCommentAt, &post.LastCommenter, &post.LastActivityAt,
+		&post.Pinned, &post.Locked, &post.Hidden}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return post, err
+	}
+	post.Edited = post.EditedAt != ""
+	if post.Deleted {
+		post.UserID = ""
+		post.Nickname = ""
+		post.Title = "[deleted]"
+		post.Content = ""
+	} else if post.Hidden {
+		post.Title = "[hidden pending review]"
+		post.Content = ""
+	}
+	if post.Deleted || post.Hidden {
+		post.ContentHTML = ""
+	}
+	return post, nil
+}
+
 func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	var post models.Post
 	if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
 		http.Error(w, "Invalid input data", http.StatusBadRequest)
 		return
 	}
+	// The author is whoever is signed in, whatever user_id the body names.
+	post.UserID = currentUserID
+
+	title, err := cleanTitle(post.Title)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	post.Title = title
+	if err := checkContentLength(post.Content); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Older clients send a single category instead of the categories list.
+	if len(post.Categories) == 0 {
+		post.Categories = []string{post.Category}
+	}
+	categoryIDs, categories, err := resolveCategories(post.Categories)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	post.Categories = categories
+	post.Category = categories[0]
+	if post.Tags, err = cleanTags(post.Tags); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if post.Poll, err = cleanPoll(post.Poll); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Only the signed-in user's own uploads can be attached.
+	attachmentIDs, err := checkAttachments(currentUserID, post.AttachmentIDs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	verdict, ok := filterContent(w, contentfilter.Content{Kind: "post", AuthorID: currentUserID, Title: post.Title, Text: post.Content})
+	if !ok {
+		return
+	}
+	post.Title, post.Content = verdict.Title, verdict.Text
+	post.Hidden = verdict.Action == contentfilter.Hold
 
 	post.ID = uuid.Must(uuid.NewV4()).String()
+	post.Slug = utils.Slugify(post.Title)
+	post.ContentHTML = markdown.Render(post.Content)
+	post.CreatedAt = utils.Now()
+	post.Reactions = map[string]int{}
+	post.MyReactions = []string{}
 
-	_, err := database.DB.Exec(`
-		INSERT INTO posts (id, user_id, category, content)
-		VALUES (?, ?, ?, ?)`,
-		post.ID, post.UserID, post.Category, post.Content)
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO posts (id, user_id, title, slug, category, content, content_html, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		post.ID, post.UserID, post.Title, post.Slug, post.Category, post.Content, post.ContentHTML, post.CreatedAt)
+	if err != nil {
+		http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, categoryID := range categoryIDs {
+		if _, err := tx.Exec("INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)", post.ID, categoryID); err != nil {
+			http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := setPostTags(tx, post.ID, post.Tags); err != nil {
+		http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if post.Poll != nil {
+		if err := createPoll(tx, post.ID, post.Poll); err != nil {
+			http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := attachAttachments(tx, currentUserID, "post", post.ID, attachmentIDs); err != nil {
+		http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := database.RefreshPostActivity(tx, post.ID); err != nil {
+		http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := subscribe(tx, post.UserID, post.ID); err != nil {
+		http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := discardDraft(tx, currentUserID, postDraftContext); err != nil {
+		http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	mentioned, err := saveMentions(tx, "post", post.ID, post.Content, post.UserID)
 	if err != nil {
 		http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// Posts held for review stay quiet until a moderator lets them through.
+	var notifications map[string]models.Notification
+	if post.Hidden {
+		err = holdForReview(tx, "post", post.ID, post.UserID, post.ID, verdict.Reason)
+	} else {
+		notifications, err = notifyMentions(tx, mentioned, post.ID, "", post.UserID)
+	}
+	if err != nil {
+		http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	post.LastActivityAt = post.CreatedAt
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pushNotifications(notifications)
 
 	err = database.DB.QueryRow("SELECT nickname FROM users WHERE id = ?", post.UserID).Scan(&post.Nickname)
 	if err != nil {
 		http.Error(w, "Failed to fetch user nickname: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	attachments, err := loadAttachments("post", []string{post.ID})
+	if err != nil {
+		http.Error(w, "Failed to fetch attachments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	post.AttachmentIDs = nil
+	post.Attachments = attachments[post.ID]
+	found, err := loadMentions("post", []string{post.ID})
+	if err != nil {
+		http.Error(w, "Failed to fetch mentions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	post.Mentions = found[post.ID]
+	err = database.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM post_subscriptions WHERE user_id = ? AND post_id = ? AND subscribed = 1)`,
+		post.UserID, post.ID).Scan(&post.Subscribed)
+	if err != nil {
+		http.Error(w, "Failed to fetch subscription: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !post.Hidden {
+		broadcastNewPost(post)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(post)
 }
 
+// queryFeed runs a feed query selecting postColumns and one sort key, and
+// returns the posts with their sort keys formatted for a cursor.
+func queryFeed(query string, args []interface{}) ([]models.Post, []string, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	var sortKeys []string
+	for rows.Next() {
+		var sortKey interface{}
+		post, err := scanPost(rows, &sortKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		posts = append(posts, post)
+		sortKeys = append(sortKeys, cursorKey(sortKey))
+	}
+	return posts, sortKeys, rows.Err()
+}
+
 func GetPostsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	query := `
-	SELECT posts.id, posts.user_id, users.nickname, posts.category, posts.content, posts.created_at 
-	FROM posts 
-	JOIN users ON posts.user_id = users.id 
-	ORDER BY posts.created_at DESC`
-	rows, err := database.DB.Query(query)
+	currentUserID, _ := utils.GetSession(r)
+
+	filter, err := parseFeedFilter(r)
 	if err != nil {
-		http.Error(w, "Failed to fetch posts: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
 
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		if err := rows.Scan(&post.ID, &post.UserID, &post.Nickname, &post.Category, &post.Content, &post.CreatedAt); err != nil {
-			http.Error(w, "Failed to scan post: "+err.Error(), http.StatusInternalServerError)
+	sort := feedSorts[filter.Sort]
+	conditions := []string{"posts.deleted_at IS NULL", "posts.hidden_at IS NULL"}
+	var args []interface{}
+	if filter.Category != "" {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM post_categories pc JOIN categories c ON c.id = pc.category_id
+			WHERE pc.post_id = posts.id AND c.name = ?)`)
+		args = append(args, filter.Category)
+	}
+	if filter.Tag != "" {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM post_tags pt JOIN tags t ON t.id = pt.tag_id
+			WHERE pt.post_id = posts.id AND t.name = ? AND t.banned = 0)`)
+		args = append(args, filter.Tag)
+	}
+	if filter.Author != "" {
+		conditions = append(conditions, "LOWER(users.nickname) = LOWER(?)")
+		args = append(args, filter.Author)
+	}
+	if filter.From != "" {
+		conditions = append(conditions, "posts.created_at >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.To != "" {
+		conditions = append(conditions, "posts.created_at <= ?")
+		args = append(args, filter.To)
+	}
+	if filter.NoComments {
+		conditions = append(conditions, "posts.comment_count = 0")
+	}
+
+	// Pinned posts matching the filters head the first page and are left
+	// out of the pages themselves, so cursors work the same with or without
+	// them.
+	posts := []models.Post{}
+	if filter.Cursor == nil {
+		pinned, _, err := queryFeed(`
+		SELECT `+postColumns+`, posts.pinned_at
+		FROM `+postTables+`
+		WHERE `+strings.Join(append(conditions, "posts.pinned_at IS NOT NULL"), " AND ")+`
+		ORDER BY posts.pinned_at DESC, posts.id DESC`, args)
+		if err != nil {
+			http.Error(w, "Failed to fetch posts: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
-		posts = append(posts, post)
+		posts = append(posts, pinned...)
+	}
+
+	conditions = append(conditions, "posts.pinned_at IS NULL")
+	if filter.Cursor != nil {
+		key, err := sort.keyArg(filter.Cursor.Key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "("+sort.column+" < ? OR ("+sort.column+" = ? AND posts.id < ?))")
+		args = append(args, key, key, filter.Cursor.ID)
+	}
+
+	query := `
+	SELECT ` + postColumns + `, ` + sort.key + `
+	FROM ` + postTables + `
+	WHERE ` + strings.Join(conditions, " AND ")
+	// Fetch one extra row to know whether there is a next page.
+	query += "\n\tORDER BY " + sort.column + " DESC, posts.id DESC LIMIT ?"
+	page, sortKeys, err := queryFeed(query, append(args, filter.Limit+1))
+	if err != nil {
+		http.Error(w, "Failed to fetch posts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	nextCursor := ""
+	if len(page) > filter.Limit {
+		page = page[:filter.Limit]
+		last := filter.Limit - 1
+		nextCursor = feedCursor{Sort: filter.Sort, Key: sortKeys[last], ID: page[last].ID}.encode()
+	}
+	posts = append(posts, page...)
+
+	if err := loadPostDetails(posts, currentUserID); err != nil {
+		http.Error(w, "Failed to fetch posts: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(posts)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"posts":       posts,
+		"next_cursor": nextCursor,
+	})
+}
+
+// GetPostHandler returns a single post, addressed as /api/posts/{id}, with
+// its comments.
+func GetPostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, _ := utils.GetSession(r)
+
+	post, err := fetchPost(r.PathValue("id"), currentUserID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	comments, err := fetchComments(post.ID, currentUserID)
+	if err != nil {
+		http.Error(w, "Failed to fetch comments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		models.Post
+		Comments []CommentResponse `json:"comments"`
+	}{post, comments})
+}
+
+// fetchPost loads one post with its details as seen by userID.
+func fetchPost(id, userID string) (models.Post, error) {
+	post, err := scanPost(database.DB.QueryRow(`
+		SELECT `+postColumns+`
+		FROM `+postTables+`
+		WHERE posts.id = ?`, id))
+	if err != nil {
+		return post, err
+	}
+	single := []models.Post{post}
+	err = loadPostDetails(single, userID)
+	return single[0], err
+}
+
+// loadPostDetails fills in what posts show beyond their own row: categories,
+// tags, attachments, mentions, and the reactions, poll votes, bookmarks and
+// subscriptions as seen by userID.
+func loadPostDetails(posts []models.Post, userID string) error {
+	if err := loadPostCategories(posts); err != nil {
+		return err
+	}
+	if err := loadPostTags(posts); err != nil {
+		return err
+	}
+	if err := loadPostReactions(posts, userID); err != nil {
+		return err
+	}
+	if err := loadPostPolls(posts, userID); err != nil {
+		return err
+	}
+	if err := loadPostAttachments(posts); err != nil {
+		return err
+	}
+	if err := loadPostBookmarks(posts, userID); err != nil {
+		return err
+	}
+	if err := loadPostSubscriptions(posts, userID); err != nil {
+		return err
+	}
+	return loadPostMentions(posts)
 }
 
 func CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
@@ -81,27 +471,212 @@ func CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	var comment models.Comment
 	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
 		http.Error(w, "Invalid input data", http.StatusBadRequest)
 		return
 	}
+	// The author is whoever is signed in, whatever user_id the body names.
+	comment.UserID = currentUserID
+	if err := checkContentLength(comment.Content); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var postDeleted, postLocked bool
+	err = database.DB.QueryRow("SELECT deleted_at IS NOT NULL, locked_at IS NOT NULL FROM posts WHERE id = ?", comment.PostID).Scan(&postDeleted, &postLocked)
+	if err == sql.ErrNoRows || postDeleted {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Only moderators and admins may comment on a locked post.
+	if postLocked {
+		staff, err := isStaff(currentUserID)
+		if err != nil {
+			http.Error(w, "Failed to fetch user role: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !staff {
+			http.Error(w, "Post is locked", http.StatusForbidden)
+			return
+		}
+	}
+
+	// Only the signed-in user's own uploads can be attached.
+	attachmentIDs, err := checkAttachments(currentUserID, comment.AttachmentIDs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	verdict, ok := filterContent(w, contentfilter.Content{Kind: "comment", AuthorID: currentUserID, Text: comment.Content})
+	if !ok {
+		return
+	}
+	comment.Content = verdict.Text
+	held := verdict.Action == contentfilter.Hold
 
 	comment.ID = uuid.Must(uuid.NewV4()).String()
+	comment.CreatedAt = utils.Now()
 
-	_, err := database.DB.Exec(`
-		INSERT INTO comments (id, post_id, user_id, content)
-		VALUES (?, ?, ?, ?)`,
-		comment.ID, comment.PostID, comment.UserID, comment.Content)
+	// A comment's path is its parent's path plus its own sort key, so
+	// ordering by path lists each thread depth-first in time order.
+	depth := 0
+	path := comment.CreatedAt + comment.ID
+	if comment.ParentCommentID != "" {
+		var parentPath string
+		var parentDepth int
+		var parentDeleted bool
+		err := database.DB.QueryRow(`
+			SELECT path, depth, deleted_at IS NOT NULL FROM comments WHERE id = ? AND post_id = ?`,
+			comment.ParentCommentID, comment.PostID).Scan(&parentPath, &parentDepth, &parentDeleted)
+		if err == sql.ErrNoRows || parentDeleted {
+			http.Error(w, "Parent comment not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch parent comment: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if parentDepth+1 > config.CommentMaxDepth {
+			http.Error(w, fmt.Sprintf("Replies can be nested at most %d levels deep", config.CommentMaxDepth), http.StatusBadRequest)
+			return
+		}
+		depth = parentDepth + 1
+		path = parentPath + "/" + path
+	}
+
+	tx, err := database.DB.Begin()
 	if err != nil {
 		http.Error(w, "Failed to create comment: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO comments (id, post_id, parent_comment_id, user_id, content, content_html, created_at, depth, path)
+		VALUES (?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?)`,
+		comment.ID, comment.PostID, comment.ParentCommentID, comment.UserID, comment.Content, markdown.Render(comment.Content),
+		comment.CreatedAt, depth, path)
+	if err != nil {
+		http.Error(w, "Failed to create comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := attachAttachments(tx, currentUserID, "comment", comment.ID, attachmentIDs); err != nil {
+		http.Error(w, "Failed to create comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := database.RefreshPostActivity(tx, comment.PostID); err != nil {
+		http.Error(w, "Failed to update post activity: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := subscribe(tx, comment.UserID, comment.PostID); err != nil {
+		http.Error(w, "Failed to create comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := discardDraft(tx, currentUserID, commentDraftContext(comment.PostID, comment.ParentCommentID)); err != nil {
+		http.Error(w, "Failed to create comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	mentioned, err := saveMentions(tx, "comment", comment.ID, comment.Content, comment.UserID)
+	if err != nil {
+		http.Error(w, "Failed to create comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Comments held for review stay quiet until a moderator lets them through.
+	if held {
+		if err := holdForReview(tx, "comment", comment.ID, comment.UserID, comment.PostID, verdict.Reason); err != nil {
+			http.Error(w, "Failed to create comment: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to create comment: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("Comment is held for review"))
+		return
+	}
+	mentionNotifications, err := notifyMentions(tx, mentioned, comment.PostID, comment.ID, comment.UserID)
+	if err != nil {
+		http.Error(w, "Failed to notify mentioned users: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Each user gets one notification per comment: a mention beats a reply,
+	// which beats the one for following the post.
+	replyNotifications, err := notifyReply(tx, comment.PostID, comment.ParentCommentID, comment.ID, comment.UserID, mentionNotifications)
+	if err != nil {
+		http.Error(w, "Failed to notify comment author: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	skip := make(map[string]models.Notification)
+	for _, sent := range []map[string]models.Notification{mentionNotifications, replyNotifications} {
+		for userID, n := range sent {
+			skip[userID] = n
+		}
+	}
+	notifications, err := notifySubscribers(tx, comment.PostID, comment.ID, comment.UserID, skip)
+	if err != nil {
+		http.Error(w, "Failed to notify subscribers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to create comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pushNotifications(skip)
+	pushNotifications(notifications)
+	broadcastNewComment(comment.PostID, comment.ID, comment.ParentCommentID, comment.UserID)
 
 	w.WriteHeader(http.StatusCreated)
 	w.Write([]byte("Comment created successfully"))
 }
 
+// broadcastNewPost tells clients a post was published so feeds showing its
+// categories and tags can offer to load it.
+func broadcastNewPost(post models.Post) {
+	broadcastEvent("new_post", map[string]interface{}{
+		"post_id":    post.ID,
+		"user_id":    post.UserID,
+		"categories": post.Categories,
+		"tags":       post.Tags,
+	})
+}
+
+// broadcastNewComment tells clients a comment was published, so they update
+// the post's comment count and reload an open thread.
+func broadcastNewComment(postID, commentID, parentCommentID, userID string) {
+	var commentCount int
+	var lastCommentAt, lastCommenter string
+	err := database.DB.QueryRow(`
+		SELECT posts.comment_count, COALESCE(CAST(posts.last_comment_at AS TEXT), ''), COALESCE(users.nickname, '')
+		FROM posts LEFT JOIN users ON users.id = posts.last_commenter_id
+		WHERE posts.id = ?`, postID).Scan(&commentCount, &lastCommentAt, &lastCommenter)
+	if err != nil {
+		// The comment is saved; clients will see it on their next load.
+		fmt.Println("Error fetching post activity:", err)
+		return
+	}
+	broadcastEvent("new_comment", map[string]interface{}{
+		"post_id":           postID,
+		"comment_id":        commentID,
+		"parent_comment_id": parentCommentID,
+		"user_id":           userID,
+		"comment_count":     commentCount,
+		"last_comment_at":   lastCommentAt,
+		"last_commenter":    lastCommenter,
+	})
+}
+
 func GetCommentsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -114,35 +689,82 @@ func GetCommentsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	currentUserID, _ := utils.GetSession(r)
+
+	comments, err := fetchComments(postID, currentUserID)
+	if err != nil {
+		http.Error(w, "Failed to fetch comments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comments)
+}
+
+func fetchComments(postID, userID string) ([]CommentResponse, error) {
 	query := `
-		SELECT c.id, c.post_id, u.nickname, c.content, c.created_at
+		SELECT c.id, c.post_id, c.user_id, u.nickname, c.content, c.content_html, c.created_at,
+			COALESCE(CAST(c.edited_at AS TEXT), ''), c.deleted_at IS NOT NULL, c.hidden_at IS NOT NULL,
+			COALESCE(c.parent_comment_id, ''), c.depth, c.path,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_comment_id = c.id AND r.deleted_at IS NULL AND r.hidden_at IS NULL)
 		FROM comments c
 		JOIN users u ON c.user_id = u.id
-		WHERE c.post_id = ? ORDER BY c.created_at ASC`
+		WHERE c.post_id = ? ORDER BY c.path ASC`
 	rows, err := database.DB.Query(query, postID)
 	if err != nil {
-		http.Error(w, "Failed to fetch comments: "+err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
-	type CommentResponse struct {
-		ID        string `json:"id"`
-		PostID    string `json:"post_id"`
-		Nickname  string `json:"nickname"`
-		Content   string `json:"content"`
-		CreatedAt string `json:"created_at"`
-	}
-	var comments []CommentResponse
+	comments := []CommentResponse{}
 	for rows.Next() {
 		var c CommentResponse
-		if err := rows.Scan(&c.ID, &c.PostID, &c.Nickname, &c.Content, &c.CreatedAt); err != nil {
-			http.Error(w, "Failed to scan comment: "+err.Error(), http.StatusInternalServerError)
-			return
+		if err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Nickname, &c.Content, &c.ContentHTML, &c.CreatedAt, &c.EditedAt, &c.Deleted, &c.Hidden,
+			&c.ParentCommentID, &c.Depth, &c.Path, &c.ReplyCount); err != nil {
+			return nil, err
+		}
+		c.Edited = c.EditedAt != ""
+		// Deleted comments stay in the thread as placeholders.
+		if c.Deleted {
+			c.UserID = ""
+			c.Nickname = ""
+			c.Content = ""
+			c.ContentHTML = ""
+		} else if c.Hidden {
+			c.Content = ""
+			c.ContentHTML = ""
 		}
 		comments = append(comments, c)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(comments)
+	ids := make([]string, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+	counts, mine, err := loadReactions("comment", ids, userID)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := loadAttachments("comment", ids)
+	if err != nil {
+		return nil, err
+	}
+	found, err := loadMentions("comment", ids)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range comments {
+		comments[i].Reactions = counts[c.ID]
+		comments[i].MyReactions = mine[c.ID]
+		comments[i].Attachments = attachments[c.ID]
+		comments[i].Mentions = found[c.ID]
+		if c.Deleted || c.Hidden {
+			comments[i].Attachments = []models.Attachment{}
+			comments[i].Mentions = []models.Mention{}
+		}
+	}
+	return comments, nil
 }
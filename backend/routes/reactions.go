@@ -0,0 +1,234 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"real-time-forum/backend/config"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/models"
+	"real-time-forum/backend/utils"
+	"strings"
+)
+
+const (
+	ReactionLike    = "like"
+	ReactionDislike = "dislike"
+)
+
+// allowedReactions lists like and dislike followed by the configured emoji.
+func allowedReactions() []string {
+	return append([]string{ReactionLike, ReactionDislike}, config.ReactionEmoji...)
+}
+
+func isAllowedReaction(reaction string) bool {
+	for _, allowed := range allowedReactions() {
+		if reaction == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// GetReactionsHandler returns the reactions users may choose from.
+func GetReactionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"reactions": allowedReactions()})
+}
+
+func PostReactionHandler(w http.ResponseWriter, r *http.Request) {
+	toggleReaction(w, r, "post")
+}
+
+func CommentReactionHandler(w http.ResponseWriter, r *http.Request) {
+	toggleReaction(w, r, "comment")
+}
+
+// toggleReaction adds the caller's reaction to a post or comment, or removes
+// it if they already gave it. Like and dislike exclude each other. The new
+// counts are pushed to every connected client.
+func toggleReaction(w http.ResponseWriter, r *http.Request, targetType string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Reaction string `json:"reaction"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+	if !isAllowedReaction(input.Reaction) {
+		http.Error(w, "Unknown reaction", http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("id")
+	postID := id
+	var authorID string
+	// Deleted targets and those hidden pending review, or on a post that
+	// is, cannot be reacted to.
+	var gone bool
+	if targetType == "comment" {
+		err = database.DB.QueryRow(`
+			SELECT c.post_id, c.user_id, c.deleted_at IS NOT NULL OR c.hidden_at IS NOT NULL OR p.deleted_at IS NOT NULL OR p.hidden_at IS NOT NULL
+			FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.id = ?`, id).Scan(&postID, &authorID, &gone)
+	} else {
+		err = database.DB.QueryRow("SELECT user_id, deleted_at IS NOT NULL OR hidden_at IS NOT NULL FROM posts WHERE id = ?", id).Scan(&authorID, &gone)
+	}
+	if err == sql.ErrNoRows || gone {
+		http.Error(w, strings.ToUpper(targetType[:1])+targetType[1:]+" not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch "+targetType+": "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to save reaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		DELETE FROM reactions WHERE target_type = ? AND target_id = ? AND user_id = ? AND reaction = ?`,
+		targetType, id, currentUserID, input.Reaction)
+	if err != nil {
+		http.Error(w, "Failed to save reaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var notifications map[string]models.Notification
+	if n, _ := res.RowsAffected(); n == 0 {
+		if input.Reaction == ReactionLike || input.Reaction == ReactionDislike {
+			_, err = tx.Exec(`
+				DELETE FROM reactions WHERE target_type = ? AND target_id = ? AND user_id = ? AND reaction IN (?, ?)`,
+				targetType, id, currentUserID, ReactionLike, ReactionDislike)
+			if err != nil {
+				http.Error(w, "Failed to save reaction: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		_, err = tx.Exec(`
+			INSERT INTO reactions (target_type, target_id, user_id, reaction, created_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			targetType, id, currentUserID, input.Reaction, utils.Now())
+		if err != nil {
+			http.Error(w, "Failed to save reaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		commentID := ""
+		if targetType == "comment" {
+			commentID = id
+		}
+		notifications, err = notifyReaction(tx, authorID, postID, commentID, currentUserID, input.Reaction)
+		if err != nil {
+			http.Error(w, "Failed to notify author: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	// Likes and dislikes on a post feed into its hot score.
+	if targetType == "post" {
+		if err := database.RefreshPostActivity(tx, id); err != nil {
+			http.Error(w, "Failed to save reaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to save reaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pushNotifications(notifications)
+
+	counts, mine, err := loadReactions(targetType, []string{id}, currentUserID)
+	if err != nil {
+		http.Error(w, "Failed to fetch reactions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	broadcastEvent("reaction", map[string]interface{}{
+		"target_type": targetType,
+		"target_id":   id,
+		"post_id":     postID,
+		"reactions":   counts[id],
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reactions":    counts[id],
+		"my_reactions": mine[id],
+	})
+}
+
+// loadReactions returns reaction counts and the reactions userID gave for
+// each of ids. Every id has an entry, empty if nobody reacted.
+func loadReactions(targetType string, ids []string, userID string) (map[string]map[string]int, map[string][]string, error) {
+	counts := make(map[string]map[string]int, len(ids))
+	mine := make(map[string][]string, len(ids))
+	if len(ids) == 0 {
+		return counts, mine, nil
+	}
+	placeholders := make([]string, len(ids))
+	args := []interface{}{userID, targetType}
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args = append(args, id)
+		counts[id] = map[string]int{}
+		mine[id] = []string{}
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT target_id, reaction, COUNT(*), MAX(user_id = ?)
+		FROM reactions
+		WHERE target_type = ? AND target_id IN (`+strings.Join(placeholders, ", ")+`)
+		GROUP BY target_id, reaction
+		ORDER BY MIN(created_at) ASC`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, reaction string
+		var count int
+		var byUser bool
+		if err := rows.Scan(&id, &reaction, &count, &byUser); err != nil {
+			return nil, nil, err
+		}
+		counts[id][reaction] = count
+		if byUser {
+			mine[id] = append(mine[id], reaction)
+		}
+	}
+	return counts, mine, rows.Err()
+}
+
+// loadPostReactions fills in Reactions and MyReactions for every post.
+func loadPostReactions(posts []models.Post, userID string) error {
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	counts, mine, err := loadReactions("post", ids, userID)
+	if err != nil {
+		return err
+	}
+	for i, post := range posts {
+		posts[i].Reactions = counts[post.ID]
+		posts[i].MyReactions = mine[post.ID]
+	}
+	return nil
+}
@@ -0,0 +1,857 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"real-time-forum/backend/config"
+	"real-time-forum/backend/contentfilter"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/encryption"
+	"real-time-forum/backend/models"
+	"real-time-forum/backend/utils"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	maxReportNoteLength = 500
+	maxPreviewLength    = 200
+
+	reportOpen     = "open"
+	reportClaimed  = "claimed"
+	reportResolved = "resolved"
+
+	reportDismiss = "dismiss"
+	reportRemove  = "remove"
+	reportWarn    = "warn"
+
+	reportCursorSort = "reports"
+)
+
+// reportReasons are the reason codes a report may give, with the label
+// shown to users. Reports for "other" must explain themselves in a note.
+var reportReasons = []struct {
+	Code  string `json:"code"`
+	Label string `json:"label"`
+}{
+	{"spam", "Spam or advertising"},
+	{"harassment", "Harassment or bullying"},
+	{"hate", "Hate speech"},
+	{"sexual", "Sexual content"},
+	{"violence", "Violence or threats"},
+	{"self_harm", "Self-harm"},
+	{"misinformation", "Misinformation"},
+	{"other", "Something else"},
+}
+
+// reportTables maps the target types that can be hidden to their tables.
+// Users can be reported but not hidden.
+var reportTables = map[string]string{
+	"post":    "posts",
+	"comment": "comments",
+	"message": "messages",
+}
+
+func isReportReason(reason string) bool {
+	for _, r := range reportReasons {
+		if r.Code == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// ReportReasonsHandler lists the reason codes a report may give.
+func ReportReasonsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reportReasons)
+}
+
+// reportTarget finds who wrote the reported post, comment or message, or
+// the reported user, and the post it belongs to if any. Messages can only
+// be reported by the user who received them.
+func reportTarget(db queryRower, targetType, targetID, reporterID string) (authorID, postID string, err error) {
+	switch targetType {
+	case "post":
+		err = db.QueryRow("SELECT user_id, id FROM posts WHERE id = ? AND deleted_at IS NULL", targetID).Scan(&authorID, &postID)
+	case "comment":
+		err = db.QueryRow("SELECT user_id, post_id FROM comments WHERE id = ? AND deleted_at IS NULL", targetID).Scan(&authorID, &postID)
+	case "message":
+		err = db.QueryRow("SELECT sender_id FROM messages WHERE id = ? AND receiver_id = ?", targetID, reporterID).Scan(&authorID)
+	case "user":
+		err = db.QueryRow("SELECT id FROM users WHERE id = ?", targetID).Scan(&authorID)
+	default:
+		err = errors.New("unknown target type " + targetType)
+	}
+	return authorID, postID, err
+}
+
+// CreateReportHandler reports a post, comment, message or user (POST
+// {"target_type", "target_id", "reason", "note"}). Reports about the same
+// target are grouped into one case, and once enough different users report
+// a post or comment it is hidden until staff review it.
+func CreateReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		TargetType string `json:"target_type"`
+		TargetID   string `json:"target_id"`
+		Reason     string `json:"reason"`
+		Note       string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+	input.Note = strings.TrimSpace(input.Note)
+	if !isReportReason(input.Reason) {
+		http.Error(w, "Unknown report reason", http.StatusBadRequest)
+		return
+	}
+	if _, ok := reportTables[input.TargetType]; !ok && input.TargetType != "user" {
+		http.Error(w, "Target type must be post, comment, message or user", http.StatusBadRequest)
+		return
+	}
+	if input.Reason == "other" && input.Note == "" {
+		http.Error(w, "Please explain what is wrong", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(input.Note) > maxReportNoteLength {
+		http.Error(w, "Note must be at most 500 characters", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to create report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	authorID, postID, err := reportTarget(tx, input.TargetType, input.TargetID, currentUserID)
+	if err == sql.ErrNoRows {
+		http.Error(w, strings.ToUpper(input.TargetType[:1])+input.TargetType[1:]+" not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch "+input.TargetType+": "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if authorID == currentUserID {
+		http.Error(w, "You cannot report yourself", http.StatusBadRequest)
+		return
+	}
+
+	now := utils.Now()
+	var caseID string
+	err = tx.QueryRow(`
+		SELECT id FROM report_cases WHERE target_type = ? AND target_id = ? AND status != ?`,
+		input.TargetType, input.TargetID, reportResolved).Scan(&caseID)
+	if err == sql.ErrNoRows {
+		caseID = uuid.Must(uuid.NewV4()).String()
+		_, err = tx.Exec(`
+			INSERT INTO report_cases (id, target_type, target_id, author_id, post_id, created_at)
+			VALUES (?, ?, ?, ?, NULLIF(?, ''), ?)`,
+			caseID, input.TargetType, input.TargetID, authorID, postID, now)
+	}
+	if err != nil {
+		http.Error(w, "Failed to create report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var reported bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM reports WHERE case_id = ? AND reporter_id = ?)",
+		caseID, currentUserID).Scan(&reported)
+	if err != nil {
+		http.Error(w, "Failed to create report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if reported {
+		http.Error(w, "You already reported this", http.StatusConflict)
+		return
+	}
+	reportID := uuid.Must(uuid.NewV4()).String()
+	_, err = tx.Exec(`
+		INSERT INTO reports (id, case_id, reporter_id, reason, note, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		reportID, caseID, currentUserID, input.Reason, input.Note, now)
+	if err != nil {
+		http.Error(w, "Failed to create report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Only its recipient can report a message, so one report is enough to
+	// hide it.
+	hidden := false
+	if _, ok := reportTables[input.TargetType]; ok && config.ReportHideThreshold > 0 {
+		threshold := config.ReportHideThreshold
+		if input.TargetType == "message" {
+			threshold = 1
+		}
+		var reporters int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM reports WHERE case_id = ?", caseID).Scan(&reporters); err != nil {
+			http.Error(w, "Failed to count reports: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if reporters >= threshold {
+			hidden = true
+			if err := setHidden(tx, input.TargetType, input.TargetID, postID, true); err != nil {
+				http.Error(w, "Failed to hide "+input.TargetType+": "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to create report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      reportID,
+		"case_id": caseID,
+		"hidden":  hidden,
+	})
+}
+
+// reportCaseColumns are scanned by scanReportCase.
+const reportCaseColumns = `
+	report_cases.id, report_cases.target_type, report_cases.target_id, COALESCE(report_cases.post_id, ''),
+	report_cases.author_id, authors.nickname, report_cases.status,
+	COALESCE(report_cases.claimed_by, ''), COALESCE(claimers.nickname, ''), COALESCE(report_cases.resolved_by, ''),
+	report_cases.action, report_cases.resolution_note, report_cases.filter_reason,
+	CAST(report_cases.created_at AS TEXT), COALESCE(CAST(report_cases.resolved_at AS TEXT), '')`
+
+const reportCaseJoins = `
+	JOIN users authors ON authors.id = report_cases.author_id
+	LEFT JOIN users claimers ON claimers.id = report_cases.claimed_by`
+
+func scanReportCase(row interface{ Scan(...interface{}) error }) (models.ReportCase, error) {
+	var c models.ReportCase
+	err := row.Scan(&c.ID, &c.TargetType, &c.TargetID, &c.PostID, &c.AuthorID, &c.Author, &c.Status,
+		&c.ClaimedBy, &c.Claimer, &c.ResolvedBy, &c.Action, &c.ResolutionNote, &c.FilterReason,
+		&c.CreatedAt, &c.ResolvedAt)
+	return c, err
+}
+
+// loadReportPreview fills in what staff need to judge a case: the post
+// title, the start of the comment or message, or the reported user's
+// nickname, and whether it is hidden. Content deleted since shows as such.
+func loadReportPreview(c *models.ReportCase) error {
+	var preview string
+	var err error
+	switch c.TargetType {
+	case "post":
+		err = database.DB.QueryRow(`
+			SELECT CASE WHEN deleted_at IS NULL THEN title ELSE '[deleted]' END, hidden_at IS NOT NULL
+			FROM posts WHERE id = ?`, c.TargetID).Scan(&preview, &c.Hidden)
+	case "comment":
+		err = database.DB.QueryRow(`
+			SELECT CASE WHEN deleted_at IS NULL THEN content ELSE '[deleted]' END, hidden_at IS NOT NULL
+			FROM comments WHERE id = ?`, c.TargetID).Scan(&preview, &c.Hidden)
+	case "message":
+		err = database.DB.QueryRow("SELECT content, hidden_at IS NOT NULL FROM messages WHERE id = ?",
+			c.TargetID).Scan(&preview, &c.Hidden)
+		if err == nil {
+			preview, err = encryption.Decrypt(preview, c.TargetID)
+		}
+	case "user":
+		preview = c.Author
+	}
+	if err == sql.ErrNoRows {
+		preview, err = "[deleted]", nil
+	}
+	if utf8.RuneCountInString(preview) > maxPreviewLength {
+		preview = string([]rune(preview)[:maxPreviewLength]) + "…"
+	}
+	c.Preview = preview
+	return err
+}
+
+// loadReports attaches the individual reports to each case, oldest first.
+func loadReports(cases []models.ReportCase) error {
+	if len(cases) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(cases))
+	args := make([]interface{}, len(cases))
+	index := make(map[string]int, len(cases))
+	for i := range cases {
+		placeholders[i] = "?"
+		args[i] = cases[i].ID
+		index[cases[i].ID] = i
+		cases[i].Reports = []models.Report{}
+	}
+	rows, err := database.DB.Query(`
+		SELECT reports.case_id, reports.id, reports.reporter_id, users.nickname, reports.reason, reports.note,
+			CAST(reports.created_at AS TEXT)
+		FROM reports JOIN users ON users.id = reports.reporter_id
+		WHERE reports.case_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY reports.created_at, reports.id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var caseID string
+		var rep models.Report
+		if err := rows.Scan(&caseID, &rep.ID, &rep.ReporterID, &rep.Reporter, &rep.Reason, &rep.Note, &rep.CreatedAt); err != nil {
+			return err
+		}
+		i := index[caseID]
+		cases[i].Reports = append(cases[i].Reports, rep)
+	}
+	return rows.Err()
+}
+
+func fetchReportCase(id string) (models.ReportCase, error) {
+	c, err := scanReportCase(database.DB.QueryRow(`
+		SELECT `+reportCaseColumns+` FROM report_cases `+reportCaseJoins+`
+		WHERE report_cases.id = ?`, id))
+	if err != nil {
+		return c, err
+	}
+	if err := loadReportPreview(&c); err != nil {
+		return c, err
+	}
+	cases := []models.ReportCase{c}
+	err = loadReports(cases)
+	return cases[0], err
+}
+
+// ReportQueueHandler lists report cases for staff, oldest first so the
+// queue is worked through in order, paged with limit and cursor like the
+// feed. status picks open, claimed or resolved cases; by default it lists
+// every case still waiting for a decision.
+func ReportQueueHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	limit := defaultFeedLimit
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "Limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxFeedLimit)
+	}
+
+	var conditions []string
+	var args []interface{}
+	switch status := q.Get("status"); status {
+	case "":
+		conditions = append(conditions, "report_cases.status != ?")
+		args = append(args, reportResolved)
+	case reportOpen, reportClaimed, reportResolved:
+		conditions = append(conditions, "report_cases.status = ?")
+		args = append(args, status)
+	default:
+		http.Error(w, "Status must be open, claimed or resolved", http.StatusBadRequest)
+		return
+	}
+	if c := q.Get("cursor"); c != "" {
+		cursor, err := decodeFeedCursor(c)
+		if err == nil && cursor.Sort != reportCursorSort {
+			err = errors.New("Cursor belongs to a different list")
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "(report_cases.created_at > ? OR (report_cases.created_at = ? AND report_cases.id > ?))")
+		args = append(args, cursor.Key, cursor.Key, cursor.ID)
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT `+reportCaseColumns+` FROM report_cases `+reportCaseJoins+`
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY report_cases.created_at, report_cases.id LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		http.Error(w, "Failed to fetch reports: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	cases := []models.ReportCase{}
+	for rows.Next() {
+		c, err := scanReportCase(rows)
+		if err != nil {
+			http.Error(w, "Failed to scan report: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		cases = append(cases, c)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to fetch reports: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rows.Close()
+
+	nextCursor := ""
+	if len(cases) > limit {
+		cases = cases[:limit]
+		last := cases[limit-1]
+		nextCursor = feedCursor{Sort: reportCursorSort, Key: last.CreatedAt, ID: last.ID}.encode()
+	}
+	for i := range cases {
+		if err := loadReportPreview(&cases[i]); err != nil {
+			http.Error(w, "Failed to fetch reported content: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := loadReports(cases); err != nil {
+		http.Error(w, "Failed to fetch reports: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"cases":       cases,
+		"next_cursor": nextCursor,
+	})
+}
+
+// caseConflict explains why the current user cannot act on a case, or
+// returns "" when they can: it must still be open, or claimed by them.
+func caseConflict(c models.ReportCase, userID string) string {
+	switch {
+	case c.Status == reportResolved:
+		return "Report is already resolved"
+	case c.Status == reportClaimed && c.ClaimedBy != userID:
+		return "Report is claimed by " + c.Claimer
+	}
+	return ""
+}
+
+// ClaimReportHandler claims a case for the current moderator so others
+// leave it alone (POST), or hands it back to the queue (DELETE).
+func ClaimReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	c, err := fetchReportCase(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if conflict := caseConflict(c, currentUserID); conflict != "" {
+		http.Error(w, conflict, http.StatusConflict)
+		return
+	}
+	if r.Method == http.MethodDelete && c.Status != reportClaimed {
+		http.Error(w, "Report is not claimed", http.StatusConflict)
+		return
+	}
+
+	// The status is checked again by the update, as another moderator may
+	// have claimed or resolved the case since it was fetched.
+	query := `
+		UPDATE report_cases SET status = ?, claimed_by = ?, claimed_at = ?
+		WHERE id = ? AND (status = ? OR (status = ? AND claimed_by = ?))`
+	args := []interface{}{reportClaimed, currentUserID, utils.Now(), id, reportOpen, reportClaimed, currentUserID}
+	if r.Method == http.MethodDelete {
+		query = "UPDATE report_cases SET status = ?, claimed_by = NULL, claimed_at = NULL WHERE id = ? AND status = ? AND claimed_by = ?"
+		args = []interface{}{reportOpen, id, reportClaimed, currentUserID}
+	}
+	res, err := database.DB.Exec(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to claim report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Report was claimed or resolved by someone else", http.StatusConflict)
+		return
+	}
+
+	respondReportCase(w, id)
+}
+
+// ResolveReportHandler closes a case (POST {"action", "note"}). dismiss
+// finds nothing wrong, warn tells the author to behave, and remove deletes
+// the post or comment or keeps the message hidden. Dismissing or warning
+// shows hidden content again. Every reporter is told the outcome.
+func ResolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Action string `json:"action"`
+		Note   string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+	input.Note = strings.TrimSpace(input.Note)
+	if input.Action != reportDismiss && input.Action != reportRemove && input.Action != reportWarn {
+		http.Error(w, "Action must be dismiss, remove or warn", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(input.Note) > maxReportNoteLength {
+		http.Error(w, "Note must be at most 500 characters", http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("id")
+	c, err := fetchReportCase(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if conflict := caseConflict(c, currentUserID); conflict != "" {
+		http.Error(w, conflict, http.StatusConflict)
+		return
+	}
+	table, hideable := reportTables[c.TargetType]
+	if input.Action == reportRemove && !hideable {
+		http.Error(w, "Users cannot be removed, only warned", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to resolve report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Resolve the case first, only if it is still open or claimed by the
+	// current moderator, so that two moderators cannot both act on it.
+	res, err := tx.Exec(`
+		UPDATE report_cases SET status = ?, resolved_by = ?, resolved_at = ?, action = ?, resolution_note = ?
+		WHERE id = ? AND (status = ? OR (status = ? AND claimed_by = ?))`,
+		reportResolved, currentUserID, utils.Now(), input.Action, input.Note,
+		id, reportOpen, reportClaimed, currentUserID)
+	if err != nil {
+		http.Error(w, "Failed to resolve report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Report was claimed or resolved by someone else", http.StatusConflict)
+		return
+	}
+
+	if err := trainFromDecision(tx, c, input.Action); err != nil {
+		http.Error(w, "Failed to train spam filter: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Content hidden pending review that is let through now is announced
+	// as if it had just been published.
+	released := false
+	if input.Action != reportRemove && hideable {
+		query := "SELECT hidden_at IS NOT NULL FROM " + table + " WHERE id = ?"
+		if c.TargetType != "message" {
+			query += " AND deleted_at IS NULL"
+		}
+		err := tx.QueryRow(query, c.TargetID).Scan(&released)
+		if err != nil && err != sql.ErrNoRows {
+			http.Error(w, "Failed to fetch "+c.TargetType+": "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	notifications, err := applyReportAction(tx, c, table, input.Action, currentUserID)
+	if err != nil {
+		http.Error(w, "Failed to "+input.Action+" "+c.TargetType+": "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var releaseNotifications map[string]models.Notification
+	if released {
+		if releaseNotifications, err = releaseHeld(tx, c); err != nil {
+			http.Error(w, "Failed to notify users: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	reporters := make([]string, len(c.Reports))
+	for i, rep := range c.Reports {
+		reporters[i] = rep.ReporterID
+	}
+	outcome, err := notify(tx, reporters, models.Notification{
+		Type:     notificationReport,
+		PostID:   c.PostID,
+		ReportID: id,
+		Target:   c.TargetType,
+		Detail:   input.Action,
+	})
+	if err != nil {
+		http.Error(w, "Failed to notify reporters: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to resolve report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pushNotifications(notifications)
+	pushNotifications(outcome)
+	pushNotifications(releaseNotifications)
+	if released {
+		announceRelease(c)
+	}
+
+	respondReportCase(w, id)
+}
+
+// releaseHeld sends the notifications held back while a post, comment or
+// message was hidden pending review: mentions and, for a comment, the reply
+// and the one for following the post. Users told about it before it was
+// hidden are not told again.
+func releaseHeld(tx *sql.Tx, c models.ReportCase) (map[string]models.Notification, error) {
+	mentioned, err := pendingMentions(tx, c.TargetType, c.TargetID, c.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	switch c.TargetType {
+	case "post":
+		return notifyMentions(tx, mentioned, c.TargetID, "", c.AuthorID)
+	case "message":
+		return notify(tx, mentioned, models.Notification{
+			Type:      notificationMention,
+			ActorID:   c.AuthorID,
+			MessageID: c.TargetID,
+		})
+	case "comment":
+	default:
+		return nil, nil
+	}
+
+	var parentCommentID string
+	err = tx.QueryRow("SELECT COALESCE(parent_comment_id, '') FROM comments WHERE id = ?", c.TargetID).Scan(&parentCommentID)
+	if err != nil {
+		return nil, err
+	}
+	// skip starts with everyone already notified about the comment.
+	skip := make(map[string]models.Notification)
+	rows, err := tx.Query("SELECT user_id FROM notifications WHERE comment_id = ? AND type IN (?, ?, ?)",
+		c.TargetID, notificationMention, notificationReply, notificationComment)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		skip[userID] = models.Notification{}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sent := make(map[string]models.Notification)
+	mentionNotifications, err := notifyMentions(tx, mentioned, c.PostID, c.TargetID, c.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	for userID, n := range mentionNotifications {
+		skip[userID], sent[userID] = n, n
+	}
+	replyNotifications, err := notifyReply(tx, c.PostID, parentCommentID, c.TargetID, c.AuthorID, skip)
+	if err != nil {
+		return nil, err
+	}
+	for userID, n := range replyNotifications {
+		skip[userID], sent[userID] = n, n
+	}
+	subscriberNotifications, err := notifySubscribers(tx, c.PostID, c.TargetID, c.AuthorID, skip)
+	if err != nil {
+		return nil, err
+	}
+	for userID, n := range subscriberNotifications {
+		sent[userID] = n
+	}
+	return sent, nil
+}
+
+// announceRelease broadcasts a post or comment a moderator let through, as
+// creating it would have. Errors are only logged; the case is resolved.
+func announceRelease(c models.ReportCase) {
+	switch c.TargetType {
+	case "post":
+		post, err := fetchPost(c.TargetID, "")
+		if err != nil {
+			fmt.Println("Error fetching released post:", err)
+			return
+		}
+		broadcastNewPost(post)
+	case "comment":
+		var parentCommentID string
+		err := database.DB.QueryRow("SELECT COALESCE(parent_comment_id, '') FROM comments WHERE id = ?", c.TargetID).Scan(&parentCommentID)
+		if err != nil {
+			fmt.Println("Error fetching released comment:", err)
+			return
+		}
+		broadcastNewComment(c.PostID, c.TargetID, parentCommentID, c.AuthorID)
+	}
+}
+
+// applyReportAction carries out a moderator's decision on the reported
+// content and returns the notifications for its author.
+func applyReportAction(tx *sql.Tx, c models.ReportCase, table, action, moderatorID string) (map[string]models.Notification, error) {
+	if action == reportRemove {
+		if c.TargetType == "message" {
+			_, err := tx.Exec("UPDATE messages SET hidden_at = ? WHERE id = ? AND hidden_at IS NULL", utils.Now(), c.TargetID)
+			if err != nil {
+				return nil, err
+			}
+			return nil, logModeration(tx, moderatorID, action, c.TargetType, c.TargetID, "", "")
+		}
+		old, err := loadEditTarget(tx, c.TargetType, c.TargetID)
+		if err != nil || old.deleted {
+			return nil, err
+		}
+		return softDelete(tx, c.TargetType, table, c.TargetID, old, moderatorID)
+	}
+
+	if table != "" {
+		if err := setHidden(tx, c.TargetType, c.TargetID, c.PostID, false); err != nil {
+			return nil, err
+		}
+	}
+	if err := logModeration(tx, moderatorID, action, c.TargetType, c.TargetID, c.PostID, ""); err != nil {
+		return nil, err
+	}
+	if action != reportWarn {
+		return nil, nil
+	}
+	commentID := ""
+	if c.TargetType == "comment" {
+		commentID = c.TargetID
+	}
+	return notify(tx, []string{c.AuthorID}, models.Notification{
+		Type:      notificationModeration,
+		PostID:    c.PostID,
+		CommentID: commentID,
+		ReportID:  c.ID,
+		Target:    c.TargetType,
+		Detail:    reportWarn,
+	})
+}
+
+// holdForReview hides content the filters held and puts it in the report
+// queue with their reason, joining the open case about it if there is one.
+func holdForReview(tx *sql.Tx, targetType, targetID, authorID, postID, reason string) error {
+	if err := setHidden(tx, targetType, targetID, postID, true); err != nil {
+		return err
+	}
+	now := utils.Now()
+	_, err := tx.Exec(`
+		INSERT INTO report_cases (id, target_type, target_id, author_id, post_id, filter_reason, created_at)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), ?, ?)
+		ON CONFLICT(target_type, target_id) WHERE status != 'resolved'
+		DO UPDATE SET filter_reason = excluded.filter_reason`,
+		uuid.Must(uuid.NewV4()).String(), targetType, targetID, authorID, postID, reason, now)
+	return err
+}
+
+// trainFromDecision teaches the spam classifier from a moderator's
+// decision: removing content the filters held or users reported as spam
+// marks it spam, and dismissing a case marks it as not spam.
+func trainFromDecision(tx *sql.Tx, c models.ReportCase, action string) error {
+	spam := false
+	if action == reportRemove {
+		spam = c.FilterReason != ""
+		for _, rep := range c.Reports {
+			spam = spam || rep.Reason == "spam"
+		}
+	}
+	if !spam && action != reportDismiss {
+		return nil
+	}
+
+	var text string
+	var err error
+	switch c.TargetType {
+	case "post":
+		err = tx.QueryRow("SELECT title || char(10) || content FROM posts WHERE id = ?", c.TargetID).Scan(&text)
+	case "comment":
+		err = tx.QueryRow("SELECT content FROM comments WHERE id = ?", c.TargetID).Scan(&text)
+	case "message":
+		err = tx.QueryRow("SELECT content FROM messages WHERE id = ?", c.TargetID).Scan(&text)
+		if err == nil {
+			text, err = encryption.Decrypt(text, c.TargetID)
+		}
+	default:
+		return nil
+	}
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return contentfilter.Train(tx, text, spam)
+}
+
+func respondReportCase(w http.ResponseWriter, id string) {
+	c, err := fetchReportCase(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// setHidden hides or unhides a post, comment or message. Hidden comments
+// do not count towards their post's activity, so the post's counters are
+// recomputed.
+func setHidden(tx *sql.Tx, targetType, targetID, postID string, hidden bool) error {
+	var err error
+	if hidden {
+		_, err = tx.Exec("UPDATE "+reportTables[targetType]+" SET hidden_at = ? WHERE id = ? AND hidden_at IS NULL", utils.Now(), targetID)
+	} else {
+		_, err = tx.Exec("UPDATE "+reportTables[targetType]+" SET hidden_at = NULL WHERE id = ?", targetID)
+	}
+	if err != nil || targetType != "comment" {
+		return err
+	}
+	return database.RefreshPostActivity(tx, postID)
+}
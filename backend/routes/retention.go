@@ -0,0 +1,121 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"real-time-forum/backend/config"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/retention"
+	"real-time-forum/backend/utils"
+)
+
+const maxConversationRetentionDays = 3650
+
+// conversationKey orders two user IDs the way conversation_retention stores them.
+func conversationKey(a, b string) (string, string) {
+	if a < b {
+		return a, b
+	}
+	return b, a
+}
+
+// ConversationRetentionHandler reads (GET), sets (PUT) or clears (DELETE)
+// the auto-delete window for the conversation with the "with" user.
+func ConversationRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	otherUserID := r.URL.Query().Get("with")
+	if otherUserID == "" || otherUserID == currentUserID {
+		http.Error(w, "Missing 'with' parameter", http.StatusBadRequest)
+		return
+	}
+	userA, userB := conversationKey(currentUserID, otherUserID)
+
+	switch r.Method {
+	case http.MethodGet:
+		var days int
+		err := database.DB.QueryRow("SELECT days FROM conversation_retention WHERE user_a = ? AND user_b = ?", userA, userB).Scan(&days)
+		if err != nil && err != sql.ErrNoRows {
+			http.Error(w, "Failed to fetch retention setting: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"days": days})
+
+	case http.MethodPut:
+		var req struct {
+			Days int `json:"days"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid input data", http.StatusBadRequest)
+			return
+		}
+		if req.Days < 1 || req.Days > maxConversationRetentionDays {
+			http.Error(w, "Days must be between 1 and 3650", http.StatusBadRequest)
+			return
+		}
+		var exists int
+		if err := database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", otherUserID).Scan(&exists); err != nil || exists == 0 {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		_, err := database.DB.Exec(`
+			INSERT INTO conversation_retention (user_a, user_b, days, updated_by, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(user_a, user_b) DO UPDATE SET days = excluded.days, updated_by = excluded.updated_by, updated_at = excluded.updated_at`,
+			userA, userB, req.Days, currentUserID, utils.Now())
+		if err != nil {
+			http.Error(w, "Failed to save retention setting: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"days": req.Days})
+
+	case http.MethodDelete:
+		_, err := database.DB.Exec("DELETE FROM conversation_retention WHERE user_a = ? AND user_b = ?", userA, userB)
+		if err != nil {
+			http.Error(w, "Failed to clear retention setting: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// RetentionPreviewHandler shows admins the active policies and what the
+// next retention run will remove.
+func RetentionPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	preview, err := retention.Preview()
+	if err != nil {
+		http.Error(w, "Failed to preview retention run: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nextRun, lastRun := retention.NextRun()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"policies": map[string]interface{}{
+			"dry_run":                 config.RetentionDryRun,
+			"message_days":            config.MessageRetentionDays,
+			"messages_opt_in":         config.MessageRetentionOptIn,
+			"unverified_account_days": config.UnverifiedAccountDays,
+			"inactive_account_days":   config.InactiveAccountDays,
+			"unattached_upload_hours": config.UnattachedUploadHours,
+		},
+		"next_run_at": utils.FormatTime(nextRun),
+		"next_run":    preview,
+		"last_run":    lastRun,
+	})
+}
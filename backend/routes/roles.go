@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"net/http"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/utils"
+)
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+func userRole(userID string) (string, error) {
+	var role string
+	err := database.DB.QueryRow("SELECT role FROM users WHERE id = ?", userID).Scan(&role)
+	return role, err
+}
+
+// isStaff reports whether userID is a moderator or an admin.
+func isStaff(userID string) (bool, error) {
+	role, err := userRole(userID)
+	if err != nil {
+		return false, err
+	}
+	return role == RoleModerator || role == RoleAdmin, nil
+}
+
+// RequireRole only lets users holding one of roles through to next. It is
+// meant to be wrapped in utils.AuthMiddleware.
+func RequireRole(next http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUserID, err := utils.GetSession(r)
+		if err != nil || currentUserID == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		role, err := userRole(currentUserID)
+		if err != nil {
+			http.Error(w, "Failed to fetch user role: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, allowed := range roles {
+			if role == allowed {
+				next(w, r)
+				return
+			}
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	}
+}
@@ -0,0 +1,260 @@
+package routes
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/utils"
+	"strconv"
+	"strings"
+)
+
+// Markers wrapped around matched terms by snippet(); they are swapped for
+// <mark> tags after the rest of the snippet has been HTML-escaped.
+const (
+	highlightStart = "\x02"
+	highlightEnd   = "\x03"
+)
+
+type searchQuery struct {
+	terms    []string
+	category string
+	author   string
+}
+
+type SearchResult struct {
+	Type      string  `json:"type"`
+	ID        string  `json:"id"`
+	PostID    string  `json:"post_id,omitempty"`
+	UserID    string  `json:"user_id"`
+	Nickname  string  `json:"nickname"`
+	Title     string  `json:"title,omitempty"`
+	Category  string  `json:"category,omitempty"`
+	Snippet   string  `json:"snippet"`
+	CreatedAt string  `json:"created_at"`
+	Rank      float64 `json:"rank"`
+}
+
+// parseSearchQuery splits q into free-text terms, quoted phrases and the
+// category: and author: filters. Filters accept quoted values too.
+func parseSearchQuery(q string) searchQuery {
+	var sq searchQuery
+	for _, token := range tokenizeSearch(q) {
+		lower := strings.ToLower(token)
+		switch {
+		case strings.HasPrefix(lower, "category:") && len(token) > len("category:"):
+			sq.category = strings.Trim(token[len("category:"):], `"`)
+		case strings.HasPrefix(lower, "author:") && len(token) > len("author:"):
+			sq.author = strings.Trim(token[len("author:"):], `"`)
+		default:
+			if term := strings.TrimSpace(strings.Trim(token, `"`)); term != "" {
+				sq.terms = append(sq.terms, term)
+			}
+		}
+	}
+	return sq
+}
+
+// tokenizeSearch splits on whitespace while keeping quoted sections together.
+func tokenizeSearch(q string) []string {
+	var tokens []string
+	var current strings.Builder
+	inQuotes := false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			current.WriteRune(r)
+		case (r == ' ' || r == '\t' || r == '\n') && !inQuotes:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// matchExpression turns the parsed terms into an FTS5 MATCH expression. Every
+// term is quoted so user input can never be interpreted as FTS5 syntax.
+func (sq searchQuery) matchExpression() string {
+	quoted := make([]string, len(sq.terms))
+	for i, term := range sq.terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+func formatSnippet(raw string) string {
+	escaped := html.EscapeString(raw)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightEnd, "</mark>")
+}
+
+func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !database.SearchEnabled {
+		http.Error(w, "Search is not available on this server", http.StatusServiceUnavailable)
+		return
+	}
+
+	currentUserID, err := utils.GetSession(r)
+	if err != nil || currentUserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sq := parseSearchQuery(r.URL.Query().Get("q"))
+	if len(sq.terms) == 0 {
+		http.Error(w, "Search query must contain at least one term", http.StatusBadRequest)
+		return
+	}
+
+	searchType := r.URL.Query().Get("type")
+	if searchType == "" {
+		searchType = "all"
+	}
+	if searchType != "all" && searchType != "posts" && searchType != "comments" && searchType != "messages" {
+		http.Error(w, "Type must be one of all, posts, comments or messages", http.StatusBadRequest)
+		return
+	}
+	// Encrypted messages are kept out of the index, which would otherwise
+	// hold their plaintext.
+	if searchType == "messages" && !database.MessageSearchEnabled {
+		http.Error(w, "Message search is not available while messages are encrypted", http.StatusServiceUnavailable)
+		return
+	}
+
+	limit := 20
+	offset := 0
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, 50)
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o > 0 {
+		offset = o
+	}
+
+	match := sq.matchExpression()
+	snippetArgs := `'` + highlightStart + `', '` + highlightEnd + `', '…', 16`
+
+	var parts []string
+	var args []interface{}
+
+	if searchType == "all" || searchType == "posts" {
+		part := `
+			SELECT 'post' AS type, p.id, p.id AS post_id, p.user_id, u.nickname, p.title, p.category,
+				snippet(posts_fts, 2, ` + snippetArgs + `) AS snippet, p.created_at, bm25(posts_fts) AS rank
+			FROM posts_fts
+			JOIN posts p ON p.rowid = posts_fts.rowid
+			JOIN users u ON u.id = p.user_id
+			WHERE posts_fts MATCH ? AND p.deleted_at IS NULL AND p.hidden_at IS NULL`
+		args = append(args, match)
+		if sq.category != "" {
+			part += ` AND EXISTS (
+				SELECT 1 FROM post_categories pc JOIN categories cat ON cat.id = pc.category_id
+				WHERE pc.post_id = p.id AND cat.name = ?)`
+			args = append(args, sq.category)
+		}
+		if sq.author != "" {
+			part += ` AND LOWER(u.nickname) = LOWER(?)`
+			args = append(args, sq.author)
+		}
+		parts = append(parts, part)
+	}
+
+	if searchType == "all" || searchType == "comments" {
+		part := `
+			SELECT 'comment' AS type, c.id, c.post_id, c.user_id, u.nickname, p.title, p.category,
+				snippet(comments_fts, 0, ` + snippetArgs + `) AS snippet, c.created_at, bm25(comments_fts) AS rank
+			FROM comments_fts
+			JOIN comments c ON c.rowid = comments_fts.rowid
+			JOIN posts p ON p.id = c.post_id
+			JOIN users u ON u.id = c.user_id
+			WHERE comments_fts MATCH ? AND c.deleted_at IS NULL AND c.hidden_at IS NULL AND p.deleted_at IS NULL AND p.hidden_at IS NULL`
+		args = append(args, match)
+		if sq.category != "" {
+			part += ` AND EXISTS (
+				SELECT 1 FROM post_categories pc JOIN categories cat ON cat.id = pc.category_id
+				WHERE pc.post_id = p.id AND cat.name = ?)`
+			args = append(args, sq.category)
+		}
+		if sq.author != "" {
+			part += ` AND LOWER(u.nickname) = LOWER(?)`
+			args = append(args, sq.author)
+		}
+		parts = append(parts, part)
+	}
+
+	// Messages have no category, so a category filter excludes them. Only
+	// conversations the caller took part in are searched.
+	messagesSearched := (searchType == "all" || searchType == "messages") && sq.category == "" && database.MessageSearchEnabled
+	if messagesSearched {
+		part := `
+			SELECT 'message' AS type, m.id, '' AS post_id, m.sender_id, u.nickname, '' AS title, '' AS category,
+				snippet(messages_fts, 0, ` + snippetArgs + `) AS snippet, m.created_at, bm25(messages_fts) AS rank
+			FROM messages_fts
+			JOIN messages m ON m.rowid = messages_fts.rowid
+			JOIN users u ON u.id = m.sender_id
+			WHERE messages_fts MATCH ? AND m.hidden_at IS NULL AND (m.sender_id = ? OR m.receiver_id = ?)`
+		args = append(args, match, currentUserID, currentUserID)
+		if sq.author != "" {
+			part += ` AND LOWER(u.nickname) = LOWER(?)`
+			args = append(args, sq.author)
+		}
+		parts = append(parts, part)
+	}
+
+	results := []SearchResult{}
+	if len(parts) > 0 {
+		// Fetch one extra row to know whether another page exists.
+		query := strings.Join(parts, " UNION ALL ") + ` ORDER BY rank ASC LIMIT ? OFFSET ?`
+		args = append(args, limit+1, offset)
+
+		rows, err := database.DB.Query(query, args...)
+		if err != nil {
+			http.Error(w, "Failed to search: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var res SearchResult
+			if err := rows.Scan(&res.Type, &res.ID, &res.PostID, &res.UserID, &res.Nickname, &res.Title, &res.Category, &res.Snippet, &res.CreatedAt, &res.Rank); err != nil {
+				http.Error(w, "Failed to scan search result: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			res.Snippet = formatSnippet(res.Snippet)
+			results = append(results, res)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, "Failed to search: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	hasMore := len(results) > limit
+	if hasMore {
+		results = results[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results":  results,
+		"limit":    limit,
+		"offset":   offset,
+		"has_more": hasMore,
+		// False when messages were left out, by the type or category
+		// filter or because they are encrypted.
+		"messages_searched": messagesSearched,
+	})
+}
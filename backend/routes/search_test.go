@@ -0,0 +1,199 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/utils"
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want searchQuery
+	}{
+		{"go  sqlite", searchQuery{terms: []string{"go", "sqlite"}}},
+		{`"write ahead" log`, searchQuery{terms: []string{"write ahead", "log"}}},
+		{`Category:"Web Dev" author:alice tips`, searchQuery{terms: []string{"tips"}, category: "Web Dev", author: "alice"}},
+		{"category: author:", searchQuery{terms: []string{"category:", "author:"}}},
+		{`"" "  "`, searchQuery{}},
+	}
+	for _, tt := range tests {
+		if got := parseSearchQuery(tt.q); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSearchQuery(%q) = %+v, want %+v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestMatchExpressionQuotesTerms(t *testing.T) {
+	sq := searchQuery{terms: []string{"NOT", "a*", `say "hi"`}}
+	if got, want := sq.matchExpression(), `"NOT" "a*" "say ""hi"""`; got != want {
+		t.Errorf("matchExpression = %s, want %s", got, want)
+	}
+}
+
+func TestFormatSnippet(t *testing.T) {
+	raw := "<b>" + highlightStart + "sqlite" + highlightEnd + "</b> & more"
+	if got, want := formatSnippet(raw), "&lt;b&gt;<mark>sqlite</mark>&lt;/b&gt; &amp; more"; got != want {
+		t.Errorf("formatSnippet = %q, want %q", got, want)
+	}
+}
+
+// openSearchDB creates a database in a temporary directory and skips the
+// test when this build has no FTS5.
+func openSearchDB(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	database.InitDatabase()
+	os.Chdir(wd)
+	t.Cleanup(func() {
+		database.DB.Close()
+		database.SearchEnabled, database.MessageSearchEnabled = false, false
+	})
+	if !database.SearchEnabled {
+		t.Skip("built without sqlite_fts5")
+	}
+}
+
+func mustExec(t *testing.T, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := database.DB.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+type searchResponse struct {
+	Results          []SearchResult
+	MessagesSearched bool `json:"messages_searched"`
+}
+
+func searchRequest(t *testing.T, userID, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	login := httptest.NewRecorder()
+	utils.CreateSession(login, userID)
+	r := httptest.NewRequest(http.MethodGet, "/api/search?"+query, nil)
+	for _, c := range login.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	SearchHandler(w, r)
+	return w
+}
+
+func searchBody(t *testing.T, userID, query string) searchResponse {
+	t.Helper()
+	w := searchRequest(t, userID, query)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search %s: %d %s", query, w.Code, w.Body.String())
+	}
+	var body searchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func search(t *testing.T, userID, query string) []SearchResult {
+	t.Helper()
+	return searchBody(t, userID, query).Results
+}
+
+func resultIDs(results []SearchResult) []string {
+	ids := []string{}
+	for _, res := range results {
+		ids = append(ids, res.ID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	openSearchDB(t)
+	mustExec(t, `INSERT INTO users (id, nickname, email, password) VALUES
+		('u1', 'alice', 'a@example.com', 'x'), ('u2', 'bob', 'b@example.com', 'x'), ('u3', 'carol', 'c@example.com', 'x')`)
+	mustExec(t, `INSERT INTO categories (id, name, created_at) VALUES ('c1', 'General', ''), ('c2', 'Databases', '')`)
+	mustExec(t, `INSERT INTO posts (id, user_id, title, slug, category, content) VALUES
+		('once', 'u1', 'Notes', 'notes', 'General', 'A long post about many things that mentions sqlite only once among other words'),
+		('often', 'u2', 'SQLite', 'sqlite', 'General', 'sqlite <b>sqlite</b>'),
+		('held', 'u2', 'Held', 'held', 'General', 'sqlite')`)
+	mustExec(t, `UPDATE posts SET hidden_at = '2026-01-01T00:00:00.000Z' WHERE id = 'held'`)
+	mustExec(t, `INSERT INTO post_categories (post_id, category_id) VALUES ('once', 'c1'), ('once', 'c2'), ('often', 'c1')`)
+	mustExec(t, `INSERT INTO comments (id, post_id, user_id, content) VALUES ('comment', 'once', 'u2', 'I use sqlite too')`)
+	mustExec(t, `INSERT INTO messages (id, sender_id, receiver_id, content) VALUES
+		('mine', 'u2', 'u1', 'sqlite question'), ('theirs', 'u2', 'u3', 'sqlite secret')`)
+
+	t.Run("ranks posts by relevance", func(t *testing.T) {
+		got := resultIDs(search(t, "u1", "q=sqlite&type=posts"))
+		if want := []string{"often", "once"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("posts = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("highlights and escapes snippets", func(t *testing.T) {
+		results := search(t, "u1", "q=sqlite&type=posts")
+		if len(results) == 0 {
+			t.Fatal("no results")
+		}
+		if want := "<mark>sqlite</mark> &lt;b&gt;<mark>sqlite</mark>&lt;/b&gt;"; results[0].Snippet != want {
+			t.Errorf("snippet = %q, want %q", results[0].Snippet, want)
+		}
+	})
+
+	t.Run("matches every category of a post", func(t *testing.T) {
+		if got := resultIDs(search(t, "u1", "q=databases")); !reflect.DeepEqual(got, []string{"once"}) {
+			t.Errorf("databases = %v, want [once]", got)
+		}
+		mustExec(t, `UPDATE categories SET name = 'Storage' WHERE id = 'c2'`)
+		if got := resultIDs(search(t, "u1", "q=storage")); !reflect.DeepEqual(got, []string{"once"}) {
+			t.Errorf("storage after rename = %v, want [once]", got)
+		}
+		mustExec(t, `DELETE FROM post_categories WHERE post_id = 'once' AND category_id = 'c2'`)
+		if got := resultIDs(search(t, "u1", "q=storage")); len(got) != 0 {
+			t.Errorf("storage after removal = %v, want none", got)
+		}
+	})
+
+	t.Run("filters and visibility", func(t *testing.T) {
+		got := resultIDs(search(t, "u1", "q=sqlite&type=all"))
+		want := map[string]bool{"often": true, "once": true, "comment": true, "mine": true}
+		if len(got) != len(want) {
+			t.Errorf("all = %v, want the keys of %v", got, want)
+		}
+		for _, id := range got {
+			if !want[id] {
+				t.Errorf("all includes %q", id)
+			}
+		}
+		if got := resultIDs(search(t, "u1", "q=sqlite+author:BOB&type=comments")); !reflect.DeepEqual(got, []string{"comment"}) {
+			t.Errorf("author:BOB comments = %v, want [comment]", got)
+		}
+		if got := resultIDs(search(t, "u1", "q=sqlite+category:General&type=all")); len(got) != 3 {
+			t.Errorf("category:General = %v, want both posts and the comment and no messages", got)
+		}
+	})
+
+	t.Run("leaves out encrypted messages", func(t *testing.T) {
+		if !searchBody(t, "u1", "q=sqlite").MessagesSearched {
+			t.Error("messages_searched = false with message search enabled")
+		}
+		// Enabling encryption drops the message index.
+		database.MessageSearchEnabled = false
+		defer func() { database.MessageSearchEnabled = true }()
+		if w := searchRequest(t, "u1", "q=sqlite&type=messages"); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("type=messages = %d, want 503", w.Code)
+		}
+		body := searchBody(t, "u1", "q=sqlite")
+		if body.MessagesSearched || len(body.Results) != 3 {
+			t.Errorf("all = %v with messages_searched %v, want posts and comments only", resultIDs(body.Results), body.MessagesSearched)
+		}
+	})
+}
@@ -0,0 +1,398 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"real-time-forum/backend/config"
+	"real-time-forum/backend/database"
+	"real-time-forum/backend/models"
+	"real-time-forum/backend/utils"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	maxTagLength       = 30
+	defaultTagsLimit   = 10
+	maxTagsLimit       = 50
+	tagPostCountColumn = "COUNT(p.id)"
+	tagPostCountJoin   = `
+		LEFT JOIN post_tags pt ON pt.tag_id = t.id
+		LEFT JOIN posts p ON p.id = pt.post_id AND p.deleted_at IS NULL`
+)
+
+// normalizeTag lowercases a tag and turns spaces and underscores into
+// dashes, so "#Go Lang" and "go_lang" are the same tag.
+func normalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+	name = strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '_' || r == '-'
+	}), "-")
+	if name == "" {
+		return "", nil
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' {
+			return "", errors.New("Tags may only contain letters, digits and dashes")
+		}
+	}
+	if utf8.RuneCountInString(name) > maxTagLength {
+		return "", fmt.Errorf("Tags must be at most %d characters", maxTagLength)
+	}
+	return name, nil
+}
+
+// canonicalTag looks up a normalized tag name, following a merge to the tag
+// that replaced it. found is false for tags nobody has used yet.
+func canonicalTag(db queryRower, name string) (id, canonical string, banned, found bool, err error) {
+	err = db.QueryRow(`
+		SELECT COALESCE(m.id, t.id), COALESCE(m.name, t.name), COALESCE(m.banned, t.banned)
+		FROM tags t LEFT JOIN tags m ON m.id = t.merged_into
+		WHERE t.name = ?`, name).Scan(&id, &canonical, &banned)
+	if err == sql.ErrNoRows {
+		return "", name, false, false, nil
+	}
+	return id, canonical, banned, err == nil, err
+}
+
+// cleanTags normalizes the tags given for a post and returns their canonical
+// names in order without duplicates. Banned tags and too many tags are
+// rejected.
+func cleanTags(names []string) ([]string, error) {
+	tags := []string{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name, err := normalizeTag(name)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			continue
+		}
+		_, canonical, banned, _, err := canonicalTag(database.DB, name)
+		if err != nil {
+			return nil, err
+		}
+		if banned {
+			return nil, errors.New("Tag not allowed: " + name)
+		}
+		if !seen[canonical] {
+			seen[canonical] = true
+			tags = append(tags, canonical)
+		}
+	}
+	if len(tags) > config.TagsPerPost {
+		return nil, fmt.Errorf("A post can have at most %d tags", config.TagsPerPost)
+	}
+	return tags, nil
+}
+
+// setPostTags replaces the tags of a post with names checked by cleanTags,
+// creating tags used for the first time.
+func setPostTags(tx *sql.Tx, postID string, names []string) error {
+	if _, err := tx.Exec("DELETE FROM post_tags WHERE post_id = ?", postID); err != nil {
+		return err
+	}
+	for _, name := range names {
+		_, err := tx.Exec("INSERT OR IGNORE INTO tags (id, name, created_at) VALUES (?, ?, ?)",
+			uuid.Must(uuid.NewV4()).String(), name, utils.Now())
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT OR IGNORE INTO post_tags (post_id, tag_id)
+			SELECT ?, id FROM tags WHERE name = ?`, postID, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTagsHandler lists tags in use, most used first. prefix narrows the list
+// for autocompletion and limit caps it.
+func GetTagsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	limit := defaultTagsLimit
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "Limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxTagsLimit)
+	}
+	prefix := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(q.Get("prefix")), "#"))
+	prefix = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix)
+
+	rows, err := database.DB.Query(`
+		SELECT t.name, `+tagPostCountColumn+`
+		FROM tags t`+tagPostCountJoin+`
+		WHERE t.banned = 0 AND t.merged_into IS NULL AND t.name LIKE ? ESCAPE '\'
+		GROUP BY t.id HAVING `+tagPostCountColumn+` > 0
+		ORDER BY `+tagPostCountColumn+` DESC, t.name ASC LIMIT ?`, prefix+"%", limit)
+	if err != nil {
+		http.Error(w, "Failed to fetch tags: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.Name, &t.PostCount); err != nil {
+			http.Error(w, "Failed to scan tag: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tags = append(tags, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// GetTagHandler returns a tag and how many posts carry it, for the top of
+// its tag page. A merged tag returns the tag it was merged into; the page
+// lists posts with /api/posts?tag=.
+func GetTagHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, err := normalizeTag(r.PathValue("name"))
+	if err != nil || name == "" {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+	id, canonical, banned, found, err := canonicalTag(database.DB, name)
+	if err != nil {
+		http.Error(w, "Failed to fetch tag: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found || banned {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	t := models.Tag{Name: canonical}
+	err = database.DB.QueryRow(`
+		SELECT `+tagPostCountColumn+` FROM tags t`+tagPostCountJoin+`
+		WHERE t.id = ?`, id).Scan(&t.PostCount)
+	if err != nil {
+		http.Error(w, "Failed to fetch tag: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// AdminTagsHandler lists every tag, including banned and merged ones.
+func AdminTagsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT t.name, ` + tagPostCountColumn + `, t.banned, COALESCE(m.name, '')
+		FROM tags t` + tagPostCountJoin + `
+		LEFT JOIN tags m ON m.id = t.merged_into
+		GROUP BY t.id
+		ORDER BY t.name ASC`)
+	if err != nil {
+		http.Error(w, "Failed to fetch tags: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.Name, &t.PostCount, &t.Banned, &t.MergedInto); err != nil {
+			http.Error(w, "Failed to scan tag: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tags = append(tags, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// AdminTagHandler bans or unbans /api/admin/tags/{name} (PUT {"banned":
+// true}). Banned tags disappear from posts and cannot be used, but posts
+// keep them so unbanning restores them.
+func AdminTagHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Banned bool `json:"banned"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+
+	name, err := normalizeTag(r.PathValue("name"))
+	if err != nil || name == "" {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+	// Banning a tag nobody has used yet keeps it from being used.
+	_, err = database.DB.Exec(`
+		INSERT INTO tags (id, name, banned, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET banned = excluded.banned`,
+		uuid.Must(uuid.NewV4()).String(), name, input.Banned, utils.Now())
+	if err != nil {
+		http.Error(w, "Failed to update tag: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.Tag{Name: name, Banned: input.Banned})
+}
+
+// MergeTagHandler merges /api/admin/tags/{name} into another tag (POST
+// {"into": "..."}): its posts move to that tag, and posts naming it later
+// get that tag instead.
+func MergeTagHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Into string `json:"into"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+	into, err := normalizeTag(input.Into)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if into == "" {
+		http.Error(w, "Target tag is required", http.StatusBadRequest)
+		return
+	}
+	name, err := normalizeTag(r.PathValue("name"))
+	if err != nil || name == "" {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to merge tags: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var sourceID string
+	var merged bool
+	err = tx.QueryRow("SELECT id, merged_into IS NOT NULL FROM tags WHERE name = ?", name).Scan(&sourceID, &merged)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to merge tags: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if merged {
+		http.Error(w, "Tag has already been merged", http.StatusConflict)
+		return
+	}
+
+	targetID, target, _, found, err := canonicalTag(tx, into)
+	if err != nil {
+		http.Error(w, "Failed to merge tags: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		targetID = uuid.Must(uuid.NewV4()).String()
+		if _, err := tx.Exec("INSERT INTO tags (id, name, created_at) VALUES (?, ?, ?)", targetID, target, utils.Now()); err != nil {
+			http.Error(w, "Failed to merge tags: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if targetID == sourceID {
+		http.Error(w, "A tag cannot be merged into itself", http.StatusBadRequest)
+		return
+	}
+
+	for _, stmt := range []string{
+		"INSERT OR IGNORE INTO post_tags (post_id, tag_id) SELECT post_id, ?1 FROM post_tags WHERE tag_id = ?2",
+		"DELETE FROM post_tags WHERE tag_id = ?2",
+		"UPDATE tags SET merged_into = ?1 WHERE id = ?2 OR merged_into = ?2",
+	} {
+		if _, err := tx.Exec(stmt, targetID, sourceID); err != nil {
+			http.Error(w, "Failed to merge tags: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to merge tags: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.Tag{Name: name, MergedInto: target})
+}
+
+// loadPostTags fills in Tags for every post, leaving out banned tags.
+func loadPostTags(posts []models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(posts))
+	args := make([]interface{}, len(posts))
+	index := make(map[string]int, len(posts))
+	for i, post := range posts {
+		placeholders[i] = "?"
+		args[i] = post.ID
+		index[post.ID] = i
+		posts[i].Tags = []string{}
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT pt.post_id, t.name
+		FROM post_tags pt
+		JOIN tags t ON t.id = pt.tag_id
+		WHERE t.banned = 0 AND pt.post_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY t.name ASC`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID, name string
+		if err := rows.Scan(&postID, &name); err != nil {
+			return err
+		}
+		i := index[postID]
+		if !posts[i].Deleted && !posts[i].Hidden {
+			posts[i].Tags = append(posts[i].Tags, name)
+		}
+	}
+	return rows.Err()
+}
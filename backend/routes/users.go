@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"real-time-forum/backend/database"
+	"real-time-forum/backend/encryption"
 	"real-time-forum/backend/models"
 	"real-time-forum/backend/utils"
 )
@@ -45,16 +46,21 @@ func GetUsersHandler(w http.ResponseWriter, r *http.Request) {
 
 		// Get last message exchanged with this user
 		lastMsgRow := database.DB.QueryRow(`
-			SELECT content, created_at 
+			SELECT id, content, created_at 
 			FROM messages 
 			WHERE (sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)
 			ORDER BY created_at DESC 
 			LIMIT 1`,
 			currentUserID, user.ID, user.ID, currentUserID)
 
-		var content, createdAt string
-		err := lastMsgRow.Scan(&content, &createdAt)
+		var messageID, content, createdAt string
+		err := lastMsgRow.Scan(&messageID, &content, &createdAt)
 		if err == nil {
+			content, err = encryption.Decrypt(content, messageID)
+			if err != nil {
+				log.Println("Error decrypting message preview:", err)
+				content = ""
+			}
 			user.LastMessage = content
 			user.LastMessageTime = createdAt
 		}
@@ -67,3 +73,10 @@ func GetUsersHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println("Error encoding users:", err)
 	}
 }
+
+// touchLastSeen records that the user was active, for inactivity retention.
+func touchLastSeen(userID string) {
+	if _, err := database.DB.Exec("UPDATE users SET last_seen_at = ? WHERE id = ?", utils.Now(), userID); err != nil {
+		log.Println("Error updating last seen time:", err)
+	}
+}
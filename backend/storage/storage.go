@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"real-time-forum/backend/config"
+)
+
+// ErrNotFound is returned by Get when no blob is stored under the key.
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps uploaded files. Keys are slash-separated paths chosen by
+// the server, never by users.
+type BlobStore interface {
+	Put(key string, data []byte, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// Blobs is the store selected by Open.
+var Blobs BlobStore
+
+// Open sets up Blobs according to config.BlobStore.
+func Open() error {
+	switch config.BlobStore {
+	case "local":
+		store, err := NewLocalStore(config.UploadDir)
+		if err != nil {
+			return err
+		}
+		Blobs = store
+	case "s3":
+		store, err := NewS3Store(config.S3Endpoint, config.S3Region, config.S3Bucket, config.S3AccessKey, config.S3SecretKey)
+		if err != nil {
+			return err
+		}
+		Blobs = store
+	default:
+		return fmt.Errorf("unknown blob store %q (expected local or s3)", config.BlobStore)
+	}
+	return nil
+}
@@ -63,6 +63,22 @@ func DestroySession(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// DestroyUserSessions signs the given users out of every session, e.g. when
+// their accounts are removed or anonymized.
+func DestroyUserSessions(userIDs ...string) {
+	remove := make(map[string]bool, len(userIDs))
+	for _, id := range userIDs {
+		remove[id] = true
+	}
+	sessMutex.Lock()
+	for token, userID := range sessions {
+		if remove[userID] {
+			delete(sessions, token)
+		}
+	}
+	sessMutex.Unlock()
+}
+
 func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		sessionToken, err := GetSession(r)
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+const maxSlugLength = 60
+
+// Slugify turns a title into a lowercase, hyphen-separated URL segment.
+func Slugify(title string) string {
+	var b strings.Builder
+	pendingHyphen := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pendingHyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingHyphen = false
+			b.WriteRune(r)
+		} else {
+			pendingHyphen = true
+		}
+	}
+
+	slug := b.String()
+	if len(slug) > maxSlugLength {
+		slug = slug[:maxSlugLength]
+		// Don't leave half a multi-byte rune or a trailing hyphen behind.
+		slug = strings.ToValidUTF8(slug, "")
+		slug = strings.TrimRight(slug, "-")
+	}
+	if slug == "" {
+		slug = "post"
+	}
+	return slug
+}
@@ -0,0 +1,18 @@
+package utils
+
+import "time"
+
+// TimeLayout is the canonical format for every timestamp stored in the
+// database. It is always UTC and fixed width, so timestamps sort correctly
+// when compared as strings.
+const TimeLayout = "2006-01-02T15:04:05.000Z"
+
+// FormatTime converts t to UTC and formats it with TimeLayout.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeLayout)
+}
+
+// Now returns the current time formatted with TimeLayout.
+func Now() string {
+	return FormatTime(time.Now())
+}
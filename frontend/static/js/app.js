@@ -1,4 +1,4 @@
-let currentUser = null; // Current user info (id and nickname)
+let currentUser = null; // Current user info (id, nickname and role)
 let ws = null; // WebSocket connection
 let currentChatUser = null; // Selected chat partner for DM
 let currentPostId = null; // Current post id for comments modal
@@ -6,9 +6,16 @@ let chatOffset = 0;
 const POSTS_LIMIT = 10;
 const CHAT_LIMIT = 10; // Returning to 10 messages per scroll as requested
 let chatAllLoaded = false; // Flag to indicate that all messages have been loaded
-let commentInterval = null; // Interval for polling comments when modal is open
-let allPosts = []; // Store all posts for filtering by category
+let replyToComment = null; // Comment being replied to in the comments modal
+let allPosts = []; // Posts loaded so far in the feed
+let postsNextCursor = null; // Cursor for the next page of posts
 let currentCategory = "All"; // Currently selected category
+let currentTag = ""; // Tag whose page is shown, "" for the whole feed
+let currentSort = "newest"; // Feed sort mode: newest, active, comments or hot
+let pendingNewPosts = 0; // Posts created by others since the feed was last loaded
+let savedView = false; // Showing the user's saved posts instead of the feed
+let savedFolder = ""; // Folder shown in the saved view, "" for all
+let allCategories = []; // Categories managed by admins
 let chatLastMessages = {}; // Store the last message for each chat user
 let chatUserStatus = {}; // Store user online status
 
@@ -17,25 +24,78 @@ function showMainView() {
   document.getElementById('app').innerHTML = `
     <div id="top-bar" style="display: flex; align-items: center; justify-content: space-between; margin-bottom: 20px;">
       <span id="welcome-msg" style="font-size: 1.2em; font-weight: bold;">Welcome ${toTitleCase(currentUser.nickname)}</span>
-      <button id="logout-btn" style="margin-right: 10px;">Logout</button>
+      <span>
+        ${isStaff() ? '<button id="report-queue-btn">Reports</button> <button id="moderation-log-btn">Moderation log</button>' : ''}
+        <button id="notifications-btn">Notifications</button>
+        <button id="drafts-btn">Drafts</button>
+        <button id="logout-btn" style="margin-right: 10px;">Logout</button>
+      </span>
+    </div>
+    <div id="notifications-panel" style="display:none;">
+      <div class="notifications-header">
+        <label><input type="checkbox" id="auto-subscribe"> Follow posts I write or comment on</label>
+        <button id="mark-all-read">Mark all read</button>
+      </div>
+      <div id="notification-types"></div>
+      <div id="notifications-list"></div>
+    </div>
+    <div id="drafts-panel" style="display:none;">
+      <div id="drafts-list"></div>
+    </div>
+    <div id="report-queue-panel" style="display:none;">
+      <select id="report-queue-status">
+        <option value="">Waiting for review</option>
+        <option value="open">Unclaimed</option>
+        <option value="claimed">Claimed</option>
+        <option value="resolved">Resolved</option>
+      </select>
+      <div id="report-queue-list"></div>
+      <button id="report-queue-more" style="display:none;">Load more</button>
+    </div>
+    <div id="moderation-log-panel" style="display:none;">
+      <div id="moderation-log-list"></div>
+      <button id="moderation-log-more" style="display:none;">Load more</button>
     </div>
     <div id="category-tabs" style="margin-bottom: 10px;"></div>
+    <select id="feed-sort">
+      <option value="newest">Newest</option>
+      <option value="active">Recently active</option>
+      <option value="comments">Most commented</option>
+      <option value="hot">Hot</option>
+    </select>
     <div>
       <h2>Posts Feed</h2>
       <form id="post-form">
-        <input type="text" id="post-category" placeholder="Category" required>
+        <input type="text" id="post-title" placeholder="Title" maxlength="120" required>
+        <select id="post-categories" multiple required></select>
+        <input type="text" id="post-tags" placeholder="Tags, separated by commas" list="tag-suggestions" autocomplete="off">
+        <datalist id="tag-suggestions"></datalist>
         <textarea id="post-content" placeholder="Enter the subject/content" required></textarea>
+        <details id="poll-fields">
+          <summary>Add a poll</summary>
+          <input type="text" id="poll-question" placeholder="Question" maxlength="200">
+          <textarea id="poll-options" placeholder="One option per line"></textarea>
+          <label><input type="checkbox" id="poll-multiple"> Allow several choices</label>
+          <label><input type="checkbox" id="poll-anonymous"> Anonymous votes</label>
+          <label>Closes <input type="datetime-local" id="poll-closes"></label>
+        </details>
+        <input type="file" id="post-images" accept="image/jpeg,image/png,image/gif" multiple>
         <button type="submit">Create Post</button>
       </form>
+      <div id="tag-header" style="display:none;"></div>
+      <button id="new-posts-banner" style="display:none;"></button>
       <div id="posts-container"></div>
     </div>
     <div id="post-comments-modal" class="modal" style="display:none;">
       <div class="modal-content">
         <span id="close-comments" class="close" style="cursor:pointer;">×</span>
-        <h3>Comments</h3>
+        <h3 id="comments-post-title">Comments</h3>
         <div id="comments-container"></div>
+        <p id="locked-notice" style="display:none;">This post is locked. No new comments can be added.</p>
         <form id="comment-form">
+          <div id="reply-indicator" style="display:none;"></div>
           <textarea id="comment-content" placeholder="Add a comment..." required></textarea>
+          <input type="file" id="comment-images" accept="image/jpeg,image/png,image/gif" multiple>
           <button type="submit">Post Comment</button>
         </form>
       </div>
@@ -45,6 +105,19 @@ function showMainView() {
   </footer>
   `;
   document.getElementById('logout-btn').addEventListener('click', logout);
+  document.getElementById('notifications-btn').addEventListener('click', toggleNotificationsPanel);
+  document.getElementById('drafts-btn').addEventListener('click', toggleDraftsPanel);
+  if (isStaff()) {
+    document.getElementById('moderation-log-btn').addEventListener('click', toggleModerationLog);
+    document.getElementById('moderation-log-more').addEventListener('click', () => loadModerationLog(true));
+    document.getElementById('report-queue-btn').addEventListener('click', toggleReportQueue);
+    document.getElementById('report-queue-status').addEventListener('change', () => loadReportQueue());
+    document.getElementById('report-queue-more').addEventListener('click', () => loadReportQueue(true));
+  }
+  document.getElementById('mark-all-read').addEventListener('click', () => markNotificationsRead([]));
+  document.getElementById('auto-subscribe').addEventListener('change', function () {
+    saveNotificationSettings({ auto_subscribe: this.checked });
+  });
   document.getElementById('post-form').addEventListener('submit', createPost);
   document.getElementById('post-content').addEventListener('keydown', function (e) {
     if (e.key === 'Enter' && !e.shiftKey) {
@@ -53,18 +126,23 @@ function showMainView() {
     }
   });
   document.getElementById('close-comments').addEventListener('click', closeCommentsModal);
+  initDraftAutosave();
+  document.getElementById('new-posts-banner').addEventListener('click', () => loadPosts());
+  document.getElementById('post-tags').addEventListener('input', debounce(suggestTags, 200));
+  document.getElementById('feed-sort').addEventListener('change', function () {
+    currentSort = this.value;
+    allPosts = [];
+    loadPosts();
+  });
+  loadCategories();
+  loadReactionOptions();
   loadPosts();
+  loadNotifications();
+  openPermalinkPost();
   document.getElementById('chat-sidebar').style.display = 'flex';
   initChatSidebar();
 }
 
-// Periodic updates with stored reference
-window.postsInterval = setInterval(function () {
-  if (currentUser) {
-    loadPosts();
-  }
-}, 2000);
-
 // Initialize on DOM load
 document.addEventListener('DOMContentLoaded', () => {
   checkSession();
@@ -0,0 +1,26 @@
+// Upload every image chosen in a file input and return their attachment ids
+async function uploadImages(input) {
+  const ids = [];
+  for (const file of input.files) {
+    const form = new FormData();
+    form.append('file', file);
+    const res = await fetch('/api/attachments', { method: 'POST', body: form, credentials: 'include' });
+    if (!res.ok) {
+      throw new Error(`${file.name}: ${await res.text()}`);
+    }
+    const attachment = await res.json();
+    ids.push(attachment.id);
+  }
+  return ids;
+}
+
+// Thumbnails linking to the full-size images
+function renderAttachments(attachments) {
+  if (!attachments || attachments.length === 0) return '';
+  const escape = s => String(s).replace(/[&<>"']/g, c => `&#${c.charCodeAt(0)};`);
+  return `<div class="attachments">${attachments.map(a => `
+    <a href="${a.url}" target="_blank" rel="noopener">
+      <img src="${a.thumbnail_url}" alt="${escape(a.filename)}" loading="lazy">
+    </a>`).join('')}
+  </div>`;
+}
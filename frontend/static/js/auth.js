@@ -6,18 +6,6 @@ async function logout() {
     // Silent error handling for production
   }
   
-  // Clear intervals
-  if (window.postsInterval) {
-    clearInterval(window.postsInterval);
-    window.postsInterval = null;
-  }
-  
-  // Clear comment interval if active
-  if (commentInterval) {
-    clearInterval(commentInterval);
-    commentInterval = null;
-  }
-  
   // Clear chat users interval if exists
   if (window.chatUsersInterval) {
     clearInterval(window.chatUsersInterval);
@@ -81,7 +69,7 @@ function showLoginView() {
         return;
       }
       const userData = await res.json();
-      currentUser = { id: userData.id, nickname: userData.nickname };
+      currentUser = { id: userData.id, nickname: userData.nickname, role: userData.role };
       // Clear any cached chat data from previous sessions
       chatLastMessages = {};
       chatUserStatus = {};
@@ -413,7 +401,7 @@ function showRegisterView() {
 async function checkSession() {
   try {
     const sessionData = await api('/api/session');
-    currentUser = { id: sessionData.id, nickname: sessionData.nickname };
+    currentUser = { id: sessionData.id, nickname: sessionData.nickname, role: sessionData.role };
     initWebSocket();
     showMainView();
   } catch (error) {
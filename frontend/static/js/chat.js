@@ -71,10 +71,14 @@ function initChatSidebar() {
       <div id="chat-input-container">
         <input type="text" id="chat-input" placeholder="Type a message">
         <button id="chat-send-btn">Send</button>
+        <button id="chat-report-user-btn">Report user</button>
       </div>
     </div>
   `;
   document.getElementById('chat-send-btn').addEventListener('click', sendChatMessage);
+  document.getElementById('chat-report-user-btn').addEventListener('click', () => {
+    if (currentChatUser) reportContent('user', currentChatUser);
+  });
   const chatWindow = document.getElementById('chat-window');
   chatWindow.addEventListener('scroll', debounce(function () {
     if (chatWindow.scrollTop === 0 && currentChatUser && !chatAllLoaded) {
@@ -379,8 +383,9 @@ async function loadChatHistory(withUserId, reset) {
       const displayName = msg.sender_nickname ? msg.sender_nickname : msg.sender_id;
       
       msgDiv.innerHTML = `
-        <div class="meta"><strong class="sender-nickname">${toTitleCase(displayName)}</strong> ${formatDate(msg.created_at, 'full')}</div>
-        <div>${msg.content}</div>
+        <div class="meta"><strong class="sender-nickname">${toTitleCase(displayName)}</strong> ${formatDate(msg.created_at, 'full')}
+          ${msg.sender_id !== currentUser.id ? renderReportButton('message', msg.id) : ''}</div>
+        <div>${msg.hidden ? '<em class="hidden-content">[hidden pending review]</em>' : renderMessageContent(msg)}</div>
       `;
       
       // Find the user in the users list to get the gender (asynchronously)
@@ -473,8 +478,9 @@ function appendChatMessage(msg) {
   
   // Set HTML content first
   msgDiv.innerHTML = `
-    <div class="meta"><strong class="sender-nickname">${toTitleCase(displayName)}</strong> ${formatDate(msg.created_at, 'full')}</div>
-    <div>${msg.content}</div>
+    <div class="meta"><strong class="sender-nickname">${toTitleCase(displayName)}</strong> ${formatDate(msg.created_at, 'full')}
+      ${msg.sender_id !== currentUser.id ? renderReportButton('message', msg.id) : ''}</div>
+    <div>${msg.hidden ? '<em class="hidden-content">[hidden pending review]</em>' : renderMessageContent(msg)}</div>
   `;
   
   // Find the user in the users list to get the gender
@@ -537,9 +543,12 @@ function sendChatMessage() {
 }
 
 // Initialize WebSocket with proper error handling
+const WS_RECONNECT_DELAY = 2000; // How long to wait before reopening a dropped chat connection
+
 function initWebSocket() {
   try {
-    ws = new WebSocket(`ws://${window.location.host}/api/chat?sender_id=${currentUser.id}`);
+    const socket = new WebSocket(`ws://${window.location.host}/api/chat?sender_id=${currentUser.id}`);
+    ws = socket;
     
     ws.onopen = function () {
       console.log("WebSocket connection established");
@@ -548,6 +557,11 @@ function initWebSocket() {
     ws.onmessage = function (event) {
       try {
         const msg = JSON.parse(event.data);
+        // Typed events are live forum updates rather than chat messages
+        if (msg.type) {
+          handleLiveEvent(msg);
+          return;
+        }
         if (!msg.sender_nickname) {
           msg.sender_nickname = msg.sender_id;
         }
@@ -584,6 +598,13 @@ function initWebSocket() {
     
     ws.onclose = function (event) {
       console.log("WebSocket connection closed");
+      // The server closes connections that fall behind; reopen it and reload
+      // the open conversation unless the user signed out meanwhile
+      setTimeout(() => {
+        if (ws !== socket || !currentUser) return;
+        initWebSocket();
+        if (currentChatUser) loadChatHistory(currentChatUser, true);
+      }, WS_RECONNECT_DELAY);
     };
     
     ws.onerror = function (error) {
@@ -1,15 +1,23 @@
 // Show comments modal
 async function showComments(postId) {
     currentPostId = postId;
+    setReplyTo(null);
     const modal = document.getElementById('post-comments-modal');
     if (!modal) {
       // Silently handle the error instead of logging to console
       return;
     }
     modal.style.display = 'flex';
+    document.getElementById('comments-post-title').textContent = 'Comments';
+    showPostLock(false);
+    api(`/api/posts/${postId}`).then(post => {
+      document.getElementById('comments-post-title').textContent = post.title;
+      showPostLock(post.locked);
+      history.replaceState(null, '', `/posts/${post.id}/${post.slug}`);
+    }).catch(() => {
+      document.getElementById('comments-post-title').textContent = 'Post not found';
+    });
     loadComments();
-    if (commentInterval) clearInterval(commentInterval);
-    commentInterval = setInterval(loadComments, 2000);
     setTimeout(() => {
       const commentInput = document.getElementById('comment-content');
       if (commentInput) commentInput.focus();
@@ -28,14 +36,38 @@ async function showComments(postId) {
         comments.forEach(comment => {
           const commentDiv = document.createElement('div');
           commentDiv.className = 'comment';
+          commentDiv.style.marginLeft = `${(comment.depth || 0) * 20}px`;
+          if (comment.deleted) {
+            commentDiv.className = 'comment comment-deleted';
+            commentDiv.innerHTML = `<div class="comment-content">[deleted]</div>`;
+            commentsContainer.appendChild(commentDiv);
+            return;
+          }
           const displayName = comment.nickname ? toTitleCase(comment.nickname) : comment.user_id;
           commentDiv.innerHTML = `
             <div class="meta">
               <strong>${displayName}</strong> 
               <span class="comment-date">${formatDate(comment.created_at, 'full')}</span>
+              ${comment.edited ? '<span class="comment-edited">(edited)</span>' : ''}
+            </div>
+            <div class="comment-content markdown">${comment.hidden ? '<em class="hidden-content">[hidden pending review]</em>' : comment.content_html}</div>
+            ${renderAttachments(comment.attachments)}
+            ${renderReactionBar('comment', comment)}
+            <div class="comment-actions">
+              <button class="reply-comment-btn">Reply</button>
+              ${comment.reply_count > 0 ? `<span class="comment-replies">${comment.reply_count} ${comment.reply_count === 1 ? 'reply' : 'replies'}</span>` : ''}
+              ${comment.user_id === currentUser.id ? `
+              <button class="edit-comment-btn">Edit</button>
+              <button class="delete-comment-btn">Delete</button>` : renderReportButton('comment', comment.id)}
             </div>
-            <div class="comment-content">${comment.content}</div>
           `;
+          linkMentions(commentDiv.querySelector('.comment-content'), comment.mentions);
+          commentDiv.querySelector('.reply-comment-btn').addEventListener('click', () => setReplyTo(comment));
+          const editBtn = commentDiv.querySelector('.edit-comment-btn');
+          if (editBtn) {
+            editBtn.addEventListener('click', () => editComment(comment));
+            commentDiv.querySelector('.delete-comment-btn').addEventListener('click', () => deleteComment(comment.id));
+          }
           commentsContainer.appendChild(commentDiv);
         });
       }
@@ -43,6 +75,14 @@ async function showComments(postId) {
         e.preventDefault();
         const content = document.getElementById('comment-content').value;
         const comment = { post_id: currentPostId, user_id: currentUser.id, content };
+        if (replyToComment) comment.parent_comment_id = replyToComment.id;
+        try {
+          comment.attachment_ids = await uploadImages(document.getElementById('comment-images'));
+        } catch (error) {
+          alert(error.message);
+          return;
+        }
+        await settleDraft(commentDraftContext());
         const res = await fetch('/api/comments/create', {
           method: 'POST',
           headers: { 'Content-Type': 'application/json' },
@@ -50,10 +90,12 @@ async function showComments(postId) {
         });
         if (!res.ok) {
           const err = await res.text();
-          alert("Unable to post your comment. Please try again or check if you're still logged in.");
+          alert(res.status === 400 ? err : "Unable to post your comment. Please try again or check if you're still logged in.");
           return;
         }
+        if (res.status === 202) alert('Your comment is waiting for a moderator to review it.');
         document.getElementById('comment-form').reset();
+        setReplyTo(null);
         loadComments();
       };
       const commentInput = document.getElementById('comment-content');
@@ -71,11 +113,63 @@ async function showComments(postId) {
     }
   }
   
+  // Make the comment form reply to comment, or to the post when comment is null
+  function setReplyTo(comment) {
+    replyToComment = comment;
+    restoreCommentDraft();
+    const indicator = document.getElementById('reply-indicator');
+    if (!indicator) return;
+    if (!comment) {
+      indicator.style.display = 'none';
+      indicator.innerHTML = '';
+      return;
+    }
+    indicator.style.display = 'block';
+    indicator.innerHTML = `Replying to <strong>${toTitleCase(comment.nickname)}</strong> <button type="button" id="cancel-reply">Cancel</button>`;
+    document.getElementById('cancel-reply').addEventListener('click', () => setReplyTo(null));
+    document.getElementById('comment-content').focus();
+  }
+
+  // Edit one of the user's comments
+  async function editComment(comment) {
+    const content = prompt('Edit comment', comment.content);
+    if (content === null) return;
+    const res = await fetch(`/api/comments/${comment.id}`, {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ content })
+    });
+    if (!res.ok) {
+      alert(await res.text());
+      return;
+    }
+    if ((await res.json()).hidden) alert('Your comment is waiting for a moderator to review it.');
+    loadComments();
+  }
+
+  // Delete one of the user's comments
+  async function deleteComment(commentId) {
+    if (!confirm('Delete this comment?')) return;
+    const res = await fetch(`/api/comments/${commentId}`, { method: 'DELETE' });
+    if (!res.ok) {
+      alert(await res.text());
+      return;
+    }
+    loadComments();
+  }
+
   // Close comments modal
   function closeCommentsModal() {
     document.getElementById('post-comments-modal').style.display = 'none';
-    if (commentInterval) {
-      clearInterval(commentInterval);
-      commentInterval = null;
+    if (window.location.pathname !== '/') {
+      history.replaceState(null, '', '/');
+    }
+    currentPostId = null;
+  }
+
+  // Reload the open thread when someone comments on it
+  function handleNewComment(data) {
+    if (data.post_id === currentPostId) {
+      loadComments();
     }
   }
\ No newline at end of file
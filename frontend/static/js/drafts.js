@@ -0,0 +1,147 @@
+const DRAFT_SAVE_DELAY = 1000; // How long typing must pause before a draft is saved
+let pendingDrafts = {}; // Drafts waiting to be saved, by context: { timer, draft }
+let draftSaves = {}; // Draft saves in flight, by context
+
+// Draft context of the comment form: a reply, or a comment on the open post
+function commentDraftContext() {
+  return replyToComment ? `reply:${replyToComment.id}` : `comment:${currentPostId}`;
+}
+
+function saveDraft(context, draft) {
+  const save = fetch(`/api/drafts/${encodeURIComponent(context)}`, {
+    method: 'PUT',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(draft)
+  }).catch(() => {});
+  draftSaves[context] = save;
+  return save;
+}
+
+// Save draft for context once typing pauses. The draft is taken now, so a
+// form switching to another context does not change what gets saved.
+function scheduleDraftSave(context, draft) {
+  const pending = pendingDrafts[context];
+  if (pending) clearTimeout(pending.timer);
+  pendingDrafts[context] = {
+    draft,
+    timer: setTimeout(() => {
+      delete pendingDrafts[context];
+      saveDraft(context, draft);
+    }, DRAFT_SAVE_DELAY)
+  };
+}
+
+// Drop a pending save and wait for one in flight, so a late autosave does
+// not bring back the draft the server deletes on publishing
+async function settleDraft(context) {
+  const pending = pendingDrafts[context];
+  if (pending) clearTimeout(pending.timer);
+  delete pendingDrafts[context];
+  await draftSaves[context];
+}
+
+// The draft for context, or null when there is none
+async function loadDraft(context) {
+  if (pendingDrafts[context]) return pendingDrafts[context].draft;
+  try {
+    return await api(`/api/drafts/${encodeURIComponent(context)}`);
+  } catch (error) {
+    return null;
+  }
+}
+
+// Fill an empty post form with the new post draft
+async function restorePostDraft() {
+  const draft = await loadDraft('post');
+  const title = document.getElementById('post-title');
+  const content = document.getElementById('post-content');
+  if (!draft || !title || title.value || content.value) return;
+  title.value = draft.title;
+  content.value = draft.content;
+}
+
+// Fill the comment form with the draft for what it now answers
+async function restoreCommentDraft() {
+  if (!currentPostId) return;
+  const context = commentDraftContext();
+  const draft = await loadDraft(context);
+  const input = document.getElementById('comment-content');
+  if (!input || commentDraftContext() !== context) return;
+  input.value = draft ? draft.content : '';
+}
+
+function initDraftAutosave() {
+  const savePostDraft = () => scheduleDraftSave('post', {
+    title: document.getElementById('post-title').value,
+    content: document.getElementById('post-content').value
+  });
+  document.getElementById('post-title').addEventListener('input', savePostDraft);
+  document.getElementById('post-content').addEventListener('input', savePostDraft);
+  document.getElementById('comment-content').addEventListener('input', function () {
+    if (currentPostId) scheduleDraftSave(commentDraftContext(), { content: this.value });
+  });
+  restorePostDraft();
+}
+
+async function loadDraftsList() {
+  const list = document.getElementById('drafts-list');
+  let drafts;
+  try {
+    drafts = await api('/api/drafts');
+  } catch (error) {
+    return;
+  }
+  list.innerHTML = drafts.length === 0 ? '<p class="empty-state">No drafts.</p>' : '';
+  drafts.forEach(d => list.appendChild(buildDraftItem(d)));
+}
+
+// One draft of the list. Draft text is set with textContent.
+function buildDraftItem(d) {
+  const item = document.createElement('div');
+  item.className = 'draft-item';
+  item.innerHTML = `
+    <div class="draft-target"></div>
+    <div class="draft-preview"></div>
+    <span class="notification-date">Saved ${formatDate(d.updated_at)}</span>
+    <button class="draft-open">Open</button>
+    <button class="draft-discard">Discard</button>
+  `;
+  let target = 'New post';
+  if (d.parent_comment_id) {
+    target = `Reply to ${toTitleCase(d.parent_author)} on "${d.post_title}"`;
+  } else if (d.post_id) {
+    target = `Comment on "${d.post_title}"`;
+  }
+  item.querySelector('.draft-target').textContent = target;
+  item.querySelector('.draft-preview').textContent = [d.title, d.content].filter(Boolean).join(' - ').slice(0, 200);
+
+  item.querySelector('.draft-open').addEventListener('click', () => {
+    document.getElementById('drafts-panel').style.display = 'none';
+    if (!d.post_id) {
+      document.getElementById('post-title').value = d.title;
+      document.getElementById('post-content').value = d.content;
+      document.getElementById('post-title').focus();
+      return;
+    }
+    showComments(d.post_id);
+    if (d.parent_comment_id) setReplyTo({ id: d.parent_comment_id, nickname: d.parent_author });
+  });
+  item.querySelector('.draft-discard').addEventListener('click', async () => {
+    if (!confirm('Discard this draft?')) return;
+    await settleDraft(d.context);
+    const res = await fetch(`/api/drafts/${encodeURIComponent(d.context)}`, { method: 'DELETE' });
+    if (!res.ok) {
+      alert(await res.text());
+      return;
+    }
+    item.remove();
+  });
+  return item;
+}
+
+function toggleDraftsPanel() {
+  const panel = document.getElementById('drafts-panel');
+  const open = panel.style.display === 'none';
+  panel.style.display = open ? 'block' : 'none';
+  if (open) loadDraftsList();
+}
@@ -0,0 +1,61 @@
+// Matches an @name the way the server finds mentions
+const MENTION_PATTERN = /(?<![\p{L}\p{N}_.\-\\@])@([\p{L}\p{N}_.\-]+)/gu;
+
+function mentionLink(mention, text) {
+  const link = document.createElement('a');
+  link.href = '#';
+  link.className = 'mention';
+  link.setAttribute('data-user-id', mention.user_id);
+  link.textContent = text;
+  return link;
+}
+
+// Turn the resolved @mentions in rendered markdown into links to those users
+// The mention offsets index the markdown source, so they are matched by
+// nickname in the rendered text instead
+function linkMentions(container, mentions) {
+  if (!container || !mentions || mentions.length === 0) return;
+  const byName = {};
+  mentions.forEach(m => { byName[m.nickname.toLowerCase()] = m; });
+  const walker = document.createTreeWalker(container, NodeFilter.SHOW_TEXT);
+  const nodes = [];
+  while (walker.nextNode()) {
+    if (!walker.currentNode.parentElement.closest('code, pre, a')) nodes.push(walker.currentNode);
+  }
+  nodes.forEach(node => {
+    const text = node.textContent;
+    const fragment = document.createDocumentFragment();
+    let last = 0;
+    for (const match of text.matchAll(MENTION_PATTERN)) {
+      const name = match[1].replace(/[.\-]+$/, '');
+      const mention = byName[name.toLowerCase()];
+      if (!mention) continue;
+      fragment.append(text.slice(last, match.index), mentionLink(mention, '@' + name));
+      last = match.index + 1 + name.length;
+    }
+    if (last === 0) return;
+    fragment.append(text.slice(last));
+    node.replaceWith(fragment);
+  });
+}
+
+// Chat message content with its mentions marked, using the server's offsets
+function renderMessageContent(msg) {
+  const mentions = msg.mentions || [];
+  let html = '';
+  let last = 0;
+  mentions.forEach(m => {
+    html += msg.content.slice(last, m.start) + mentionLink(m, msg.content.slice(m.start, m.end)).outerHTML;
+    last = m.end;
+  });
+  return html + msg.content.slice(last);
+}
+
+// Open a direct conversation with a mentioned user
+document.addEventListener('click', (e) => {
+  const link = e.target.closest('.mention');
+  if (!link) return;
+  e.preventDefault();
+  const userId = link.getAttribute('data-user-id');
+  if (userId !== currentUser.id) selectChatUser(userId);
+});
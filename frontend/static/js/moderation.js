@@ -0,0 +1,125 @@
+let moderationLogCursor = ''; // Next page of the moderation log, '' when there is none
+
+function isStaff() {
+  return currentUser && (currentUser.role === 'moderator' || currentUser.role === 'admin');
+}
+
+// Pin, lock and move buttons shown to moderators and admins
+function renderModerationButtons(post) {
+  if (!isStaff()) return '';
+  return `
+    <button data-post-id="${post.id}" class="moderate-btn" data-action="pin">${post.pinned ? 'Unpin' : 'Pin'}</button>
+    <button data-post-id="${post.id}" class="moderate-btn" data-action="lock">${post.locked ? 'Unlock' : 'Lock'}</button>
+    <button data-post-id="${post.id}" class="moderate-btn" data-action="move">Move</button>`;
+}
+
+async function moderatePost(postId, action) {
+  const post = allPosts.find(p => p.id === postId);
+  if (!post) return;
+  let res;
+  if (action === 'move') {
+    const names = prompt('Move to categories (comma separated):', (post.categories || []).join(', '));
+    if (names === null) return;
+    res = await fetch(`/api/posts/${postId}/move`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ categories: names.split(',').map(n => n.trim()).filter(Boolean) })
+    });
+  } else {
+    const on = action === 'pin' ? post.pinned : post.locked;
+    res = await fetch(`/api/posts/${postId}/${action}`, { method: on ? 'DELETE' : 'PUT' });
+  }
+  if (!res.ok) {
+    alert(await res.text());
+    return;
+  }
+  // The post_moderated event refreshes the feed.
+}
+
+// Refresh the feed when a moderator pins, locks or moves a post, since
+// pinning changes the order
+function handlePostModerated(data) {
+  if (data.post_id === currentPostId) showPostLock(data.locked);
+  if (!savedView) loadPosts();
+}
+
+// Hide the comment form on a locked post, except from staff
+function showPostLock(locked) {
+  const notice = document.getElementById('locked-notice');
+  const form = document.getElementById('comment-form');
+  if (!notice || !form) return;
+  notice.style.display = locked ? 'block' : 'none';
+  form.style.display = locked && !isStaff() ? 'none' : '';
+}
+
+document.addEventListener('click', (e) => {
+  const btn = e.target.closest('.moderate-btn');
+  if (!btn) return;
+  moderatePost(btn.getAttribute('data-post-id'), btn.getAttribute('data-action'));
+});
+
+const MODERATION_ACTIONS = {
+  pin: 'pinned',
+  unpin: 'unpinned',
+  lock: 'locked',
+  unlock: 'unlocked',
+  move: 'moved',
+  edit: 'edited',
+  delete: 'deleted',
+  dismiss: 'dismissed reports on',
+  warn: 'warned the author of',
+  remove: 'removed'
+};
+
+// Load the moderation log, or its next page when append is true
+async function loadModerationLog(append = false) {
+  const list = document.getElementById('moderation-log-list');
+  const params = new URLSearchParams();
+  if (append && moderationLogCursor) params.set('cursor', moderationLogCursor);
+  let page;
+  try {
+    page = await api(`/api/moderation/log?${params}`);
+  } catch (error) {
+    return;
+  }
+  if (!append) list.innerHTML = '';
+  page.actions.forEach(a => {
+    const item = document.createElement('div');
+    item.className = 'moderation-entry';
+    // Actions on messages and users have no post to link to
+    let target = a.target_type === 'comment' ? 'a comment on <a href="#"></a>' : '<a href="#"></a>';
+    let action = MODERATION_ACTIONS[a.action] || a.action;
+    if (a.target_type === 'message') target = 'a message';
+    if (a.target_type === 'user') {
+      target = 'a user';
+      if (a.action === 'warn') action = 'warned';
+    }
+    item.innerHTML = `
+      <strong>${toTitleCase(a.moderator)}</strong> ${action} ${target}
+      <span class="moderation-detail"></span>
+      <span class="notification-date">${formatDate(a.created_at, 'full')}</span>
+    `;
+    const link = item.querySelector('a');
+    if (link) {
+      link.textContent = a.post_title;
+      link.addEventListener('click', (e) => {
+        e.preventDefault();
+        showComments(a.post_id);
+      });
+    }
+    if (a.detail) item.querySelector('.moderation-detail').textContent = `(${a.detail})`;
+    list.appendChild(item);
+  });
+  if (!append && page.actions.length === 0) {
+    list.innerHTML = '<p class="empty-state">No moderator actions yet.</p>';
+  }
+  moderationLogCursor = page.next_cursor;
+  document.getElementById('moderation-log-more').style.display = moderationLogCursor ? '' : 'none';
+}
+
+function toggleModerationLog() {
+  const panel = document.getElementById('moderation-log-panel');
+  const open = panel.style.display === 'none';
+  panel.style.display = open ? 'block' : 'none';
+  if (open) loadModerationLog();
+}
@@ -0,0 +1,176 @@
+let unreadNotifications = 0; // Unread notifications shown on the top bar button
+
+// Load the newest notifications and the unread count
+async function loadNotifications() {
+  try {
+    const page = await api('/api/notifications');
+    unreadNotifications = page.unread;
+    renderNotifications(page.notifications || []);
+  } catch (error) {
+    // Keep whatever is shown
+  }
+  updateNotificationsButton();
+}
+
+function updateNotificationsButton() {
+  const btn = document.getElementById('notifications-btn');
+  if (!btn) return;
+  btn.textContent = unreadNotifications > 0 ? `Notifications (${unreadNotifications})` : 'Notifications';
+}
+
+function renderNotifications(notifications) {
+  const list = document.getElementById('notifications-list');
+  if (!list) return;
+  if (notifications.length === 0) {
+    list.innerHTML = '<p class="empty-state">No notifications yet.</p>';
+    return;
+  }
+  list.innerHTML = '';
+  notifications.forEach(n => {
+    const item = document.createElement('div');
+    item.className = n.read ? 'notification' : 'notification unread';
+    // Reports about messages and users have no post to link to
+    const link = n.post_id ? `<a href="/posts/${n.post_id}/${n.post_slug}"></a>` : '';
+    item.innerHTML = `
+      ${describeNotification(n)}
+      ${link}
+      <span class="notification-date">${formatDate(n.created_at, 'full')}</span>
+    `;
+    // Post titles are plain text and may contain markup characters
+    if (n.post_id) item.querySelector('a').textContent = n.post_title;
+    if (n.message_id) {
+      // A mention in a direct message opens the conversation
+      item.addEventListener('click', async () => {
+        if (!n.read) await markNotificationsRead([n.id]);
+        document.getElementById('notifications-panel').style.display = 'none';
+        selectChatUser(n.actor_id);
+      });
+    } else if (n.post_id) {
+      item.querySelector('a').addEventListener('click', async (e) => {
+        e.preventDefault();
+        if (!n.read) await markNotificationsRead([n.id]);
+        document.getElementById('notifications-panel').style.display = 'none';
+        showComments(n.post_id);
+      });
+    } else if (!n.read) {
+      item.addEventListener('click', () => markNotificationsRead([n.id]));
+    }
+    list.appendChild(item);
+  });
+}
+
+const NOTIFICATION_TYPES = {
+  comment: 'New comments on posts I follow',
+  reply: 'Replies to my comments',
+  mention: 'Mentions',
+  reaction: 'Reactions to my posts and comments',
+  moderation: 'Moderator actions on my posts and comments',
+  report: 'Outcomes of my reports'
+};
+
+const REPORT_OUTCOMES = {
+  dismiss: 'found nothing wrong with',
+  remove: 'removed',
+  warn: 'warned the author of'
+};
+
+const REPORT_TARGETS = {
+  post: 'the post you reported:',
+  comment: 'the comment you reported on',
+  message: 'the message you reported',
+  user: 'the user you reported'
+};
+
+// The sentence before the post title in a notification
+function describeNotification(n) {
+  const actor = `<strong>${toTitleCase(n.actor || 'Someone')}</strong>`;
+  const target = n.comment_id ? 'your comment on' : 'your post';
+  switch (n.type) {
+    case 'mention': return n.message_id ? `${actor} mentioned you in a message` : `${actor} mentioned you in`;
+    case 'reply': return `${actor} replied to your comment on`;
+    case 'reaction': return `${actor} reacted ${REACTION_LABELS[n.detail] || n.detail} to ${target}`;
+    case 'moderation':
+      if (n.detail === 'warn') {
+        if (n.target === 'user') return 'A moderator warned you about your behaviour';
+        if (n.target === 'message') return 'A moderator warned you about a message you sent';
+        return `A moderator warned you about ${target}`;
+      }
+      return `A moderator ${n.detail === 'delete' ? 'deleted' : 'edited'} ${target}`;
+    case 'report': return `A moderator ${REPORT_OUTCOMES[n.detail] || n.detail} ${REPORT_TARGETS[n.target] || 'what you reported'}`;
+    default: return `${actor} commented on`;
+  }
+}
+
+// Mark the given notifications read, or all of them when ids is empty
+async function markNotificationsRead(ids) {
+  const res = await fetch('/api/notifications/read', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ ids })
+  });
+  if (res.ok) loadNotifications();
+}
+
+async function toggleNotificationsPanel() {
+  const panel = document.getElementById('notifications-panel');
+  const open = panel.style.display === 'none';
+  panel.style.display = open ? 'block' : 'none';
+  if (!open) return;
+  loadNotifications();
+  try {
+    const settings = await api('/api/notifications/settings');
+    document.getElementById('auto-subscribe').checked = settings.auto_subscribe;
+    renderNotificationTypes(settings.types || {});
+  } catch (error) {
+    // Leave the checkboxes as they are
+  }
+}
+
+// One checkbox per notification type
+function renderNotificationTypes(types) {
+  const container = document.getElementById('notification-types');
+  if (!container) return;
+  container.innerHTML = '';
+  Object.entries(NOTIFICATION_TYPES).forEach(([type, label]) => {
+    const row = document.createElement('label');
+    row.innerHTML = `<input type="checkbox" data-type="${type}"> ${label}`;
+    const box = row.querySelector('input');
+    box.checked = types[type] !== false;
+    box.addEventListener('change', () => saveNotificationSettings({ types: { [type]: box.checked } }));
+    container.appendChild(row);
+  });
+}
+
+async function saveNotificationSettings(settings) {
+  await fetch('/api/notifications/settings', {
+    method: 'PUT',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(settings)
+  });
+}
+
+// Follow or unfollow a post
+async function toggleSubscription(postId) {
+  const post = allPosts.find(p => p.id === postId);
+  if (!post) return;
+  const res = await fetch(`/api/posts/${postId}/subscription`, { method: post.subscribed ? 'DELETE' : 'POST' });
+  if (!res.ok) {
+    alert(await res.text());
+    return;
+  }
+  post.subscribed = (await res.json()).subscribed;
+  renderPosts(allPosts);
+}
+
+// Count a notification pushed over the WebSocket, unless its thread or
+// conversation is open
+function handleNotification(n) {
+  if (n.message_id ? n.actor_id === currentChatUser : n.post_id === currentPostId) {
+    markNotificationsRead([n.id]);
+    return;
+  }
+  unreadNotifications++;
+  updateNotificationsButton();
+  const panel = document.getElementById('notifications-panel');
+  if (panel && panel.style.display !== 'none') loadNotifications();
+}
@@ -0,0 +1,105 @@
+// Read the poll fields of the post form, or null when no question is given
+function readPollForm() {
+  const question = document.getElementById('poll-question').value.trim();
+  if (!question) return null;
+  const options = document.getElementById('poll-options').value.split('\n')
+    .map(text => text.trim()).filter(Boolean).map(text => ({ text }));
+  const poll = {
+    question,
+    options,
+    multiple: document.getElementById('poll-multiple').checked,
+    anonymous: document.getElementById('poll-anonymous').checked
+  };
+  const closes = document.getElementById('poll-closes').value;
+  if (closes) poll.closes_at = new Date(closes).toISOString();
+  return poll;
+}
+
+// Build the poll shown under a post. Text is set with textContent since
+// questions and options are plain text.
+function buildPoll(postId, poll) {
+  const box = document.createElement('div');
+  box.className = 'poll';
+  box.setAttribute('data-post-id', postId);
+
+  const question = document.createElement('div');
+  question.className = 'poll-question';
+  question.textContent = poll.question;
+  box.appendChild(question);
+
+  const mine = poll.my_votes || [];
+  const total = poll.options.reduce((sum, o) => sum + o.votes, 0);
+  poll.options.forEach(option => {
+    const btn = document.createElement('button');
+    btn.type = 'button';
+    btn.className = mine.includes(option.id) ? 'poll-option chosen' : 'poll-option';
+    btn.setAttribute('data-option-id', option.id);
+    btn.disabled = poll.closed;
+    if (option.voters && option.voters.length) btn.title = option.voters.map(toTitleCase).join(', ');
+    const percent = total ? Math.round(option.votes * 100 / total) : 0;
+    btn.innerHTML = `<span class="poll-bar" style="width:${percent}%"></span><span class="poll-option-text"></span><span class="poll-option-votes">${option.votes} · ${percent}%</span>`;
+    btn.querySelector('.poll-option-text').textContent = option.text;
+    box.appendChild(btn);
+  });
+
+  const meta = document.createElement('div');
+  meta.className = 'poll-meta';
+  const details = [`${poll.voters} ${poll.voters === 1 ? 'voter' : 'voters'}`];
+  details.push(poll.multiple ? 'choose any' : 'choose one');
+  if (poll.anonymous) details.push('anonymous');
+  if (poll.closed) details.push('closed');
+  else if (poll.closes_at) details.push(`closes ${formatDate(poll.closes_at, 'full')}`);
+  meta.textContent = details.join(' · ');
+  if (mine.length && !poll.closed) {
+    const unvote = document.createElement('button');
+    unvote.type = 'button';
+    unvote.className = 'poll-unvote';
+    unvote.textContent = 'Remove my vote';
+    meta.append(' ', unvote);
+  }
+  box.appendChild(meta);
+  return box;
+}
+
+// Replace the poll shown on a post, keeping the viewer's own votes when
+// the update comes from someone else
+function updatePoll(postId, poll) {
+  const post = allPosts.find(p => p.id === postId);
+  if (post && post.poll) {
+    poll = { ...poll, my_votes: poll.my_votes || post.poll.my_votes };
+    post.poll = poll;
+  }
+  if (!poll.my_votes) poll = { ...poll, my_votes: [] };
+  document.querySelectorAll(`.poll[data-post-id="${postId}"]`).forEach(box => {
+    box.replaceWith(buildPoll(postId, poll));
+  });
+}
+
+// Vote, change a vote or take it back
+document.addEventListener('click', async (e) => {
+  const btn = e.target.closest('.poll-option, .poll-unvote');
+  if (!btn) return;
+  const postId = btn.closest('.poll').getAttribute('data-post-id');
+  const post = allPosts.find(p => p.id === postId);
+  if (!post || !post.poll) return;
+  const poll = post.poll;
+
+  let optionIds = [];
+  if (btn.classList.contains('poll-option')) {
+    const optionId = btn.getAttribute('data-option-id');
+    const mine = poll.my_votes || [];
+    if (!poll.multiple) optionIds = [optionId];
+    else if (mine.includes(optionId)) optionIds = mine.filter(id => id !== optionId);
+    else optionIds = mine.concat(optionId);
+  }
+  const res = await fetch(`/api/polls/${poll.id}/votes`, optionIds.length ? {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ option_ids: optionIds })
+  } : { method: 'DELETE' });
+  if (!res.ok) {
+    alert(await res.text());
+    return;
+  }
+  updatePoll(postId, await res.json());
+});
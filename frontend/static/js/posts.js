@@ -1,11 +1,32 @@
-// Load all posts
-async function loadPosts() {
+// Load the first page of posts, or the next page when append is true
+async function loadPosts(append = false) {
+    const params = new URLSearchParams();
+    if (!savedView) params.set('sort', currentSort);
+    if (append) {
+      if (!postsNextCursor) return;
+      params.set('limit', POSTS_LIMIT);
+      params.set('cursor', postsNextCursor);
+    } else {
+      // Refresh everything already on screen so periodic reloads keep older
+      // pages. Pinned posts come on top of the page and don't count.
+      const paged = allPosts.filter(p => !p.pinned).length;
+      params.set('limit', Math.min(100, Math.max(POSTS_LIMIT, paged)));
+    }
+    if (savedView) {
+      if (savedFolder) params.set('folder', savedFolder);
+    } else {
+      if (currentCategory !== "All") params.set('category', currentCategory);
+      if (currentTag) params.set('tag', currentTag);
+    }
     try {
-      let posts = await api('/api/posts');
-      if (!Array.isArray(posts)) {
-        posts = [];
+      const page = await api((savedView ? '/api/bookmarks?' : '/api/posts?') + params.toString());
+      const posts = Array.isArray(page.posts) ? page.posts : [];
+      allPosts = append ? allPosts.concat(posts) : posts;
+      postsNextCursor = page.next_cursor || null;
+      if (!append) {
+        pendingNewPosts = 0;
+        updateNewPostsBanner();
       }
-      allPosts = posts;
       buildCategoryTabs(allPosts);
       renderPosts(allPosts);
     } catch (error) {
@@ -13,12 +34,69 @@ async function loadPosts() {
     }
   }
   
+  // Count posts created by others in the current category
+  function handleNewPost(data) {
+    if (data.user_id === currentUser.id || savedView) return;
+    if (currentCategory !== "All" && !(data.categories || []).includes(currentCategory)) return;
+    if (currentTag && !(data.tags || []).includes(currentTag)) return;
+    pendingNewPosts++;
+    updateNewPostsBanner();
+  }
+
+  function updateNewPostsBanner() {
+    const banner = document.getElementById('new-posts-banner');
+    if (!banner) return;
+    banner.textContent = `${pendingNewPosts} new ${pendingNewPosts === 1 ? 'post' : 'posts'}`;
+    banner.style.display = pendingNewPosts > 0 ? 'block' : 'none';
+  }
+
+  // Show the new comment count and last commenter on a post in the feed
+  function updatePostActivity(data) {
+    const post = allPosts.find(p => p.id === data.post_id);
+    if (!post) return;
+    post.comment_count = data.comment_count;
+    post.last_comment_at = data.last_comment_at;
+    post.last_commenter = data.last_commenter;
+    post.last_activity_at = data.last_comment_at;
+    renderPosts(allPosts);
+  }
+
+  // Load the managed categories into the post form
+  async function loadCategories() {
+    try {
+      allCategories = await api('/api/categories');
+    } catch (error) {
+      allCategories = [];
+    }
+    const select = document.getElementById('post-categories');
+    if (!select) return;
+    select.innerHTML = '';
+    allCategories.forEach(cat => {
+      const option = document.createElement('option');
+      option.value = cat.name;
+      option.textContent = cat.name;
+      select.appendChild(option);
+    });
+    buildCategoryTabs(allPosts);
+  }
+
   // Create a new post
   async function createPost(e) {
     e.preventDefault();
-    const category = document.getElementById('post-category').value;
+    const title = document.getElementById('post-title').value;
+    const categories = Array.from(document.getElementById('post-categories').selectedOptions).map(o => o.value);
     const content = document.getElementById('post-content').value;
-    const post = { user_id: currentUser.id, category, content };
+    const tags = document.getElementById('post-tags').value.split(',').map(t => t.trim()).filter(Boolean);
+    const post = { user_id: currentUser.id, title, categories, tags, content };
+    const poll = readPollForm();
+    if (poll) post.poll = poll;
+    try {
+      post.attachment_ids = await uploadImages(document.getElementById('post-images'));
+    } catch (error) {
+      alert(error.message);
+      return;
+    }
+    await settleDraft('post');
     try {
       const res = await fetch('/api/posts/create', {
         method: 'POST',
@@ -27,14 +105,20 @@ async function loadPosts() {
       });
       if (!res.ok) {
         const err = await res.text();
+        if (res.status === 400) alert(err);
         return;
       }
       const newPost = await res.json();
+      if (newPost.hidden) {
+        alert('Your post is waiting for a moderator to review it.');
+        document.getElementById('post-form').reset();
+        return;
+      }
       if (!Array.isArray(allPosts)) {
         allPosts = [];
       }
       allPosts.unshift(newPost);
-      buildCategoryTabs(allPosts);
+      loadCategories();
       renderPosts(allPosts);
       document.getElementById('post-form').reset();
     } catch (error) {
@@ -46,31 +130,48 @@ async function loadPosts() {
   function buildCategoryTabs(posts) {
     const tabContainer = document.getElementById("category-tabs");
     if (!tabContainer) return;
+    // Only show categories that have posts
     let categories = new Set();
-    posts.forEach(post => {
-      if (post.category) categories.add(post.category);
+    allCategories.forEach(cat => {
+      if (cat.post_count > 0) categories.add(cat.name);
     });
     tabContainer.innerHTML = "";
     const allTab = document.createElement("button");
     allTab.textContent = "All";
-    allTab.className = currentCategory === "All" ? "active" : "";
+    allTab.className = currentCategory === "All" && !savedView ? "active" : "";
     allTab.addEventListener("click", () => {
       currentCategory = "All";
-      renderPosts(allPosts);
-      buildCategoryTabs(allPosts);
+      currentTag = "";
+      savedView = false;
+      allPosts = [];
+      loadPosts();
     });
     tabContainer.appendChild(allTab);
     categories.forEach(cat => {
       const btn = document.createElement("button");
       btn.textContent = cat;
-      btn.className = currentCategory === cat ? "active" : "";
+      btn.className = currentCategory === cat && !savedView ? "active" : "";
       btn.addEventListener("click", () => {
         currentCategory = cat;
-        renderPosts(allPosts);
-        buildCategoryTabs(allPosts);
+        savedView = false;
+        allPosts = [];
+        loadPosts();
       });
       tabContainer.appendChild(btn);
     });
+    const savedTab = document.createElement("button");
+    savedTab.textContent = "Saved";
+    savedTab.className = savedView ? "active" : "";
+    savedTab.addEventListener("click", () => {
+      savedView = true;
+      savedFolder = "";
+      allPosts = [];
+      loadPosts();
+    });
+    tabContainer.appendChild(savedTab);
+    if (savedView) {
+      loadBookmarkFolders(tabContainer);
+    }
   }
   
   // Render posts filtered by category
@@ -79,7 +180,7 @@ async function loadPosts() {
     container.innerHTML = "";
     let filtered = posts;
     if (currentCategory !== "All") {
-      filtered = posts.filter(post => post.category === currentCategory);
+      filtered = posts.filter(post => (post.categories || [post.category]).includes(currentCategory));
     }
     if (!filtered || filtered.length === 0) {
       container.innerHTML = `<p class="empty-state">There are no posts yet. Please create one!</p>`;
@@ -94,23 +195,225 @@ async function loadPosts() {
       
       postDiv.innerHTML = `
         <div class="post-header">
-          <h3>${post.category}</h3>
+          <h3><a class="post-permalink" href="/posts/${post.id}/${post.slug}" data-post-id="${post.id}"></a></h3>
           <div class="post-meta">
+            <span class="post-category"></span>
             <span class="post-author">By: ${toTitleCase(post.nickname)}</span>
             <span class="post-date">${postDate}</span>
+            ${post.edited ? '<span class="post-edited">(edited)</span>' : ''}
+            ${post.pinned ? '<span class="post-pinned">Pinned</span>' : ''}
+            ${post.locked ? '<span class="post-locked">Locked</span>' : ''}
+            ${post.bookmark_folder ? '<span class="post-folder"></span>' : ''}
           </div>
         </div>
-        <div class="post-content">${post.content}</div>
+        <div class="post-content markdown">${post.content_html}</div>
+        ${(post.tags || []).length ? `<div class="post-tags">${post.tags.map(t => `<a href="#" class="post-tag" data-tag="${t}">#${t}</a>`).join(' ')}</div>` : ''}
+        ${renderAttachments(post.attachments)}
+        ${renderReactionBar('post', post)}
+        <div class="post-activity">
+          ${post.comment_count || 0} ${post.comment_count === 1 ? 'comment' : 'comments'}
+          ${post.last_comment_at ? ` · last by ${toTitleCase(post.last_commenter)} ${formatDate(post.last_comment_at, 'full')}` : ''}
+        </div>
         <div class="post-actions">
           <button data-post-id="${post.id}" class="view-comments-btn">View Comments</button>
+          <button data-post-id="${post.id}" class="save-post-btn">${post.saved ? 'Saved' : 'Save'}</button>
+          <button data-post-id="${post.id}" class="follow-post-btn">${post.subscribed ? 'Unfollow' : 'Follow'}</button>
+          ${post.user_id === currentUser.id ? `
+          <button data-post-id="${post.id}" class="edit-post-btn">Edit</button>
+          <button data-post-id="${post.id}" class="delete-post-btn">Delete</button>` : renderReportButton('post', post.id)}
+          ${renderModerationButtons(post)}
         </div>
       `;
+      // Titles, category and folder names are plain text and may contain markup characters
+      postDiv.querySelector('.post-permalink').textContent = post.title;
+      postDiv.querySelector('.post-category').textContent = (post.categories || [post.category]).join(', ');
+      if (post.bookmark_folder) postDiv.querySelector('.post-folder').textContent = `Saved in ${post.bookmark_folder}`;
+      linkMentions(postDiv.querySelector('.post-content'), post.mentions);
+      if (post.poll) postDiv.querySelector('.post-content').after(buildPoll(post.id, post.poll));
       container.appendChild(postDiv);
     });
+    if (postsNextCursor) {
+      const moreBtn = document.createElement('button');
+      moreBtn.id = 'load-more-posts';
+      moreBtn.textContent = 'Load more posts';
+      moreBtn.addEventListener('click', () => loadPosts(true));
+      container.appendChild(moreBtn);
+    }
+    document.querySelectorAll('.post-permalink').forEach(link => {
+      link.addEventListener('click', function (e) {
+        e.preventDefault();
+        showComments(this.getAttribute('data-post-id'));
+      });
+    });
     document.querySelectorAll('.view-comments-btn').forEach(btn => {
       btn.addEventListener('click', function () {
         const postId = this.getAttribute('data-post-id');
         showComments(postId);
       });
     });
-  }
\ No newline at end of file
+    document.querySelectorAll('.post-tag').forEach(link => {
+      link.addEventListener('click', function (e) {
+        e.preventDefault();
+        showTag(this.getAttribute('data-tag'));
+      });
+    });
+    document.querySelectorAll('.save-post-btn').forEach(btn => {
+      btn.addEventListener('click', function () {
+        toggleBookmark(this.getAttribute('data-post-id'));
+      });
+    });
+    document.querySelectorAll('.follow-post-btn').forEach(btn => {
+      btn.addEventListener('click', function () {
+        toggleSubscription(this.getAttribute('data-post-id'));
+      });
+    });
+    document.querySelectorAll('.edit-post-btn').forEach(btn => {
+      btn.addEventListener('click', function () {
+        editPost(this.getAttribute('data-post-id'));
+      });
+    });
+    document.querySelectorAll('.delete-post-btn').forEach(btn => {
+      btn.addEventListener('click', function () {
+        deletePost(this.getAttribute('data-post-id'));
+      });
+    });
+  }
+
+  // Show the posts carrying a tag, with the tag and its post count on top
+  async function showTag(tag) {
+    currentTag = tag;
+    savedView = false;
+    allPosts = [];
+    const header = document.getElementById('tag-header');
+    header.style.display = 'block';
+    header.innerHTML = `<strong>#${tag}</strong> <button type="button" id="clear-tag">Show all posts</button>`;
+    document.getElementById('clear-tag').addEventListener('click', clearTag);
+    api(`/api/tags/${encodeURIComponent(tag)}`).then(info => {
+      currentTag = info.name;
+      header.querySelector('strong').textContent = `#${info.name} · ${info.post_count} ${info.post_count === 1 ? 'post' : 'posts'}`;
+    }).catch(() => {});
+    loadPosts();
+  }
+
+  function clearTag() {
+    currentTag = "";
+    document.getElementById('tag-header').style.display = 'none';
+    allPosts = [];
+    loadPosts();
+  }
+
+  // Suggest tags for the one being typed in the post form
+  async function suggestTags() {
+    const input = document.getElementById('post-tags');
+    const parts = input.value.split(',');
+    const prefix = parts.pop().trim();
+    const list = document.getElementById('tag-suggestions');
+    list.innerHTML = '';
+    if (!prefix) return;
+    let tags = [];
+    try {
+      tags = await api(`/api/tags?prefix=${encodeURIComponent(prefix)}`);
+    } catch (error) {
+      return;
+    }
+    const before = parts.map(p => p.trim()).filter(Boolean);
+    tags.forEach(t => list.appendChild(new Option(`${t.name} (${t.post_count})`, before.concat(t.name).join(', '))));
+  }
+
+  // Folder picker shown next to the tabs in the saved view
+  async function loadBookmarkFolders(tabContainer) {
+    let folders = [];
+    try {
+      folders = await api('/api/bookmarks/folders');
+    } catch (error) {
+      return;
+    }
+    if (folders.length === 0) return;
+    const select = document.createElement('select');
+    select.id = 'bookmark-folders';
+    select.add(new Option('All folders', ''));
+    folders.forEach(f => select.add(new Option(`${f.name} (${f.count})`, f.name)));
+    select.value = savedFolder;
+    select.addEventListener('change', () => {
+      savedFolder = select.value;
+      allPosts = [];
+      loadPosts();
+    });
+    tabContainer.appendChild(select);
+  }
+
+  // Save a post, asking for an optional folder, or remove it from the saved posts
+  async function toggleBookmark(postId) {
+    const post = allPosts.find(p => p.id === postId);
+    if (!post) return;
+    let res;
+    if (post.saved) {
+      res = await fetch(`/api/posts/${postId}/bookmark`, { method: 'DELETE' });
+    } else {
+      const folder = prompt('Save to folder (optional)', '');
+      if (folder === null) return;
+      res = await fetch(`/api/posts/${postId}/bookmark`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ folder })
+      });
+    }
+    if (!res.ok) {
+      alert(await res.text());
+      return;
+    }
+    if (post.saved && savedView) {
+      allPosts = allPosts.filter(p => p.id !== postId);
+    } else {
+      post.saved = !post.saved;
+    }
+    renderPosts(allPosts);
+  }
+
+  // Edit the title and content of one of the user's posts
+  async function editPost(postId) {
+    const post = allPosts.find(p => p.id === postId);
+    if (!post) return;
+    const title = prompt('Title', post.title);
+    if (title === null) return;
+    const content = prompt('Content', post.content);
+    if (content === null) return;
+    const res = await fetch(`/api/posts/${postId}`, {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ title, content })
+    });
+    if (!res.ok) {
+      alert(await res.text());
+      return;
+    }
+    const updated = await res.json();
+    if (updated.hidden) {
+      alert('Your post is waiting for a moderator to review it.');
+      allPosts = allPosts.filter(p => p.id !== postId);
+      renderPosts(allPosts);
+      return;
+    }
+    allPosts = allPosts.map(p => p.id === postId ? updated : p);
+    renderPosts(allPosts);
+  }
+
+  // Delete one of the user's posts
+  async function deletePost(postId) {
+    if (!confirm('Delete this post?')) return;
+    const res = await fetch(`/api/posts/${postId}`, { method: 'DELETE' });
+    if (!res.ok) {
+      alert(await res.text());
+      return;
+    }
+    allPosts = allPosts.filter(p => p.id !== postId);
+    renderPosts(allPosts);
+  }
+
+  // Open the post named in a /posts/{id} permalink, if the page was loaded from one
+  function openPermalinkPost() {
+    const match = window.location.pathname.match(/^\/posts\/([^\/]+)/);
+    if (match) {
+      showComments(match[1]);
+    }
+  }
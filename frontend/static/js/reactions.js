@@ -0,0 +1,80 @@
+let availableReactions = ['like', 'dislike']; // Reactions users may choose from
+
+const REACTION_LABELS = { like: '👍', dislike: '👎' };
+
+// Load the reactions configured on the server
+async function loadReactionOptions() {
+  try {
+    const res = await api('/api/reactions');
+    availableReactions = res.reactions;
+  } catch (error) {
+    // Keep like and dislike
+  }
+}
+
+// Build the reaction buttons for a post or comment
+function renderReactionBar(targetType, target) {
+  const counts = target.reactions || {};
+  const mine = target.my_reactions || [];
+  const buttons = availableReactions.map(reaction => {
+    const count = counts[reaction] || 0;
+    const active = mine.includes(reaction) ? ' active' : '';
+    return `<button type="button" class="reaction-btn${active}" data-reaction="${reaction}">${REACTION_LABELS[reaction] || reaction}<span class="reaction-count">${count || ''}</span></button>`;
+  }).join('');
+  return `<div class="reaction-bar" data-target-type="${targetType}" data-target-id="${target.id}">${buttons}</div>`;
+}
+
+// Refresh the counts shown on every bar for a target
+function updateReactionBars(targetType, targetId, counts, mine) {
+  document.querySelectorAll(`.reaction-bar[data-target-type="${targetType}"][data-target-id="${targetId}"]`).forEach(bar => {
+    bar.querySelectorAll('.reaction-btn').forEach(btn => {
+      const reaction = btn.getAttribute('data-reaction');
+      btn.querySelector('.reaction-count').textContent = counts[reaction] || '';
+      if (mine) btn.classList.toggle('active', mine.includes(reaction));
+    });
+  });
+  if (targetType === 'post') {
+    const post = allPosts.find(p => p.id === targetId);
+    if (post) {
+      post.reactions = counts;
+      if (mine) post.my_reactions = mine;
+    }
+  }
+}
+
+// Toggle a reaction when one of its buttons is clicked
+document.addEventListener('click', async (e) => {
+  const btn = e.target.closest('.reaction-btn');
+  if (!btn) return;
+  const bar = btn.closest('.reaction-bar');
+  const targetType = bar.getAttribute('data-target-type');
+  const targetId = bar.getAttribute('data-target-id');
+  const res = await fetch(`/api/${targetType}s/${targetId}/reactions`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ reaction: btn.getAttribute('data-reaction') })
+  });
+  if (!res.ok) return;
+  const result = await res.json();
+  updateReactionBars(targetType, targetId, result.reactions, result.my_reactions);
+});
+
+// Apply a live update pushed over the WebSocket
+function handleLiveEvent(event) {
+  if (event.type === 'reaction') {
+    updateReactionBars(event.data.target_type, event.data.target_id, event.data.reactions || {}, null);
+  } else if (event.type === 'new_post') {
+    handleNewPost(event.data);
+  } else if (event.type === 'new_comment') {
+    updatePostActivity(event.data);
+    handleNewComment(event.data);
+  } else if (event.type === 'notification') {
+    handleNotification(event.data);
+  } else if (event.type === 'poll') {
+    updatePoll(event.data.post_id, event.data.poll);
+  } else if (event.type === 'post_moderated') {
+    handlePostModerated(event.data);
+  } else if (event.type === 'message_rejected') {
+    alert(event.data.reason);
+  }
+}
@@ -0,0 +1,173 @@
+let reportReasons = []; // Reason codes a report may give, loaded on first use
+let reportQueueCursor = ''; // Next page of the report queue, '' when there is none
+
+// Report button for a post, comment or message someone else wrote
+function renderReportButton(targetType, targetId) {
+  return `<button class="report-btn" data-target-type="${targetType}" data-target-id="${targetId}">Report</button>`;
+}
+
+// Ask why and report a post, comment, message or user
+async function reportContent(targetType, targetId) {
+  if (reportReasons.length === 0) {
+    try {
+      reportReasons = await api('/api/reports/reasons');
+    } catch (error) {
+      return;
+    }
+  }
+  const choices = reportReasons.map((r, i) => `${i + 1}. ${r.label}`).join('\n');
+  const answer = prompt(`Why are you reporting this ${targetType}?\n${choices}`);
+  if (answer === null) return;
+  const reason = reportReasons[parseInt(answer, 10) - 1];
+  if (!reason) {
+    alert('Please pick one of the numbers listed.');
+    return;
+  }
+  const note = prompt(reason.code === 'other' ? 'What is wrong?' : 'Anything moderators should know? (optional)', '');
+  if (note === null) return;
+
+  const res = await fetch('/api/reports', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ target_type: targetType, target_id: targetId, reason: reason.code, note })
+  });
+  if (!res.ok) {
+    alert(await res.text());
+    return;
+  }
+  alert('Thanks, a moderator will review your report.');
+}
+
+document.addEventListener('click', (e) => {
+  const btn = e.target.closest('.report-btn');
+  if (!btn) return;
+  reportContent(btn.getAttribute('data-target-type'), btn.getAttribute('data-target-id'));
+});
+
+const REPORT_RESOLUTIONS = {
+  dismiss: 'dismissed',
+  remove: 'removed',
+  warn: 'warned the author'
+};
+
+// Load the report queue for the status picked, or its next page when
+// append is true
+async function loadReportQueue(append = false) {
+  const list = document.getElementById('report-queue-list');
+  const params = new URLSearchParams();
+  const status = document.getElementById('report-queue-status').value;
+  if (status) params.set('status', status);
+  if (append && reportQueueCursor) params.set('cursor', reportQueueCursor);
+  let page;
+  try {
+    page = await api(`/api/moderation/reports?${params}`);
+  } catch (error) {
+    return;
+  }
+  if (!append) list.innerHTML = '';
+  page.cases.forEach(c => list.appendChild(buildReportCase(c)));
+  if (!append && page.cases.length === 0) {
+    list.innerHTML = '<p class="empty-state">No reports to review.</p>';
+  }
+  reportQueueCursor = page.next_cursor;
+  document.getElementById('report-queue-more').style.display = reportQueueCursor ? '' : 'none';
+}
+
+// Build one case of the queue. Reported text is set with textContent.
+function buildReportCase(c) {
+  const item = document.createElement('div');
+  item.className = 'report-case';
+  item.setAttribute('data-case-id', c.id);
+  item.innerHTML = `
+    <div class="report-case-header">
+      <strong>${c.target_type}</strong> by ${toTitleCase(c.author)}
+      ${c.hidden ? '<span class="post-locked">Hidden</span>' : ''}
+      <span class="notification-date">${formatDate(c.created_at, 'full')}</span>
+    </div>
+    <div class="report-preview"></div>
+    <ul class="report-list"></ul>
+    <div class="report-case-status"></div>
+    <div class="report-case-actions"></div>
+  `;
+  const preview = item.querySelector('.report-preview');
+  if (c.post_id) {
+    const link = document.createElement('a');
+    link.href = '#';
+    link.textContent = c.preview;
+    link.addEventListener('click', (e) => {
+      e.preventDefault();
+      showComments(c.post_id);
+    });
+    preview.appendChild(link);
+  } else {
+    preview.textContent = c.preview;
+  }
+  const reports = item.querySelector('.report-list');
+  if (c.filter_reason) {
+    const li = document.createElement('li');
+    li.textContent = `Held by the content filter: ${c.filter_reason}`;
+    reports.appendChild(li);
+  }
+  c.reports.forEach(r => {
+    const li = document.createElement('li');
+    const reason = reportReasons.find(x => x.code === r.reason);
+    li.textContent = `${toTitleCase(r.reporter)}: ${reason ? reason.label : r.reason}${r.note ? ` (${r.note})` : ''}`;
+    reports.appendChild(li);
+  });
+
+  const status = item.querySelector('.report-case-status');
+  if (c.status === 'resolved') {
+    status.textContent = `Resolved: ${REPORT_RESOLUTIONS[c.action] || c.action}${c.resolution_note ? ` (${c.resolution_note})` : ''}`;
+    return item;
+  }
+  if (c.status === 'claimed') status.textContent = `Claimed by ${toTitleCase(c.claimer)}`;
+
+  const actions = item.querySelector('.report-case-actions');
+  if (c.status === 'claimed' && c.claimed_by !== currentUser.id) return item;
+  actions.innerHTML = `
+    <button data-action="claim">${c.status === 'claimed' ? 'Release' : 'Claim'}</button>
+    <button data-action="dismiss">Dismiss</button>
+    <button data-action="warn">Warn author</button>
+    ${c.target_type !== 'user' ? '<button data-action="remove">Remove</button>' : ''}
+  `;
+  actions.addEventListener('click', (e) => {
+    const btn = e.target.closest('button');
+    if (btn) actOnReport(c, btn.getAttribute('data-action'), item);
+  });
+  return item;
+}
+
+async function actOnReport(c, action, item) {
+  let res;
+  if (action === 'claim') {
+    res = await fetch(`/api/moderation/reports/${c.id}/claim`, { method: c.status === 'claimed' ? 'DELETE' : 'POST' });
+  } else {
+    const note = prompt('Note for the record (optional):', '');
+    if (note === null) return;
+    res = await fetch(`/api/moderation/reports/${c.id}/resolve`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ action, note })
+    });
+  }
+  if (!res.ok) {
+    alert(await res.text());
+    return;
+  }
+  item.replaceWith(buildReportCase(await res.json()));
+}
+
+async function toggleReportQueue() {
+  const panel = document.getElementById('report-queue-panel');
+  const open = panel.style.display === 'none';
+  panel.style.display = open ? 'block' : 'none';
+  if (!open) return;
+  if (reportReasons.length === 0) {
+    try {
+      reportReasons = await api('/api/reports/reasons');
+    } catch (error) {
+      // Reasons are shown as codes
+    }
+  }
+  loadReportQueue();
+}
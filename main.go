@@ -1,11 +1,16 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"real-time-forum/backend/config"
 	"real-time-forum/backend/database"
+	"real-time-forum/backend/encryption"
+	"real-time-forum/backend/retention"
 	"real-time-forum/backend/routes"
+	"real-time-forum/backend/storage"
 	"real-time-forum/backend/utils"
 	"strings"
 )
@@ -16,9 +21,10 @@ func healthCheck(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, "Server is running")
 }
 
-// serveIndex serves the SPA index file.
+// serveIndex serves the SPA index file. Post permalinks (/posts/{id} and
+// /posts/{id}/{slug}) also get the SPA, which opens that post on load.
 func serveIndex(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path == "/" {
+	if r.URL.Path == "/" || strings.HasPrefix(r.URL.Path, "/posts/") {
 		http.ServeFile(w, r, "frontend/index.html")
 	} else {
 		// Allow static files to be served; otherwise, 404.
@@ -29,9 +35,34 @@ func serveIndex(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
+	rotateKeys := flag.Bool("rotate-message-keys", false, "re-encrypt all direct messages with the active key and exit")
+	flag.Parse()
+
+	config.Load()
+	if err := encryption.LoadKeys(config.MessageKeys, config.MessageKeyID); err != nil {
+		log.Fatalf("Invalid message encryption keys: %v", err)
+	}
+
+	if err := storage.Open(); err != nil {
+		log.Fatalf("Failed to open blob store: %v", err)
+	}
+
 	// Initialize the database.
 	database.InitDatabase()
 	defer database.DB.Close()
+	database.SeedAdmins(config.Admins)
+
+	if *rotateKeys {
+		if !encryption.Enabled() {
+			log.Fatalf("Set MESSAGE_ENCRYPTION_KEYS and MESSAGE_ENCRYPTION_KEY_ID before rotating keys")
+		}
+		count, err := database.RotateMessageKeys()
+		if err != nil {
+			log.Fatalf("Failed to rotate message keys after %d messages: %v", count, err)
+		}
+		fmt.Printf("Re-encrypted %d messages with key %s\n", count, encryption.ActiveKeyID())
+		return
+	}
 
 	// API endpoints.
 	http.HandleFunc("/api/health", healthCheck)
@@ -41,16 +72,68 @@ func main() {
 	http.HandleFunc("/api/session", utils.AuthMiddleware(routes.SessionHandler))
 	http.HandleFunc("/api/posts/create", utils.AuthMiddleware(routes.CreatePostHandler))
 	http.HandleFunc("/api/posts", utils.AuthMiddleware(routes.GetPostsHandler))
+	http.HandleFunc("/api/posts/{id}", utils.AuthMiddleware(routes.PostHandler))
+	http.HandleFunc("/api/posts/{id}/revisions", utils.AuthMiddleware(routes.PostRevisionsHandler))
+	http.HandleFunc("/api/posts/{id}/reactions", utils.AuthMiddleware(routes.PostReactionHandler))
+	http.HandleFunc("/api/posts/{id}/bookmark", utils.AuthMiddleware(routes.BookmarkHandler))
+	http.HandleFunc("/api/posts/{id}/subscription", utils.AuthMiddleware(routes.SubscriptionHandler))
+	http.HandleFunc("/api/posts/{id}/pin", utils.AuthMiddleware(routes.RequireRole(routes.PinPostHandler, routes.RoleModerator, routes.RoleAdmin)))
+	http.HandleFunc("/api/posts/{id}/lock", utils.AuthMiddleware(routes.RequireRole(routes.LockPostHandler, routes.RoleModerator, routes.RoleAdmin)))
+	http.HandleFunc("/api/posts/{id}/move", utils.AuthMiddleware(routes.RequireRole(routes.MovePostHandler, routes.RoleModerator, routes.RoleAdmin)))
+	http.HandleFunc("/api/polls/{id}/votes", utils.AuthMiddleware(routes.PollVotesHandler))
+	http.HandleFunc("/api/bookmarks", utils.AuthMiddleware(routes.GetBookmarksHandler))
+	http.HandleFunc("/api/bookmarks/folders", utils.AuthMiddleware(routes.GetBookmarkFoldersHandler))
+	http.HandleFunc("/api/drafts", utils.AuthMiddleware(routes.GetDraftsHandler))
+	http.HandleFunc("/api/drafts/{context}", utils.AuthMiddleware(routes.DraftHandler))
+	http.HandleFunc("/api/tags", utils.AuthMiddleware(routes.GetTagsHandler))
+	http.HandleFunc("/api/tags/{name}", utils.AuthMiddleware(routes.GetTagHandler))
+	http.HandleFunc("/api/categories", utils.AuthMiddleware(routes.GetCategoriesHandler))
 	http.HandleFunc("/api/comments/create", utils.AuthMiddleware(routes.CreateCommentHandler))
 	http.HandleFunc("/api/comments", utils.AuthMiddleware(routes.GetCommentsHandler))
+	http.HandleFunc("/api/comments/{id}", utils.AuthMiddleware(routes.CommentHandler))
+	http.HandleFunc("/api/comments/{id}/revisions", utils.AuthMiddleware(routes.CommentRevisionsHandler))
+	http.HandleFunc("/api/comments/{id}/reactions", utils.AuthMiddleware(routes.CommentReactionHandler))
+	http.HandleFunc("/api/attachments", utils.AuthMiddleware(routes.UploadAttachmentHandler))
+	http.HandleFunc("/api/attachments/{id}", utils.AuthMiddleware(routes.AttachmentHandler))
+	http.HandleFunc("/api/attachments/{id}/thumbnail", utils.AuthMiddleware(routes.AttachmentThumbnailHandler))
+	http.HandleFunc("/api/notifications", utils.AuthMiddleware(routes.GetNotificationsHandler))
+	http.HandleFunc("/api/notifications/unread", utils.AuthMiddleware(routes.UnreadNotificationsHandler))
+	http.HandleFunc("/api/notifications/read", utils.AuthMiddleware(routes.MarkNotificationsReadHandler))
+	http.HandleFunc("/api/notifications/settings", utils.AuthMiddleware(routes.NotificationSettingsHandler))
+	http.HandleFunc("/api/reactions", utils.AuthMiddleware(routes.GetReactionsHandler))
 	http.HandleFunc("/api/chat", utils.AuthMiddleware(routes.ChatHandler))
 	http.HandleFunc("/api/chat/history", utils.AuthMiddleware(routes.GetChatHistoryHandler))
 	http.HandleFunc("/api/chat/count", utils.AuthMiddleware(routes.GetChatMessageCountHandler))
+	http.HandleFunc("/api/chat/retention", utils.AuthMiddleware(routes.ConversationRetentionHandler))
 	http.HandleFunc("/api/users", utils.AuthMiddleware(routes.GetUsersHandler))
+	http.HandleFunc("/api/search", utils.AuthMiddleware(routes.SearchHandler))
+	http.HandleFunc("/api/export", utils.AuthMiddleware(routes.StartExportHandler))
+	http.HandleFunc("/api/export/status", utils.AuthMiddleware(routes.ExportStatusHandler))
+	http.HandleFunc("/api/export/download", utils.AuthMiddleware(routes.DownloadExportHandler))
+	http.HandleFunc("/api/admin/categories", utils.AuthMiddleware(routes.RequireRole(routes.CreateCategoryHandler, routes.RoleAdmin)))
+	http.HandleFunc("/api/admin/categories/{id}", utils.AuthMiddleware(routes.RequireRole(routes.CategoryHandler, routes.RoleAdmin)))
+	http.HandleFunc("/api/reports", utils.AuthMiddleware(routes.CreateReportHandler))
+	http.HandleFunc("/api/reports/reasons", utils.AuthMiddleware(routes.ReportReasonsHandler))
+	http.HandleFunc("/api/moderation/reports", utils.AuthMiddleware(routes.RequireRole(routes.ReportQueueHandler, routes.RoleModerator, routes.RoleAdmin)))
+	http.HandleFunc("/api/moderation/reports/{id}/claim", utils.AuthMiddleware(routes.RequireRole(routes.ClaimReportHandler, routes.RoleModerator, routes.RoleAdmin)))
+	http.HandleFunc("/api/moderation/reports/{id}/resolve", utils.AuthMiddleware(routes.RequireRole(routes.ResolveReportHandler, routes.RoleModerator, routes.RoleAdmin)))
+	http.HandleFunc("/api/moderation/log", utils.AuthMiddleware(routes.RequireRole(routes.ModerationLogHandler, routes.RoleModerator, routes.RoleAdmin)))
+	http.HandleFunc("/api/admin/tags", utils.AuthMiddleware(routes.RequireRole(routes.AdminTagsHandler, routes.RoleAdmin)))
+	http.HandleFunc("/api/admin/tags/{name}", utils.AuthMiddleware(routes.RequireRole(routes.AdminTagHandler, routes.RoleAdmin)))
+	http.HandleFunc("/api/admin/tags/{name}/merge", utils.AuthMiddleware(routes.RequireRole(routes.MergeTagHandler, routes.RoleAdmin)))
+	http.HandleFunc("/api/admin/banned-words", utils.AuthMiddleware(routes.RequireRole(routes.BannedWordsHandler, routes.RoleAdmin)))
+	http.HandleFunc("/api/admin/banned-words/{pattern}", utils.AuthMiddleware(routes.RequireRole(routes.BannedWordHandler, routes.RoleAdmin)))
+	http.HandleFunc("/api/admin/retention", utils.AuthMiddleware(routes.RequireRole(routes.RetentionPreviewHandler, routes.RoleAdmin)))
+
+	// Exports from an earlier run can no longer be downloaded.
+	routes.CleanExports()
 
 	// Start a goroutine to handle WebSocket message broadcasting.
 	go routes.HandleMessages()
 
+	// Periodically apply the data retention policies.
+	retention.Start()
+
 	// Serve static files.
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("frontend/static"))))
 